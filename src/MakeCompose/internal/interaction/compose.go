@@ -53,12 +53,16 @@ func WriteDockerCompose(cfg *models.DockerCompose) error {
 	// 引导节点
 	needBootstrap = YesOrNo("Do you need bootstrap node?")
 	if needBootstrap {
-		var waitTime int
+		var nodeTTL int
 
-		// 等待时间
-		waitTime = Number("Enter bootstrap wait time (seconds)")
-		if waitTime < 0 {
-			waitTime = 0
+		// 节点过期时间
+		for {
+			nodeTTL = Number("Enter bootstrap node TTL (seconds)")
+			if nodeTTL > 0 {
+				break
+			} else {
+				fmt.Println("Please enter a valid TTL (>0)")
+			}
 		}
 
 		// 邻居密度
@@ -79,7 +83,7 @@ func WriteDockerCompose(cfg *models.DockerCompose) error {
 		environment["DEBUG_MODE"] = BoolToString(debugMode)
 		environment["TEST_MODE"] = BoolToString(testMode)
 		environment["HOST"] = "bootstrap:" + strconv.Itoa(port)
-		environment["WAIT_TIME"] = strconv.Itoa(waitTime)
+		environment["NODE_TTL"] = strconv.Itoa(nodeTTL)
 		environment["DENSITY"] = strconv.Itoa(density)
 
 		// 存储
@@ -92,6 +96,7 @@ func WriteDockerCompose(cfg *models.DockerCompose) error {
 
 		node := models.Node{
 			Image:       models.Image,
+			Command:     []string{"bootstrap"},
 			Environment: environment,
 			Volumes:     volumes,
 			Networks:    networks,
@@ -128,6 +133,7 @@ func WriteDockerCompose(cfg *models.DockerCompose) error {
 
 		node := models.Node{
 			Image:       models.Image,
+			Command:     []string{"node"},
 			Environment: environment,
 			Volumes:     volumes,
 			Networks:    networks,
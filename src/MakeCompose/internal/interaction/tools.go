@@ -31,7 +31,7 @@ func YesOrNo(question string) bool {
 func Number(question string) int {
 	for {
 		var input string
-		fmt.Printf(question + " (number):")
+		fmt.Print(question + " (number):")
 
 		_, err := fmt.Scanln(&input)
 		if err != nil {
@@ -52,7 +52,7 @@ func Number(question string) int {
 func Text(question string) string {
 	for {
 		var input string
-		fmt.Printf(question + ":")
+		fmt.Print(question + ":")
 
 		_, err := fmt.Scanln(&input)
 		if err != nil {
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"TrustMesh-PoC-1/internal/config"
+	"TrustMesh-PoC-1/internal/consensus"
+	"TrustMesh-PoC-1/internal/constants"
+	"TrustMesh-PoC-1/internal/db"
+	"TrustMesh-PoC-1/internal/keys"
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/simulator"
+	"TrustMesh-PoC-1/internal/table"
+	"TrustMesh-PoC-1/internal/topology"
+	"TrustMesh-PoC-1/internal/trace"
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+// newFlagSet 创建子命令参数集
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(commandName(name), flag.ExitOnError)
+	fs.Usage = usageFor(fs, name)
+	return fs
+}
+
+// dataDirFlag 注册 -data-dir 参数，默认值取环境变量 DATA_DIR
+func dataDirFlag(fs *flag.FlagSet) *string {
+	def := constants.DefaultConfigDir
+	if v, ok := os.LookupEnv("DATA_DIR"); ok {
+		def = v
+	}
+	return fs.String("data-dir", def, "data directory, env DATA_DIR")
+}
+
+// passphraseFlag 注册 -key-passphrase-file 参数，返回读取口令的函数
+func passphraseFlag(fs *flag.FlagSet) func() ([]byte, error) {
+	file := fs.String("key-passphrase-file", os.Getenv("KEY_PASSPHRASE_FILE"), "passphrase file of the seed file, env KEY_PASSPHRASE_FILE or KEY_PASSPHRASE")
+	return func() ([]byte, error) {
+		return config.ReadPassphrase(*file, os.Getenv("KEY_PASSPHRASE"))
+	}
+}
+
+// unlockKeys 设置密钥目录与口令
+func unlockKeys(dir string, passphrase func() ([]byte, error)) error {
+	pass, err := passphrase()
+	if err != nil {
+		return err
+	}
+	keys.SetDir(dir)
+	keys.SetPassphrase(pass)
+
+	return nil
+}
+
+// printKey 输出公钥与 NodeId
+func printKey(pk []byte) {
+	nodeId := blake3.Sum256(pk)
+	fmt.Printf("Public key: %s\n", hex.EncodeToString(pk))
+	fmt.Printf("NodeId:     %s\n", hex.EncodeToString(nodeId[:]))
+}
+
+// runKeygen 生成节点密钥
+func runKeygen(args []string) error {
+	fs := newFlagSet("keygen")
+	dir := dataDirFlag(fs)
+	force := fs.Bool("force", false, "overwrite the existing key, the NodeId changes")
+	passphrase := passphraseFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := unlockKeys(*dir, passphrase); err != nil {
+		return err
+	}
+	_, pk, err := keys.CreateKey(*force)
+	if errors.Is(err, keys.ErrKeyExists) {
+		return fmt.Errorf("a key already exists in %s, use -force to overwrite", *dir)
+	} else if err != nil {
+		return err
+	}
+
+	printKey(pk)
+	return nil
+}
+
+// runId 输出节点密钥对应的 NodeId
+func runId(args []string) error {
+	fs := newFlagSet("id")
+	dir := dataDirFlag(fs)
+	passphrase := passphraseFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := unlockKeys(*dir, passphrase); err != nil {
+		return err
+	}
+	_, pk, err := keys.LoadKey()
+	if err != nil {
+		return err
+	}
+
+	printKey(pk)
+	return nil
+}
+
+// runRotate 轮换节点密钥，旧密钥签署指向新密钥的声明
+func runRotate(args []string) error {
+	fs := newFlagSet("rotate")
+	dir := dataDirFlag(fs)
+	passphrase := passphraseFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := unlockKeys(*dir, passphrase); err != nil {
+		return err
+	}
+	r, err := keys.Rotate()
+	if err != nil {
+		return err
+	}
+
+	oldId := blake3.Sum256(r.Old[:])
+	fmt.Printf("Old NodeId: %s\n", hex.EncodeToString(oldId[:]))
+	printKey(r.New[:])
+	return nil
+}
+
+// runSigner 作为外部签名进程运行，在 Unix 套接字上提供签名服务
+func runSigner(args []string) error {
+	fs := newFlagSet("signer")
+	dir := dataDirFlag(fs)
+	passphrase := passphraseFlag(fs)
+	socket := fs.String("socket", os.Getenv("KEY_SIGNER"), "unix socket to listen on, env KEY_SIGNER")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *socket == "" {
+		return errors.New("-socket is required")
+	}
+
+	if err := unlockKeys(*dir, passphrase); err != nil {
+		return err
+	}
+	signer, _, err := keys.Unlock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = signer.Close()
+	}()
+	if !signer.Locked() {
+		logger.Warning("Cannot lock the private key in memory, it may be swapped to disk")
+	}
+
+	l, err := keys.ListenSigner(*socket)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(*socket)
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	nodeId := blake3.Sum256(signer.PublicKey())
+	logger.Info("Signer for %s is listening on %s", hex.EncodeToString(nodeId[:]), *socket)
+
+	return keys.ServeSigner(ctx, l, signer)
+}
+
+// runPeers 列出节点表
+func runPeers(args []string) error {
+	fs := newFlagSet("peers")
+	dir := dataDirFlag(fs)
+	limit := fs.Int("limit", 100, "maximum number of peers, 0 for all")
+	addrs := fs.Bool("addrs", false, "list every known address with its dial stats")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// 不存在时不创建数据库
+	if _, err := os.Stat(db.Path(*dir)); err != nil {
+		return fmt.Errorf("no database in %s: %w", *dir, err)
+	}
+	database, err := db.InitDB(*dir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close(database)
+	}()
+
+	query := database.Order("last_seen DESC")
+	if *limit > 0 {
+		query = query.Limit(*limit)
+	}
+	peers := make([]table.Peer, 0)
+	if err := query.Find(&peers).Error; err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE ID\tADDRESS\tREPUTATION\tLAST SEEN\tSTATUS")
+	for _, p := range peers {
+		var nodeId [32]byte
+		copy(nodeId[:], p.NodeID)
+		addr, _ := db.BestAddress(database, nodeId)
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", hex.EncodeToString(p.NodeID), addr, p.Reputation, formatMilli(p.LastSeen), p.Status)
+
+		if !*addrs {
+			continue
+		}
+		list := make([]table.PeerAddress, 0)
+		err := database.Where("node_id = ?", p.NodeID).
+			Order("last_success DESC").
+			Find(&list).Error
+		if err != nil {
+			return err
+		}
+		for _, a := range list {
+			fmt.Fprintf(w, "  %s\tsuccess %s\tfailure %s\tfailures %d\t\n", a.Address, formatMilli(a.LastSuccess), formatMilli(a.LastFailure), a.Failures)
+		}
+	}
+
+	return w.Flush()
+}
+
+// formatMilli 格式化毫秒时间戳
+func formatMilli(ms uint64) string {
+	if ms == 0 {
+		return "-"
+	}
+	return time.UnixMilli(int64(ms)).UTC().Format(time.RFC3339)
+}
+
+// runVerify 校验区块文件
+func runVerify(args []string) error {
+	fs := newFlagSet("verify")
+	dir := dataDirFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		matches, err := filepath.Glob(filepath.Join(consensus.BlockDir(*dir), "*.json"))
+		if err != nil {
+			return err
+		}
+		sort.Strings(matches)
+		files = matches
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no block files in %s", consensus.BlockDir(*dir))
+	}
+
+	failed := 0
+	for _, f := range files {
+		round, err := consensus.VerifyBlockFile(f)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL  %s: %v\n", f, err)
+			continue
+		}
+		fmt.Printf("OK    %s (round %d)\n", f, round)
+	}
+
+	fmt.Printf("%d files, %d failed\n", len(files), failed)
+	if failed > 0 {
+		return fmt.Errorf("%d block files failed verification", failed)
+	}
+
+	return nil
+}
+
+// runReplay 重放共识状态机日志并核对动作
+func runReplay(args []string) error {
+	fs := newFlagSet("replay")
+	dir := dataDirFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		matches, err := filepath.Glob(filepath.Join(*dir, "journal", "*.jsonl"))
+		if err != nil {
+			return err
+		}
+		sort.Strings(matches)
+		files = matches
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no journal files in %s", filepath.Join(*dir, "journal"))
+	}
+
+	failed := 0
+	for _, f := range files {
+		steps, err := replayFile(f)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL  %s: %v\n", f, err)
+			continue
+		}
+		fmt.Printf("OK    %s (%d steps)\n", f, steps)
+	}
+
+	fmt.Printf("%d files, %d failed\n", len(files), failed)
+	if failed > 0 {
+		return fmt.Errorf("%d journal files failed replay", failed)
+	}
+
+	return nil
+}
+
+// replayFile 重放一个日志文件
+func replayFile(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = file.Close() }()
+
+	return consensus.Replay(file)
+}
+
+// runTrace 合并追踪文件，输出提案传播树与每跳延迟
+func runTrace(args []string) error {
+	fs := newFlagSet("trace")
+	dir := dataDirFlag(fs)
+	round := fs.Int64("round", 0, "round to print, 0 for every round")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{filepath.Join(*dir, "trace.jsonl")}
+	}
+	spans, err := trace.ReadFiles(files...)
+	if err != nil {
+		return err
+	}
+
+	rounds := []int64{*round}
+	if *round == 0 {
+		rounds = trace.Rounds(spans)
+	}
+	if len(rounds) == 0 {
+		return errors.New("no spans in trace files")
+	}
+
+	for _, r := range rounds {
+		trees := trace.Merge(spans, r)
+		if len(trees) == 0 {
+			return fmt.Errorf("no spans for round %d", r)
+		}
+		for _, t := range trees {
+			printTree(t)
+		}
+	}
+
+	return nil
+}
+
+// printTree 输出一棵传播树
+func printTree(t *trace.Tree) {
+	fmt.Printf("round %d proposal %s, %d nodes\n", t.Round, t.PHash, t.Nodes)
+
+	var walk func(h *trace.Hop, depth int)
+	walk = func(h *trace.Hop, depth int) {
+		indent := strings.Repeat("  ", depth+1)
+		if h.Sender == "" {
+			fmt.Printf("%s%s  hop %d  published %s\n", indent, shortId(h.Node), h.Hop, h.At.UTC().Format("15:04:05.000"))
+		} else {
+			fmt.Printf("%s%s  hop %d  +%v  %s", indent, shortId(h.Node), h.Hop, h.Latency().Round(time.Microsecond), h.Message)
+			if h.Duplicates > 0 {
+				fmt.Printf("  %d duplicates", h.Duplicates)
+			}
+			fmt.Println()
+		}
+		for _, c := range h.Children {
+			walk(c, depth+1)
+		}
+	}
+	if t.Root != nil {
+		walk(t.Root, 0)
+	} else {
+		fmt.Println("  (origin not in trace files)")
+	}
+	for _, o := range t.Orphans {
+		fmt.Printf("  from %s (not in trace files):\n", shortId(o.Sender))
+		walk(o, 1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "  HOP\tNODES\tAVG\tMAX")
+	for _, s := range t.Stats() {
+		fmt.Fprintf(w, "  %d\t%d\t%v\t%v\n", s.Hop, s.Count, s.Avg.Round(time.Microsecond), s.Max.Round(time.Microsecond))
+	}
+	_ = w.Flush()
+	fmt.Println()
+}
+
+// shortId NodeId 前 12 位
+func shortId(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// runSim 在单个进程中模拟多节点共识
+func runSim(args []string) error {
+	cfg := config.Default()
+
+	fs := newFlagSet("sim")
+	nodes := fs.Int("nodes", 100, "number of nodes")
+	rounds := fs.Int("rounds", 3, "number of rounds")
+	first := fs.Int64("first-round", 0, "first round, 0 for the round after now")
+	out := fs.String("out", "sim", "output directory, blocks of node i are written to <out>/node-<i>/block, empty to keep them in a temporary directory")
+	seed := fs.Int64("seed", 1, "random seed of topology, keys, latency and loss")
+	fs.IntVar(&cfg.Consensus.Interval, "interval", cfg.Consensus.Interval, "round interval in seconds")
+	fs.IntVar(&cfg.Consensus.DiffuseHop, "hop", cfg.Consensus.DiffuseHop, "neighbours a proposal is sent to on every broadcast")
+	burrs := fs.Uint("score-burrs", uint(cfg.Consensus.ScoreBurrs), "score rise that triggers a rebroadcast")
+	topo := fs.String("topology", "random-regular", "topology generator: random-regular, erdos-renyi, small-world, scale-free, ring or clustered")
+	degree := fs.Int("degree", 8, "target degree of the topology")
+	beta := fs.Float64("topology-beta", cfg.Server.TopologyBeta, "rewiring probability of small-world")
+	clusters := fs.Int("topology-clusters", cfg.Server.TopologyClusters, "clusters of clustered")
+	bridges := fs.Int("topology-bridges", cfg.Server.TopologyBridges, "bridges between adjacent clusters of clustered")
+	latency := fs.Duration("latency", 50*time.Millisecond, "one-way latency of every link")
+	jitter := fs.Duration("jitter", 20*time.Millisecond, "random latency added on top of -latency")
+	fs.IntVar(&cfg.Limits.MsgRate, "msg-rate", cfg.Limits.MsgRate, "messages per second read from one connection, faster peers are slowed down")
+	fs.IntVar(&cfg.Limits.MsgBurst, "msg-burst", cfg.Limits.MsgBurst, "message burst accepted on one connection")
+	loss := fs.Float64("loss", 0, "probability that a write is lost and retransmitted, in [0, 1)")
+	var partitions []string
+	fs.Func("partition", "partition as start,end,groups relative to the first round, e.g. 10s,40s,2; repeatable", func(s string) error {
+		partitions = append(partitions, s)
+		return nil
+	})
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg.Consensus.ScoreBurrs = uint32(*burrs)
+
+	simCfg := simulator.Config{
+		Nodes:      *nodes,
+		Rounds:     *rounds,
+		FirstRound: *first,
+		Node:       cfg,
+		Topology:   *topo,
+		Degree:     *degree,
+		TopologyOptions: topology.Options{
+			Beta:     *beta,
+			Clusters: *clusters,
+			Bridges:  *bridges,
+		},
+		Link: simulator.LinkConfig{
+			Latency: *latency,
+			Jitter:  *jitter,
+			Loss:    *loss,
+		},
+		Seed:   *seed,
+		OutDir: *out,
+	}
+	for _, s := range partitions {
+		p, err := parsePartition(s, *nodes)
+		if err != nil {
+			return err
+		}
+		simCfg.Partitions = append(simCfg.Partitions, p)
+	}
+
+	sim, err := simulator.New(simCfg)
+	if err != nil {
+		return err
+	}
+	started := time.Now()
+	res, err := sim.Run()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ROUND\tFINALIZED\tWINNERS\tAGREEMENT\tLEADER\tPROPOSALS")
+	for _, r := range res.Rounds {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%.1f%%\t%s\t%.1f\n", r.Round, r.Finalized, r.Winners, r.Agreement*100, shortId(hex.EncodeToString(r.Leader[:])), r.MeanProposals)
+	}
+	_ = w.Flush()
+
+	fmt.Printf("\n%d connections, %d writes, %d bytes, %d retransmits, %d cut by partitions\n", res.Net.Conns, res.Net.Messages, res.Net.Bytes, res.Net.Retransmits, res.Net.Cut)
+	if res.Bans > 0 {
+		fmt.Printf("%d peers banned for misbehaviour\n", res.Bans)
+	}
+	fmt.Printf("%v simulated in %v, %d events\n", res.Duration, time.Since(started).Round(time.Millisecond), res.Events)
+	if *out != "" {
+		fmt.Printf("Blocks written to %s\n", *out)
+	}
+
+	return nil
+}
+
+// parsePartition 解析 start,end,groups 格式的分区
+func parsePartition(s string, nodes int) (simulator.Partition, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return simulator.Partition{}, fmt.Errorf("invalid partition %q, want start,end,groups", s)
+	}
+
+	start, err := time.ParseDuration(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return simulator.Partition{}, fmt.Errorf("invalid partition start %q: %w", parts[0], err)
+	}
+	end, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return simulator.Partition{}, fmt.Errorf("invalid partition end %q: %w", parts[1], err)
+	}
+	groups, err := strconv.Atoi(strings.TrimSpace(parts[2]))
+	if err != nil || groups < 2 {
+		return simulator.Partition{}, fmt.Errorf("invalid partition groups %q, must >= 2", parts[2])
+	}
+
+	return simulator.SplitPartition(start, end, nodes, groups), nil
+}
@@ -0,0 +1,234 @@
+package admin
+
+import (
+	"TrustMesh-PoC-1/internal/consensus"
+	"TrustMesh-PoC-1/internal/db"
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/p2p"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+// nodeRequest 针对节点的动作
+type nodeRequest struct {
+	NodeId string `json:"nodeId"`
+}
+
+// banTarget 封禁对象，NodeId 与 IP 二选一
+type banTarget struct {
+	NodeId string `json:"nodeId"`
+	IP     string `json:"ip"`
+}
+
+// banRequest 封禁请求
+type banRequest struct {
+	banTarget
+	// 封禁时长，例如 "1h"，为空表示永久
+	Duration string `json:"duration"`
+	Reason   string `json:"reason"`
+}
+
+// reputationRequest 设置信誉值请求
+type reputationRequest struct {
+	NodeId     string `json:"nodeId"`
+	Reputation int    `json:"reputation"`
+}
+
+// sendRequest 广播提案请求
+type sendRequest struct {
+	PHash string `json:"pHash"`
+}
+
+// disconnect 关闭到指定节点的连接，返回是否存在连接
+func (s *server) disconnect(nodeId [32]byte) bool {
+	ct := s.mainState.ConnectionTable
+
+	ct.Lock.RLock()
+	ioc, ok := ct.Connection[nodeId]
+	ct.Lock.RUnlock()
+
+	if ok {
+		ioc.Cancel()
+	}
+	return ok
+}
+
+// handleDisconnect 断开节点
+func (s *server) handleDisconnect(w http.ResponseWriter, r *http.Request) {
+	var req nodeRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	nodeId, err := parseHash(req.NodeId)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !s.disconnect(nodeId) {
+		writeError(w, http.StatusNotFound, errors.New("node is not connected"))
+		return
+	}
+
+	logger.Info("Admin: disconnect %v", nodeId)
+	writeJSON(w, http.StatusOK, map[string]bool{"disconnected": true})
+}
+
+// parse 解析封禁对象
+func (t banTarget) parse() ([32]byte, netip.Addr, error) {
+	switch {
+	case t.NodeId != "" && t.IP != "":
+		return [32]byte{}, netip.Addr{}, errors.New("nodeId and ip are exclusive")
+	case t.NodeId != "":
+		nodeId, err := parseHash(t.NodeId)
+		return nodeId, netip.Addr{}, err
+	case t.IP != "":
+		ip, err := netip.ParseAddr(t.IP)
+		if err != nil {
+			return [32]byte{}, netip.Addr{}, fmt.Errorf("invalid ip %q", t.IP)
+		}
+		return [32]byte{}, ip.Unmap(), nil
+	default:
+		return [32]byte{}, netip.Addr{}, errors.New("nodeId or ip is required")
+	}
+}
+
+// handleBan 封禁节点或 IP 并写入封禁表，封禁节点时断开已有连接
+func (s *server) handleBan(w http.ResponseWriter, r *http.Request) {
+	var req banRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	nodeId, ip, err := req.parse()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var until time.Time
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid duration %q", req.Duration))
+			return
+		}
+		until = s.mainState.Clock.Now().Add(d)
+	}
+	reason := req.Reason
+	if reason == "" {
+		reason = "admin"
+	}
+
+	if ip.IsValid() {
+		if err := p2p.BanIP(s.mainState, ip, until, reason); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		logger.Info("Admin: ban %s for %q", ip, req.Duration)
+		writeJSON(w, http.StatusOK, map[string]bool{"banned": true})
+		return
+	}
+
+	if err := p2p.BanNode(s.mainState, nodeId, until, reason); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	disconnected := s.disconnect(nodeId)
+
+	logger.Info("Admin: ban %v for %q", nodeId, req.Duration)
+	writeJSON(w, http.StatusOK, map[string]bool{"banned": true, "disconnected": disconnected})
+}
+
+// handleUnban 解除封禁并删除记录
+func (s *server) handleUnban(w http.ResponseWriter, r *http.Request) {
+	var req banTarget
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	nodeId, ip, err := req.parse()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if ip.IsValid() {
+		err = p2p.UnbanIP(s.mainState, ip)
+	} else {
+		err = p2p.UnbanNode(s.mainState, nodeId)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if ip.IsValid() {
+		logger.Info("Admin: unban %s", ip)
+	} else {
+		logger.Info("Admin: unban %v", nodeId)
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"banned": false})
+}
+
+// handleReputation 强制设置信誉值
+func (s *server) handleReputation(w http.ResponseWriter, r *http.Request) {
+	var req reputationRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	nodeId, err := parseHash(req.NodeId)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Reputation < consensus.MinReputation || req.Reputation > consensus.MaxReputation {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("reputation must be in [%d, %d]", consensus.MinReputation, consensus.MaxReputation))
+		return
+	}
+
+	if err := db.SetReputation(s.mainState.DB, nodeId, uint16(req.Reputation)); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, db.ErrPeerNotFound) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	logger.Info("Admin: reputation of %v set to %d", nodeId, req.Reputation)
+	writeJSON(w, http.StatusOK, map[string]int{"reputation": req.Reputation})
+}
+
+// handleSend 重新广播活跃轮次中的提案
+func (s *server) handleSend(w http.ResponseWriter, r *http.Request) {
+	var req sendRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	pHash, err := parseHash(req.PHash)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	round, err := consensus.Resend(s.ctx, s.mainState, pHash)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, consensus.ErrProposalNotFound) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	logger.Info("Admin: send proposal %v of round %v", pHash, round)
+	writeJSON(w, http.StatusOK, map[string]int64{"round": round})
+}
@@ -0,0 +1,144 @@
+package admin
+
+import (
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/models"
+	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxBodySize 动作请求体上限
+const maxBodySize = 4096
+
+// server 管理接口
+type server struct {
+	// 节点生命周期，触发的广播随之取消
+	ctx       context.Context
+	mainState *models.MainStore
+	token     string
+}
+
+// Serve 在 addr 上提供管理接口，ctx 取消时关闭
+// token 不为空时请求需要携带 Authorization: Bearer <token>，为空时只允许监听回环地址
+func Serve(ctx context.Context, addr string, token string, mainState *models.MainStore) error {
+	if token == "" && !isLoopback(addr) {
+		return fmt.Errorf("admin api on non-loopback address %s requires ADMIN_TOKEN", addr)
+	}
+
+	s := &server{ctx: ctx, mainState: mainState, token: token}
+
+	mux := http.NewServeMux()
+	// 查看
+	mux.HandleFunc("GET /admin/state", s.handleState)
+	mux.HandleFunc("GET /admin/connections", s.handleConnections)
+	mux.HandleFunc("GET /admin/rounds", s.handleRounds)
+	mux.HandleFunc("GET /admin/peers", s.handlePeers)
+	mux.HandleFunc("GET /admin/bans", s.handleBans)
+	mux.HandleFunc("GET /admin/goroutines", s.handleGoroutines)
+	// 动作
+	mux.HandleFunc("POST /admin/disconnect", s.handleDisconnect)
+	mux.HandleFunc("POST /admin/ban", s.handleBan)
+	mux.HandleFunc("POST /admin/unban", s.handleUnban)
+	mux.HandleFunc("POST /admin/reputation", s.handleReputation)
+	mux.HandleFunc("POST /admin/send", s.handleSend)
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.auth(mux),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	})
+	defer stop()
+
+	if token == "" {
+		logger.Warning("Admin API on %s has no token, any local process can control the node", addr)
+	}
+	logger.Info("Admin API is served on %s/admin", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// isLoopback 监听地址是否只在回环接口上，主机为空时监听全部接口
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// auth 校验令牌
+func (s *server) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+				writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON 输出 JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		logger.Debug("Write admin response failed: %v", err)
+	}
+}
+
+// writeError 输出错误
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// readJSON 读取动作请求体
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+
+	return nil
+}
+
+// parseHash 解析十六进制的 NodeId 或 pHash
+func parseHash(s string) ([32]byte, error) {
+	var out [32]byte
+
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 32 {
+		return out, fmt.Errorf("invalid hash %q, want 64 hex characters", s)
+	}
+	copy(out[:], b)
+
+	return out, nil
+}
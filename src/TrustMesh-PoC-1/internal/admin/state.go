@@ -0,0 +1,280 @@
+package admin
+
+import (
+	"TrustMesh-PoC-1/internal/db"
+	"TrustMesh-PoC-1/internal/models"
+	"TrustMesh-PoC-1/internal/table"
+	"encoding/hex"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+// defaultPeerLimit 默认列出的节点数量
+const defaultPeerLimit = 1000
+
+// connectionInfo 连接
+type connectionInfo struct {
+	NodeId string `json:"nodeId"`
+	Addr   string `json:"addr"`
+	// 本节点发起的连接
+	Outbound bool `json:"outbound"`
+	// 写队列中的消息数
+	WriteQueue int `json:"writeQueue"`
+	// 等待回复的事务数
+	Pending int `json:"pending"`
+}
+
+// proposalInfo 提案
+type proposalInfo struct {
+	PHash       string `json:"pHash"`
+	Proposer    string `json:"proposer"`
+	Timestamp   uint64 `json:"timestamp"`
+	PayloadSize int    `json:"payloadSize"`
+	Signers     int    `json:"signers"`
+	Score       uint32 `json:"score"`
+	LastScore   uint32 `json:"lastScore"`
+}
+
+// roundInfo 活跃轮次
+type roundInfo struct {
+	Round     int64          `json:"round"`
+	Proposals []proposalInfo `json:"proposals"`
+}
+
+// peerInfo 节点表记录
+type peerInfo struct {
+	NodeId     string `json:"nodeId"`
+	Address    string `json:"address"`
+	Reputation uint16 `json:"reputation"`
+	LastSeen   uint64 `json:"lastSeen"`
+	Status     string `json:"status"`
+}
+
+// banInfo 封禁
+type banInfo struct {
+	NodeId string `json:"nodeId,omitempty"`
+	IP     string `json:"ip,omitempty"`
+	// 为空表示永久
+	Until  *time.Time `json:"until,omitempty"`
+	Reason string     `json:"reason"`
+}
+
+// runtimeInfo 运行时
+type runtimeInfo struct {
+	Goroutines int    `json:"goroutines"`
+	HeapAlloc  uint64 `json:"heapAlloc"`
+	NumGC      uint32 `json:"numGC"`
+}
+
+// stateInfo 完整状态
+type stateInfo struct {
+	NodeId      string           `json:"nodeId"`
+	Connections []connectionInfo `json:"connections"`
+	Rounds      []roundInfo      `json:"rounds"`
+	Peers       []peerInfo       `json:"peers"`
+	Bans        []banInfo        `json:"bans"`
+	Runtime     runtimeInfo      `json:"runtime"`
+}
+
+// connections 连接表快照
+func (s *server) connections() []connectionInfo {
+	ct := s.mainState.ConnectionTable
+
+	ct.Lock.RLock()
+	out := make([]connectionInfo, 0, len(ct.Connection))
+	for nodeId, ioc := range ct.Connection {
+		ioc.ChannelsLock.RLock()
+		pending := len(ioc.Channels)
+		ioc.ChannelsLock.RUnlock()
+
+		out = append(out, connectionInfo{
+			NodeId:     hex.EncodeToString(nodeId[:]),
+			Addr:       ioc.Addr,
+			Outbound:   ioc.IsInitiator,
+			WriteQueue: len(ioc.WriteQueue),
+			Pending:    pending,
+		})
+	}
+	ct.Lock.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].NodeId < out[j].NodeId })
+	return out
+}
+
+// rounds 活跃轮次中的提案快照
+func (s *server) rounds() []roundInfo {
+	states := s.mainState.ProposalSate.Rounds()
+
+	out := make([]roundInfo, 0, len(states))
+	for _, rs := range states {
+		summaries := rs.Summaries()
+		info := roundInfo{Round: rs.Round, Proposals: make([]proposalInfo, 0, len(summaries))}
+		for _, p := range summaries {
+			proposer := blake3.Sum256(p.ProposerPubKey[:])
+			info.Proposals = append(info.Proposals, proposalInfo{
+				PHash:       hex.EncodeToString(p.PHash[:]),
+				Proposer:    hex.EncodeToString(proposer[:]),
+				Timestamp:   p.Timestamp,
+				PayloadSize: p.PayloadSize,
+				Signers:     p.Signers,
+				Score:       p.Score.Score,
+				LastScore:   p.Score.LastScore,
+			})
+		}
+		sort.Slice(info.Proposals, func(i, j int) bool { return info.Proposals[i].Score > info.Proposals[j].Score })
+		out = append(out, info)
+	}
+
+	return out
+}
+
+// peers 节点表，按信誉值降序
+func (s *server) peers(limit int) ([]peerInfo, error) {
+	query := s.mainState.DB.Order("reputation DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	peers := make([]table.Peer, 0)
+	if err := query.Find(&peers).Error; err != nil {
+		return nil, err
+	}
+
+	out := make([]peerInfo, 0, len(peers))
+	for _, p := range peers {
+		var nodeId [32]byte
+		copy(nodeId[:], p.NodeID)
+		addr, _ := db.BestAddress(s.mainState.DB, nodeId)
+		out = append(out, peerInfo{
+			NodeId:     hex.EncodeToString(p.NodeID),
+			Address:    addr,
+			Reputation: p.Reputation,
+			LastSeen:   p.LastSeen,
+			Status:     p.Status,
+		})
+	}
+
+	return out, nil
+}
+
+// bans 封禁列表，节点在前
+func (s *server) bans() []banInfo {
+	nodes := s.mainState.Bans.List()
+	ips := s.mainState.Bans.ListIPs()
+
+	out := make([]banInfo, 0, len(nodes)+len(ips))
+	for nodeId, ban := range nodes {
+		out = append(out, newBanInfo(banInfo{NodeId: hex.EncodeToString(nodeId[:])}, ban))
+	}
+	for ip, ban := range ips {
+		out = append(out, newBanInfo(banInfo{IP: ip.String()}, ban))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if (out[i].NodeId == "") != (out[j].NodeId == "") {
+			return out[i].NodeId != ""
+		}
+		return out[i].NodeId+out[i].IP < out[j].NodeId+out[j].IP
+	})
+
+	return out
+}
+
+// newBanInfo 填充封禁时间与原因
+func newBanInfo(info banInfo, ban models.Ban) banInfo {
+	if !ban.Until.IsZero() {
+		until := ban.Until
+		info.Until = &until
+	}
+	info.Reason = ban.Reason
+
+	return info
+}
+
+// runtimeStats 运行时统计
+func runtimeStats() runtimeInfo {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	return runtimeInfo{
+		Goroutines: runtime.NumGoroutine(),
+		HeapAlloc:  m.HeapAlloc,
+		NumGC:      m.NumGC,
+	}
+}
+
+// peerLimit 解析 limit 参数，0 表示全部
+func peerLimit(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultPeerLimit, nil
+	}
+
+	return strconv.Atoi(v)
+}
+
+// handleState 完整状态
+func (s *server) handleState(w http.ResponseWriter, r *http.Request) {
+	limit, err := peerLimit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	peers, err := s.peers(limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	nodeId := blake3.Sum256(s.mainState.Signer.PublicKey())
+	writeJSON(w, http.StatusOK, stateInfo{
+		NodeId:      hex.EncodeToString(nodeId[:]),
+		Connections: s.connections(),
+		Rounds:      s.rounds(),
+		Peers:       peers,
+		Bans:        s.bans(),
+		Runtime:     runtimeStats(),
+	})
+}
+
+// handleConnections 连接表
+func (s *server) handleConnections(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.connections())
+}
+
+// handleRounds 活跃轮次
+func (s *server) handleRounds(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.rounds())
+}
+
+// handlePeers 节点表
+func (s *server) handlePeers(w http.ResponseWriter, r *http.Request) {
+	limit, err := peerLimit(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	peers, err := s.peers(limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, peers)
+}
+
+// handleBans 封禁列表
+func (s *server) handleBans(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.bans())
+}
+
+// handleGoroutines 协程数量与按调用栈聚合的协程列表（文本）
+func (s *server) handleGoroutines(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_ = pprof.Lookup("goroutine").WriteTo(w, 1)
+}
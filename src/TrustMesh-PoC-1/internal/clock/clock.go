@@ -0,0 +1,74 @@
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Clock 时间来源，轮次时序、签名时间戳与协议超时都从这里读取
+// 节点运行时使用 System，模拟器注入虚拟时钟
+type Clock interface {
+	// Now 当前时间
+	Now() time.Time
+	// After 经过 d 之后向返回的通道发送当时的时间
+	After(d time.Duration) <-chan time.Time
+	// NewTimer 经过 d 之后向 C 发送当时的时间，循环中通过 Reset 复用
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer 可复用的定时器
+type Timer interface {
+	// C 到期时接收当时的时间
+	C() <-chan time.Time
+	// Reset 丢弃尚未接收的到期时间，改为从现在起经过 d 到期
+	Reset(d time.Duration)
+	// Stop 停止定时器，尚未接收的到期时间一并丢弃
+	Stop()
+}
+
+// System 系统时钟
+var System Clock = system{}
+
+// system 直接使用 time 包
+type system struct{}
+
+func (system) Now() time.Time { return time.Now() }
+
+func (system) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (system) NewTimer(d time.Duration) Timer { return systemTimer{time.NewTimer(d)} }
+
+// systemTimer 包装 time.Timer，Reset 与 Stop 会清空通道
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time { return t.t.C }
+
+func (t systemTimer) Reset(d time.Duration) { t.t.Reset(d) }
+
+func (t systemTimer) Stop() { t.t.Stop() }
+
+// Until 按 c 计算到 t 为止的时长
+func Until(c Clock, t time.Time) time.Duration {
+	return t.Sub(c.Now())
+}
+
+// WithTimeout 与 context.WithTimeout 相同，但超时按 c 计时
+// 超时后 context.Cause 返回 context.DeadlineExceeded
+func WithTimeout(parent context.Context, c Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	if c == System {
+		return context.WithTimeout(parent, d)
+	}
+
+	ctx, cancel := context.WithCancelCause(parent)
+	go func() {
+		select {
+		case <-c.After(d):
+			cancel(context.DeadlineExceeded)
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() { cancel(context.Canceled) }
+}
@@ -0,0 +1,419 @@
+package config
+
+import (
+	"TrustMesh-PoC-1/internal/constants"
+	"TrustMesh-PoC-1/internal/logger"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 运行模式
+const (
+	ModeNode      = "node"
+	ModeBootstrap = "bootstrap"
+)
+
+// Config 程序配置
+// 来源依次为：默认值、配置文件（TOML/YAML）、命令行参数、环境变量，后者覆盖前者
+type Config struct {
+	// 运行模式，由子命令决定，不从配置文件读取
+	Mode string `yaml:"-" toml:"-"`
+	// 数据目录，存放数据库、密钥与区块
+	DataDir string `yaml:"data_dir" toml:"data_dir"`
+	// 实例 ID，仅用于标识；未指定子命令时 "0" 表示引导节点（旧用法）
+	InstanceID string `yaml:"instance_id" toml:"instance_id"`
+
+	Log       LogConfig       `yaml:"log" toml:"log"`
+	Key       KeyConfig       `yaml:"key" toml:"key"`
+	Node      NodeConfig      `yaml:"node" toml:"node"`
+	Bootstrap BootstrapConfig `yaml:"bootstrap" toml:"bootstrap"`
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Consensus ConsensusConfig `yaml:"consensus" toml:"consensus"`
+	Metrics   MetricsConfig   `yaml:"metrics" toml:"metrics"`
+	Trace     TraceConfig     `yaml:"trace" toml:"trace"`
+	Admin     AdminConfig     `yaml:"admin" toml:"admin"`
+	Limits    LimitsConfig    `yaml:"limits" toml:"limits"`
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	// 输出 DEBUG 日志，未设置 Level 时生效
+	Debug bool `yaml:"debug" toml:"debug"`
+	// 输出 TEST 日志，未设置 Level 时生效
+	Test bool `yaml:"test" toml:"test"`
+	// 输出格式 text 或 json
+	Format string `yaml:"format" toml:"format"`
+	// 默认级别 test、debug、info、warning 或 error
+	Level string `yaml:"level" toml:"level"`
+	// 子系统级别，例如 p2p: debug
+	Levels map[string]string `yaml:"levels" toml:"levels"`
+}
+
+// KeyConfig 密钥文件配置
+type KeyConfig struct {
+	// 口令文件，设置后密钥文件加密保存
+	PassphraseFile string `yaml:"passphrase_file" toml:"passphrase_file"`
+	// 口令，只从环境变量 KEY_PASSPHRASE 读取
+	Passphrase string `yaml:"-" toml:"-"`
+	// 外部签名进程的 Unix 套接字，设置后不读取本地密钥文件
+	Signer string `yaml:"signer" toml:"signer"`
+}
+
+// NodeConfig 节点网络配置
+type NodeConfig struct {
+	// 监听端口
+	Port int `yaml:"port" toml:"port"`
+	// 对外地址，host:port 或 multiaddr
+	Host string `yaml:"host" toml:"host"`
+	// 额外的监听地址（multiaddr）
+	ListenAddrs []string `yaml:"listen_addrs" toml:"listen_addrs"`
+	// DHT 种子地址
+	DhtSeeds []string `yaml:"dht_seeds" toml:"dht_seeds"`
+	// 关闭期限（秒）
+	ShutdownTimeout int `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+// BootstrapConfig 节点侧的引导节点配置
+type BootstrapConfig struct {
+	// 引导节点地址，失败时依次切换
+	Addrs []string `yaml:"addrs" toml:"addrs"`
+	// 可信引导节点公钥（十六进制）
+	Keys []string `yaml:"keys" toml:"keys"`
+}
+
+// ServerConfig 引导节点服务配置
+type ServerConfig struct {
+	// 每次回复的邻居数量，也是拓扑的目标度数
+	Density int `yaml:"density" toml:"density"`
+	// 节点过期时间（秒）
+	NodeTTL int `yaml:"node_ttl" toml:"node_ttl"`
+	// 拓扑生成器
+	Topology string `yaml:"topology" toml:"topology"`
+	// small-world 重连概率
+	TopologyBeta float64 `yaml:"topology_beta" toml:"topology_beta"`
+	// clustered 簇数量
+	TopologyClusters int `yaml:"topology_clusters" toml:"topology_clusters"`
+	// clustered 相邻簇之间的桥数量
+	TopologyBridges int `yaml:"topology_bridges" toml:"topology_bridges"`
+}
+
+// ConsensusConfig 共识配置
+type ConsensusConfig struct {
+	// 轮次间隔（秒）
+	Interval int `yaml:"interval" toml:"interval"`
+	// 广播阈值
+	ScoreBurrs uint32 `yaml:"score_burrs" toml:"score_burrs"`
+	// 传播节点数量
+	DiffuseHop int `yaml:"diffuse_hop" toml:"diffuse_hop"`
+	// 给自己的评分
+	MyScore uint32 `yaml:"my_score" toml:"my_score"`
+	// 每轮保留的提案数上限
+	MaxProposals int `yaml:"max_proposals" toml:"max_proposals"`
+	// 提案载荷上限（字节）
+	MaxPayload int `yaml:"max_payload" toml:"max_payload"`
+	// 提案与签名集占用的内存上限（MiB）
+	MaxStoreMB int `yaml:"max_store_mb" toml:"max_store_mb"`
+	// 每条双重签名证据扣除的信誉值
+	EvidencePenalty uint32 `yaml:"evidence_penalty" toml:"evidence_penalty"`
+}
+
+// MetricsConfig 指标配置
+type MetricsConfig struct {
+	// Prometheus /metrics 监听地址，为空时不开启
+	Addr string `yaml:"addr" toml:"addr"`
+}
+
+// TraceConfig 提案传播追踪配置
+type TraceConfig struct {
+	// 开启追踪，提案消息携带追踪上下文，传播事件写入追踪文件
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// 追踪文件，相对路径位于数据目录下
+	File string `yaml:"file" toml:"file"`
+	// 共识状态机日志目录，每个轮次一个 <round>.jsonl，相对路径位于数据目录下，为空时不记录
+	Journal string `yaml:"journal" toml:"journal"`
+}
+
+// AdminConfig 管理接口配置
+type AdminConfig struct {
+	// 管理接口监听地址，为空时不开启
+	Addr string `yaml:"addr" toml:"addr"`
+	// 访问令牌，只从环境变量 ADMIN_TOKEN 读取
+	Token string `yaml:"-" toml:"-"`
+}
+
+// LimitsConfig 对端限速与封禁配置
+type LimitsConfig struct {
+	// 每个连接每秒的消息数
+	MsgRate int `yaml:"msg_rate" toml:"msg_rate"`
+	// 每个连接的消息突发量
+	MsgBurst int `yaml:"msg_burst" toml:"msg_burst"`
+	// 每个连接每秒的字节数
+	ByteRate int `yaml:"byte_rate" toml:"byte_rate"`
+	// 每个连接的字节突发量，不能小于单条消息的上限
+	ByteBurst int `yaml:"byte_burst" toml:"byte_burst"`
+	// 每个 IP 每分钟接受的连接数
+	AcceptRate int `yaml:"accept_rate" toml:"accept_rate"`
+	// 每个 IP 的连接突发量
+	AcceptBurst int `yaml:"accept_burst" toml:"accept_burst"`
+	// 每个邻居每分钟接受的双重签名证据数
+	EvidenceRate int `yaml:"evidence_rate" toml:"evidence_rate"`
+	// 每个邻居的证据突发量
+	EvidenceBurst int `yaml:"evidence_burst" toml:"evidence_burst"`
+	// 连接的违规分数达到该值时封禁对端
+	BanScore int `yaml:"ban_score" toml:"ban_score"`
+	// 违规封禁时长（秒）
+	BanDuration int `yaml:"ban_duration" toml:"ban_duration"`
+}
+
+// Default 默认配置
+func Default() Config {
+	return Config{
+		DataDir: constants.DefaultConfigDir,
+		Node: NodeConfig{
+			Port:            5776,
+			ShutdownTimeout: 15,
+		},
+		Server: ServerConfig{
+			NodeTTL:          180,
+			Topology:         "random",
+			TopologyBeta:     0.1,
+			TopologyClusters: 4,
+			TopologyBridges:  1,
+		},
+		Consensus: ConsensusConfig{
+			Interval:        30,
+			ScoreBurrs:      10,
+			DiffuseHop:      100,
+			MyScore:         5_000,
+			MaxProposals:    1024,
+			MaxPayload:      64 << 10,
+			MaxStoreMB:      256,
+			EvidencePenalty: 2_000,
+		},
+		Trace: TraceConfig{
+			File: "trace.jsonl",
+		},
+		// 模拟器中单个连接的峰值约为每个网络节点 3.4 条消息每秒、签名流量约 110·N² 字节每秒，
+		// 默认值可供约 250 个节点的网络全速传播，超出时只是延迟读取
+		Limits: LimitsConfig{
+			MsgRate:       1000,
+			MsgBurst:      2000,
+			ByteRate:      8 << 20,
+			ByteBurst:     16 << 20,
+			AcceptRate:    30,
+			AcceptBurst:   10,
+			EvidenceRate:  10,
+			EvidenceBurst: 20,
+			BanScore:      100,
+			BanDuration:   3600,
+		},
+	}
+}
+
+// IsBootstrap 是否以引导节点运行
+func (c *Config) IsBootstrap() bool {
+	return c.Mode == ModeBootstrap
+}
+
+// Validate 检查配置是否合法
+func (c *Config) Validate() error {
+	if c.DataDir == "" {
+		return errors.New("data_dir is empty")
+	}
+	if c.Mode != ModeNode && c.Mode != ModeBootstrap {
+		return fmt.Errorf("unknown mode %s", c.Mode)
+	}
+	if c.Log.Format != "" && c.Log.Format != logger.FormatText && c.Log.Format != logger.FormatJSON {
+		return fmt.Errorf("unknown log format %s", c.Log.Format)
+	}
+	if _, err := c.LogOptions(); err != nil {
+		return err
+	}
+	if c.Node.Port < 1 || c.Node.Port > 65535 {
+		return fmt.Errorf("invalid port %d", c.Node.Port)
+	}
+	if c.Node.ShutdownTimeout <= 0 {
+		return errors.New("shutdown_timeout must > 0")
+	}
+	if err := c.Limits.validate(); err != nil {
+		return err
+	}
+
+	if c.IsBootstrap() {
+		if c.Server.Density <= 0 {
+			return errors.New("density must > 0")
+		}
+		if c.Server.NodeTTL <= 0 {
+			return errors.New("node_ttl must > 0")
+		}
+		return nil
+	}
+
+	if len(c.Bootstrap.Addrs) > 0 && c.Node.Host == "" {
+		return errors.New("host is required when bootstrap is set")
+	}
+	if _, err := c.TrustedBootstrapKeys(); err != nil {
+		return err
+	}
+	if c.Consensus.Interval <= 0 {
+		return errors.New("interval must > 0")
+	}
+	if c.Consensus.DiffuseHop <= 0 {
+		return errors.New("diffuse_hop must > 0")
+	}
+	if c.Consensus.MyScore > 10_000 {
+		return errors.New("my_score must <= 10000")
+	}
+	if c.Consensus.MaxProposals <= 0 {
+		return errors.New("max_proposals must > 0")
+	}
+	if c.Consensus.MaxPayload <= 0 || c.Consensus.MaxPayload > constants.MaxPayloadSize {
+		return fmt.Errorf("max_payload must be in (0, %d]", constants.MaxPayloadSize)
+	}
+	if c.Consensus.MaxStoreMB <= 0 {
+		return errors.New("max_store_mb must > 0")
+	}
+	if c.Consensus.EvidencePenalty > 10_000 {
+		return errors.New("evidence_penalty must <= 10000")
+	}
+	if c.Trace.Enabled && c.Trace.File == "" {
+		return errors.New("trace file is empty")
+	}
+
+	return nil
+}
+
+// validate 检查限速与封禁配置
+func (l *LimitsConfig) validate() error {
+	if l.MsgRate <= 0 || l.MsgBurst <= 0 {
+		return errors.New("msg_rate and msg_burst must > 0")
+	}
+	if l.ByteRate <= 0 || l.ByteBurst < constants.MaxMessageSize {
+		return fmt.Errorf("byte_rate must > 0 and byte_burst must >= %d", constants.MaxMessageSize)
+	}
+	if l.AcceptRate <= 0 || l.AcceptBurst <= 0 {
+		return errors.New("accept_rate and accept_burst must > 0")
+	}
+	if l.EvidenceRate <= 0 || l.EvidenceBurst <= 0 {
+		return errors.New("evidence_rate and evidence_burst must > 0")
+	}
+	if l.BanScore <= 0 {
+		return errors.New("ban_score must > 0")
+	}
+	if l.BanDuration <= 0 {
+		return errors.New("ban_duration must > 0")
+	}
+
+	return nil
+}
+
+// TrustedBootstrapKeys 解析可信引导节点公钥
+func (c *Config) TrustedBootstrapKeys() ([][32]byte, error) {
+	out := make([][32]byte, 0, len(c.Bootstrap.Keys))
+	for _, v := range c.Bootstrap.Keys {
+		b, err := hex.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bootstrap key %s: %w", v, err)
+		}
+		if len(b) != 32 {
+			return nil, fmt.Errorf("invalid bootstrap key length %d", len(b))
+		}
+
+		var pk [32]byte
+		copy(pk[:], b)
+		out = append(out, pk)
+	}
+
+	return out, nil
+}
+
+// Interval 轮次间隔
+func (c *Config) Interval() time.Duration {
+	return time.Duration(c.Consensus.Interval) * time.Second
+}
+
+// ShutdownTimeout 关闭期限
+func (c *Config) ShutdownTimeout() time.Duration {
+	return time.Duration(c.Node.ShutdownTimeout) * time.Second
+}
+
+// NodeTTL 引导节点中的节点过期时间
+func (c *Config) NodeTTL() time.Duration {
+	return time.Duration(c.Server.NodeTTL) * time.Second
+}
+
+// TraceFile 追踪文件路径
+func (c *Config) TraceFile() string {
+	if filepath.IsAbs(c.Trace.File) {
+		return c.Trace.File
+	}
+	return filepath.Join(c.DataDir, c.Trace.File)
+}
+
+// JournalDir 共识状态机日志目录，未开启时为空
+func (c *Config) JournalDir() string {
+	if c.Trace.Journal == "" || filepath.IsAbs(c.Trace.Journal) {
+		return c.Trace.Journal
+	}
+	return filepath.Join(c.DataDir, c.Trace.Journal)
+}
+
+// LogOptions 日志配置转换为 logger 参数，输出位置为标准输出
+func (c *Config) LogOptions() (logger.Options, error) {
+	opts := logger.Options{
+		Format: c.Log.Format,
+		Level:  logger.LevelInfo,
+		Levels: make(map[string]slog.Level, len(c.Log.Levels)),
+	}
+
+	switch {
+	case c.Log.Level != "":
+		level, err := logger.ParseLevel(c.Log.Level)
+		if err != nil {
+			return logger.Options{}, err
+		}
+		opts.Level = level
+	case c.Log.Test:
+		opts.Level = logger.LevelTest
+	case c.Log.Debug:
+		opts.Level = logger.LevelDebug
+	}
+
+	for name, value := range c.Log.Levels {
+		level, err := logger.ParseLevel(value)
+		if err != nil {
+			return logger.Options{}, fmt.Errorf("log level of %s: %w", name, err)
+		}
+		opts.Levels[name] = level
+	}
+
+	return opts, nil
+}
+
+// KeyPassphrase 密钥文件口令，口令文件优先，未配置时返回 nil
+func (c *Config) KeyPassphrase() ([]byte, error) {
+	return ReadPassphrase(c.Key.PassphraseFile, c.Key.Passphrase)
+}
+
+// ReadPassphrase 从口令文件读取口令，文件为空时使用 fallback，去掉末尾换行
+func ReadPassphrase(file string, fallback string) ([]byte, error) {
+	pass := []byte(fallback)
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read passphrase file failed: %w", err)
+		}
+		pass = bytes.TrimRight(data, "\r\n")
+	}
+
+	if len(pass) == 0 {
+		return nil, nil
+	}
+	return pass, nil
+}
@@ -0,0 +1,238 @@
+package config
+
+import (
+	"TrustMesh-PoC-1/internal/logger"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// field 一个可由命令行参数与环境变量覆盖的配置项
+type field struct {
+	// 环境变量名，命令行参数名由其转换而来，例如 NODE_PORT → -node-port
+	env   string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+// fields 全部可覆盖的配置项
+var fields = []field{
+	{"DATA_DIR", "data directory", func(c *Config, v string) error { c.DataDir = v; return nil }},
+	{"INSTANCE_ID", "instance label", func(c *Config, v string) error { c.InstanceID = v; return nil }},
+	{"DEBUG_MODE", "output debug logs (true or other)", func(c *Config, v string) error { c.Log.Debug = v == "true"; return nil }},
+	{"TEST_MODE", "output test logs (true or other)", func(c *Config, v string) error { c.Log.Test = v == "true"; return nil }},
+	{"LOG_FORMAT", "log format, text or json", func(c *Config, v string) error { c.Log.Format = v; return nil }},
+	{"LOG_LEVEL", "default log level: test, debug, info, warning or error", func(c *Config, v string) error { c.Log.Level = v; return nil }},
+	{"LOG_LEVELS", "log levels per subsystem, e.g. p2p=debug,db=warning", func(c *Config, v string) error {
+		levels, err := logger.ParseLevels(v)
+		if err != nil {
+			return err
+		}
+		c.Log.Levels = make(map[string]string, len(levels))
+		for name, level := range levels {
+			c.Log.Levels[name] = strings.ToLower(logger.LevelName(level))
+		}
+		return nil
+	}},
+	{"KEY_PASSPHRASE_FILE", "passphrase file, the seed file is encrypted when set", func(c *Config, v string) error { c.Key.PassphraseFile = v; return nil }},
+	{"KEY_SIGNER", "unix socket of an external signer, the seed file is not read when set", func(c *Config, v string) error { c.Key.Signer = v; return nil }},
+	{"NODE_PORT", "listen port", setInt(func(c *Config) *int { return &c.Node.Port })},
+	{"HOST", "advertised address, host:port or multiaddr", func(c *Config, v string) error { c.Node.Host = v; return nil }},
+	{"LISTEN_ADDRS", "extra listen multiaddrs, separated by ','", setList(func(c *Config) *[]string { return &c.Node.ListenAddrs })},
+	{"DHT_SEEDS", "dht seed addresses, separated by ','", setList(func(c *Config) *[]string { return &c.Node.DhtSeeds })},
+	{"SHUTDOWN_TIMEOUT", "shutdown deadline (second)", setInt(func(c *Config) *int { return &c.Node.ShutdownTimeout })},
+	{"BOOTSTRAP", "bootstrap addresses, separated by ','", setList(func(c *Config) *[]string { return &c.Bootstrap.Addrs })},
+	{"BOOTSTRAP_KEYS", "trusted bootstrap public keys in hex, separated by ','", setList(func(c *Config) *[]string { return &c.Bootstrap.Keys })},
+	{"DENSITY", "neighbours per bootstrap reply", setInt(func(c *Config) *int { return &c.Server.Density })},
+	{"NODE_TTL", "bootstrap node expiry (second)", setInt(func(c *Config) *int { return &c.Server.NodeTTL })},
+	{"TOPOLOGY", "bootstrap topology generator", func(c *Config, v string) error { c.Server.Topology = v; return nil }},
+	{"TOPOLOGY_BETA", "small-world rewiring probability", func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return errors.New("not a number")
+		}
+		c.Server.TopologyBeta = f
+		return nil
+	}},
+	{"TOPOLOGY_CLUSTERS", "clustered topology cluster count", setInt(func(c *Config) *int { return &c.Server.TopologyClusters })},
+	{"TOPOLOGY_BRIDGES", "clustered topology bridges between clusters", setInt(func(c *Config) *int { return &c.Server.TopologyBridges })},
+	{"INTERVAL", "round interval (second)", setInt(func(c *Config) *int { return &c.Consensus.Interval })},
+	{"SCORE_BURRS", "score change that triggers a broadcast", setUint32(func(c *Config) *uint32 { return &c.Consensus.ScoreBurrs })},
+	{"DIFFUSE_HOP", "peers per proposal broadcast", setInt(func(c *Config) *int { return &c.Consensus.DiffuseHop })},
+	{"MY_SCORE", "score given to own proposal", setUint32(func(c *Config) *uint32 { return &c.Consensus.MyScore })},
+	{"MAX_PROPOSALS", "proposals kept per round", setInt(func(c *Config) *int { return &c.Consensus.MaxProposals })},
+	{"MAX_PAYLOAD", "proposal payload limit (byte)", setInt(func(c *Config) *int { return &c.Consensus.MaxPayload })},
+	{"MAX_STORE_MB", "memory limit of proposals and signatures (MiB)", setInt(func(c *Config) *int { return &c.Consensus.MaxStoreMB })},
+	{"EVIDENCE_PENALTY", "reputation removed per equivocation evidence", setUint32(func(c *Config) *uint32 { return &c.Consensus.EvidencePenalty })},
+	{"METRICS_ADDR", "listen address of the prometheus /metrics endpoint, empty to disable", func(c *Config, v string) error { c.Metrics.Addr = v; return nil }},
+	{"ADMIN_ADDR", "listen address of the admin api, empty to disable", func(c *Config, v string) error { c.Admin.Addr = v; return nil }},
+	{"TRACE", "trace proposal propagation (true or other)", func(c *Config, v string) error { c.Trace.Enabled = v == "true"; return nil }},
+	{"TRACE_FILE", "trace file, relative to the data directory", func(c *Config, v string) error { c.Trace.File = v; return nil }},
+	{"TRACE_JOURNAL", "consensus journal directory, relative to the data directory", func(c *Config, v string) error { c.Trace.Journal = v; return nil }},
+	{"LIMIT_MSG_RATE", "messages per second per connection", setInt(func(c *Config) *int { return &c.Limits.MsgRate })},
+	{"LIMIT_MSG_BURST", "message burst per connection", setInt(func(c *Config) *int { return &c.Limits.MsgBurst })},
+	{"LIMIT_BYTE_RATE", "bytes per second per connection", setInt(func(c *Config) *int { return &c.Limits.ByteRate })},
+	{"LIMIT_BYTE_BURST", "byte burst per connection", setInt(func(c *Config) *int { return &c.Limits.ByteBurst })},
+	{"LIMIT_ACCEPT_RATE", "inbound connections per minute per ip", setInt(func(c *Config) *int { return &c.Limits.AcceptRate })},
+	{"LIMIT_ACCEPT_BURST", "inbound connection burst per ip", setInt(func(c *Config) *int { return &c.Limits.AcceptBurst })},
+	{"LIMIT_EVIDENCE_RATE", "evidence messages per minute per neighbour", setInt(func(c *Config) *int { return &c.Limits.EvidenceRate })},
+	{"LIMIT_EVIDENCE_BURST", "evidence message burst per neighbour", setInt(func(c *Config) *int { return &c.Limits.EvidenceBurst })},
+	{"BAN_SCORE", "misbehaviour score that bans a peer", setInt(func(c *Config) *int { return &c.Limits.BanScore })},
+	{"BAN_DURATION", "misbehaviour ban duration (second)", setInt(func(c *Config) *int { return &c.Limits.BanDuration })},
+}
+
+// flagName 环境变量名转为命令行参数名
+func flagName(env string) string {
+	return strings.ToLower(strings.ReplaceAll(env, "_", "-"))
+}
+
+// setInt 整数配置项
+func setInt(ptr func(c *Config) *int) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.New("not a number")
+		}
+		*ptr(c) = i
+		return nil
+	}
+}
+
+// setUint32 无符号整数配置项
+func setUint32(ptr func(c *Config) *uint32) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		i, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return errors.New("not a number")
+		}
+		*ptr(c) = uint32(i)
+		return nil
+	}
+}
+
+// setList 逗号分隔的列表配置项
+func setList(ptr func(c *Config) *[]string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		var out []string
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+		*ptr(c) = out
+		return nil
+	}
+}
+
+// Flags 注册到 FlagSet 上的配置参数
+type Flags struct {
+	fs     *flag.FlagSet
+	path   *string
+	values map[string]string
+}
+
+// RegisterFlags 在 fs 上注册 -config 与全部配置项参数
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{
+		fs:     fs,
+		path:   fs.String("config", os.Getenv("CONFIG"), "config file (.toml, .yaml or .yml), env CONFIG"),
+		values: make(map[string]string),
+	}
+
+	for _, fd := range fields {
+		env := fd.env
+		fs.Func(flagName(env), fd.usage+", env "+env, func(v string) error {
+			f.values[env] = v
+			return nil
+		})
+	}
+
+	return f
+}
+
+// Load 在 fs 解析完成后按优先级合并配置并校验
+// mode 为空时按旧用法由 INSTANCE_ID 决定，"0" 为引导节点
+func (f *Flags) Load(mode string) (*Config, error) {
+	if !f.fs.Parsed() {
+		return nil, errors.New("flags are not parsed")
+	}
+
+	cfg := Default()
+
+	// 配置文件
+	if *f.path != "" {
+		if err := loadFile(&cfg, *f.path); err != nil {
+			return nil, err
+		}
+	}
+
+	// 命令行参数
+	for _, fd := range fields {
+		if v, ok := f.values[fd.env]; ok {
+			if err := fd.set(&cfg, v); err != nil {
+				return nil, fmt.Errorf("invalid -%s: %w", flagName(fd.env), err)
+			}
+		}
+	}
+
+	// 环境变量
+	for _, fd := range fields {
+		if v, ok := os.LookupEnv(fd.env); ok {
+			if err := fd.set(&cfg, v); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", fd.env, err)
+			}
+		}
+	}
+
+	// 口令与令牌只从环境变量读取，不提供命令行参数以免出现在进程列表中
+	if v, ok := os.LookupEnv("KEY_PASSPHRASE"); ok {
+		cfg.Key.Passphrase = v
+	}
+	if v, ok := os.LookupEnv("ADMIN_TOKEN"); ok {
+		cfg.Admin.Token = v
+	}
+
+	cfg.Mode = mode
+	if cfg.Mode == "" {
+		cfg.Mode = ModeNode
+		if cfg.InstanceID == "0" {
+			cfg.Mode = ModeBootstrap
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// loadFile 按扩展名读取 TOML 或 YAML 配置文件，文件中未出现的项保留原值
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file failed: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		if _, err := toml.Decode(string(data), cfg); err != nil {
+			return fmt.Errorf("parse config file failed: %w", err)
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return fmt.Errorf("parse config file failed: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown config file format %s", path)
+	}
+
+	return nil
+}
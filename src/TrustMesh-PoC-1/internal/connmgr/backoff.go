@@ -0,0 +1,91 @@
+package connmgr
+
+import (
+	"TrustMesh-PoC-1/internal/clock"
+	"sync"
+	"time"
+)
+
+// backoffState 单个地址的失败记录
+type backoffState struct {
+	failures int
+	next     time.Time
+}
+
+// backoff 按地址记录拨号失败并计算指数退避
+type backoff struct {
+	mu   sync.Mutex
+	base time.Duration
+	max  time.Duration
+	data map[string]*backoffState
+	// 计算等待期的时间来源
+	clock clock.Clock
+}
+
+// newBackoff 初始化退避表
+func newBackoff(c clock.Clock, base time.Duration, max time.Duration) *backoff {
+	return &backoff{
+		base:  base,
+		max:   max,
+		data:  make(map[string]*backoffState),
+		clock: c,
+	}
+}
+
+// allow 当前是否允许拨号该地址
+func (b *backoff) allow(addr string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.data[addr]
+	if !ok {
+		return true
+	}
+
+	return !b.clock.Now().Before(s.next)
+}
+
+// failure 记录一次失败，等待时间为 base * 2^(failures-1)，不超过 max
+func (b *backoff) failure(addr string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.data[addr]
+	if !ok {
+		s = &backoffState{}
+		b.data[addr] = s
+	}
+	s.failures++
+
+	wait := b.base
+	for i := 1; i < s.failures && wait < b.max; i++ {
+		wait *= 2
+	}
+	if wait > b.max {
+		wait = b.max
+	}
+	s.next = b.clock.Now().Add(wait)
+
+	return wait
+}
+
+// success 拨号成功后清除失败记录
+func (b *backoff) success(addr string) {
+	b.mu.Lock()
+	delete(b.data, addr)
+	b.mu.Unlock()
+}
+
+// prune 清除过期的失败记录
+// 等待期结束后再经过 max 仍未再次失败的地址视为已恢复，保留这段时间是为了让连续失败的退避能够增长
+func (b *backoff) prune() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	for addr, s := range b.data {
+		if now.After(s.next.Add(b.max)) {
+			delete(b.data, addr)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package connmgr
+
+import (
+	"TrustMesh-PoC-1/internal/clock"
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/maddr"
+	"TrustMesh-PoC-1/internal/models"
+	"TrustMesh-PoC-1/internal/p2p"
+	"TrustMesh-PoC-1/internal/table"
+	"TrustMesh-PoC-1/internal/tools"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 默认参数
+const (
+	// DefaultTargetOutbound 长期保持的出站连接数量
+	DefaultTargetOutbound = 8
+	// DefaultMaxOutbound 出站连接上限
+	DefaultMaxOutbound = 128
+	// DefaultMaxInbound 入站连接上限
+	DefaultMaxInbound = 128
+	// DefaultBackoffBase 初始退避时间
+	DefaultBackoffBase = 1 * time.Second
+	// DefaultBackoffMax 最大退避时间
+	DefaultBackoffMax = 5 * time.Minute
+
+	// maintainInterval 出站连接维护间隔
+	maintainInterval = 10 * time.Second
+	// dialTimeout TCP 拨号超时
+	dialTimeout = 3 * time.Second
+	// handshakeTimeout 握手超时
+	handshakeTimeout = 5 * time.Second
+	// sendTimeout 写队列阻塞超时
+	sendTimeout = 3 * time.Second
+	// drainPoll 关闭时检查写队列的间隔
+	drainPoll = 50 * time.Millisecond
+)
+
+// 错误
+var (
+	ErrBackoff       = errors.New("address is in backoff")
+	ErrOutboundLimit = errors.New("outbound connection limit reached")
+	ErrConnClosed    = errors.New("connection is closed")
+	ErrQueueFull     = errors.New("write queue is full")
+	ErrBanned        = errors.New("node is banned")
+)
+
+// Options 连接管理参数
+type Options struct {
+	TargetOutbound int
+	MaxOutbound    int
+	MaxInbound     int
+	BackoffBase    time.Duration
+	BackoffMax     time.Duration
+	// Dial 按地址拨号，为 nil 时使用 maddr.DialContext
+	Dial func(ctx context.Context, addr string) (net.Conn, error)
+}
+
+// DefaultOptions 默认连接管理参数
+func DefaultOptions() Options {
+	return Options{
+		TargetOutbound: DefaultTargetOutbound,
+		MaxOutbound:    DefaultMaxOutbound,
+		MaxInbound:     DefaultMaxInbound,
+		BackoffBase:    DefaultBackoffBase,
+		BackoffMax:     DefaultBackoffMax,
+	}
+}
+
+// ConnManager 连接管理器，所有发送方都通过它获取连接
+type ConnManager struct {
+	// 连接的生命周期，取消时全部连接关闭
+	ctx       context.Context
+	mainState *models.MainStore
+	opt       Options
+	backoff   *backoff
+
+	inbound  atomic.Int32
+	outbound atomic.Int32
+
+	// 正在拨号的节点，避免并发重复拨号
+	dialingLock sync.Mutex
+	dialing     map[[32]byte]chan struct{}
+}
+
+// New 创建连接管理器，超时与退避按 mainState.Clock 计时
+func New(ctx context.Context, mainState *models.MainStore, opt Options) *ConnManager {
+	if opt.Dial == nil {
+		opt.Dial = maddr.DialContext
+	}
+
+	return &ConnManager{
+		ctx:       ctx,
+		mainState: mainState,
+		opt:       opt,
+		backoff:   newBackoff(mainState.Clock, opt.BackoffBase, opt.BackoffMax),
+		dialing:   make(map[[32]byte]chan struct{}),
+	}
+}
+
+// lookup 查找仍然存活的已有连接
+func (m *ConnManager) lookup(nodeId [32]byte) (*models.IOChannel, bool) {
+	ct := m.mainState.ConnectionTable
+
+	ct.Lock.RLock()
+	ioc, exists := ct.Connection[nodeId]
+	ct.Lock.RUnlock()
+
+	if !exists {
+		return nil, false
+	}
+
+	select {
+	case <-ioc.Ctx.Done():
+		return nil, false
+	default:
+		return ioc, true
+	}
+}
+
+// Acquire 获取到指定节点的连接，不存在时拨号建立
+// ctx 只约束拨号过程，建立的连接归连接管理器所有
+func (m *ConnManager) Acquire(ctx context.Context, nodeId [32]byte) (*models.IOChannel, error) {
+	if ioc, ok := m.lookup(nodeId); ok {
+		return ioc, nil
+	}
+	if m.mainState.Bans.IsBanned(nodeId) {
+		return nil, ErrBanned
+	}
+
+	// 合并对同一节点的并发拨号
+	m.dialingLock.Lock()
+	if wait, ok := m.dialing[nodeId]; ok {
+		m.dialingLock.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if ioc, ok := m.lookup(nodeId); ok {
+			return ioc, nil
+		}
+		return nil, ErrConnClosed
+	}
+	wait := make(chan struct{})
+	m.dialing[nodeId] = wait
+	m.dialingLock.Unlock()
+
+	defer func() {
+		m.dialingLock.Lock()
+		delete(m.dialing, nodeId)
+		m.dialingLock.Unlock()
+		close(wait)
+	}()
+
+	return m.dial(ctx, nodeId)
+}
+
+// Send 向指定节点发送消息
+func (m *ConnManager) Send(nodeId [32]byte, message []byte) error {
+	ioc, err := m.Acquire(m.ctx, nodeId)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := clock.WithTimeout(m.ctx, m.mainState.Clock, sendTimeout)
+	defer cancel()
+
+	select {
+	case <-ioc.Ctx.Done():
+		return ErrConnClosed
+	case ioc.WriteQueue <- message:
+		return nil
+	case <-ctx.Done():
+		return ErrQueueFull
+	}
+}
+
+// Connect 按地址建立连接，返回对方 NodeId
+// expect 不为零值时对方 NodeId 必须与之吻合，否则关闭连接；拨号与握手受 ctx 约束
+func (m *ConnManager) Connect(ctx context.Context, addr string, expect [32]byte) ([32]byte, error) {
+	nodeId, _, err := m.dialAddr(ctx, addr, expect)
+	return nodeId, err
+}
+
+// Probe 拨号并完成一次握手后立即断开，返回对方 NodeId
+// 只用于验证地址，不写入连接表也不占用出站连接数
+func (m *ConnManager) Probe(ctx context.Context, addr string) ([32]byte, error) {
+	if !tools.IsValidForDial(addr) {
+		return [32]byte{}, fmt.Errorf("the address [%v] is not valid for dial", addr)
+	}
+	if !m.backoff.allow(addr) {
+		return [32]byte{}, ErrBackoff
+	}
+
+	dialCtx, cancelDial := clock.WithTimeout(ctx, m.mainState.Clock, dialTimeout)
+	conn, err := m.opt.Dial(dialCtx, addr)
+	cancelDial()
+	if err != nil {
+		if ctx.Err() == nil {
+			m.backoff.failure(addr)
+		}
+		return [32]byte{}, err
+	}
+
+	nodeId, err := p2p.ProbeConn(conn, m.mainState.Signer, m.mainState.Clock, handshakeTimeout)
+	if err != nil {
+		m.backoff.failure(addr)
+		return [32]byte{}, err
+	}
+
+	return nodeId, nil
+}
+
+// Accept 接管入站连接，超出上限时直接关闭
+func (m *ConnManager) Accept(conn net.Conn) {
+	if int(m.inbound.Add(1)) > m.opt.MaxInbound {
+		m.inbound.Add(-1)
+		logger.Debug("Inbound limit reached, refuse: %v", conn.RemoteAddr())
+		if err := conn.Close(); err != nil {
+			logger.Warning("Close Connection Error: %v", err)
+		}
+		return
+	}
+	defer m.inbound.Add(-1)
+
+	p2p.HandleConnection(m.ctx, conn, m.mainState, make(chan [32]byte, 1), false)
+}
+
+// Run 维护长期出站连接，阻塞运行直到 ctx 取消
+func (m *ConnManager) Run(ctx context.Context) {
+	for {
+		m.maintain(ctx)
+
+		select {
+		case <-m.mainState.Clock.After(maintainInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close 等待各连接写队列清空后关闭全部连接，ctx 到期时直接关闭
+func (m *ConnManager) Close(ctx context.Context) {
+	ct := m.mainState.ConnectionTable
+
+	ct.Lock.RLock()
+	iocs := make([]*models.IOChannel, 0, len(ct.Connection))
+	for _, ioc := range ct.Connection {
+		iocs = append(iocs, ioc)
+	}
+	ct.Lock.RUnlock()
+
+	clk := m.mainState.Clock
+
+	for _, ioc := range iocs {
+	drain:
+		for len(ioc.WriteQueue) > 0 {
+			select {
+			case <-ioc.Ctx.Done():
+				break drain
+			case <-ctx.Done():
+				break drain
+			case <-clk.After(drainPoll):
+			}
+		}
+
+		ioc.Cancel()
+	}
+
+	// 等待连接从表中移除
+	for {
+		ct.Lock.RLock()
+		remain := len(ct.Connection)
+		ct.Lock.RUnlock()
+		if remain == 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Warning("Close connections timeout, %v remaining", remain)
+			return
+		case <-clk.After(drainPoll):
+		}
+	}
+}
+
+// maintain 从节点表中随机挑选节点补足出站连接
+func (m *ConnManager) maintain(ctx context.Context) {
+	m.backoff.prune()
+
+	need := m.opt.TargetOutbound - int(m.outbound.Load())
+	if need <= 0 {
+		return
+	}
+
+	peers := make([]table.Peer, 0)
+	err := m.mainState.DB.
+		Select("node_id").
+		Order("RANDOM()").
+		Limit(need * 2).
+		Find(&peers).Error
+	if err != nil {
+		logger.Error("Failed to find peers: %v", err)
+		return
+	}
+
+	for _, peer := range peers {
+		if need <= 0 {
+			return
+		}
+		if len(peer.NodeID) != 32 {
+			continue
+		}
+
+		var nodeId [32]byte
+		copy(nodeId[:], peer.NodeID)
+
+		if _, ok := m.lookup(nodeId); ok {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := m.Acquire(ctx, nodeId); err != nil {
+			logger.Test("Maintain outbound %v failed: %v", nodeId, err)
+			continue
+		}
+		need--
+	}
+}
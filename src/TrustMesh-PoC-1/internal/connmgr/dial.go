@@ -0,0 +1,119 @@
+package connmgr
+
+import (
+	"TrustMesh-PoC-1/internal/clock"
+	"TrustMesh-PoC-1/internal/db"
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/models"
+	"TrustMesh-PoC-1/internal/p2p"
+	"TrustMesh-PoC-1/internal/tools"
+	"context"
+	"fmt"
+)
+
+// dial 按最近成功时间依次拨号指定节点的各个地址
+func (m *ConnManager) dial(ctx context.Context, nodeId [32]byte) (*models.IOChannel, error) {
+	database := m.mainState.DB
+
+	// 根据节点 ID 查询对方地址
+	addrs, err := db.PeerAddresses(database, nodeId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find address: %w", err)
+	}
+
+	var lastErr error
+	for _, addr := range addrs {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		_, ioc, err := m.dialAddr(ctx, addr, nodeId)
+
+		// 退避、连接数上限与重复连接竞争不是地址本身的问题，不计入统计
+		if err != ErrBackoff && err != ErrOutboundLimit && err != ErrConnClosed && ctx.Err() == nil {
+			if recErr := db.RecordDial(database, nodeId, addr, err == nil); recErr != nil {
+				logger.Error("Failed to record dial result: %v", recErr)
+			}
+		}
+
+		if err == nil {
+			return ioc, nil
+		}
+		if err == ErrOutboundLimit {
+			return nil, err
+		}
+
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// dialAddr 拨号指定地址并等待握手完成
+// expect 不为零值时对方 ID 必须与之吻合，否则关闭连接
+// 拨号与握手受 ctx 约束，连接本身的生命周期属于连接管理器
+func (m *ConnManager) dialAddr(ctx context.Context, addr string, expect [32]byte) ([32]byte, *models.IOChannel, error) {
+	// 检查地址是否有效
+	if !tools.IsValidForDial(addr) {
+		return [32]byte{}, nil, fmt.Errorf("the address [%v] is not valid for dial", addr)
+	}
+	if !m.backoff.allow(addr) {
+		return [32]byte{}, nil, ErrBackoff
+	}
+	if int(m.outbound.Load()) >= m.opt.MaxOutbound {
+		return [32]byte{}, nil, ErrOutboundLimit
+	}
+
+	// 连接
+	dialCtx, cancelDial := clock.WithTimeout(ctx, m.mainState.Clock, dialTimeout)
+	rawConn, err := m.opt.Dial(dialCtx, addr)
+	cancelDial()
+	if err != nil {
+		// 调用方取消不计入退避
+		if ctx.Err() != nil {
+			return [32]byte{}, nil, ctx.Err()
+		}
+		wait := m.backoff.failure(addr)
+		logger.Debug("Dial %v failed, retry after %v: %v", addr, wait, err)
+		return [32]byte{}, nil, err
+	}
+
+	// 将连接移交给管理函数
+	ready := make(chan [32]byte, 1)
+	m.outbound.Add(1)
+	go func() {
+		defer m.outbound.Add(-1)
+		p2p.HandleConnection(m.ctx, rawConn, m.mainState, ready, true)
+	}()
+
+	// 等待握手完毕
+	waitCtx, cancelWait := clock.WithTimeout(ctx, m.mainState.Clock, handshakeTimeout)
+	defer cancelWait()
+
+	select {
+	case realId := <-ready:
+		// 检查对方 ID 和指定 ID 是否吻合
+		if expect != ([32]byte{}) && realId != expect {
+			if err := rawConn.Close(); err != nil {
+				logger.Warning("Close Connection Error: %v", err)
+			}
+			m.backoff.failure(addr)
+			return realId, nil, fmt.Errorf("the node id is incorrect: %v", realId)
+		}
+		m.backoff.success(addr)
+
+		// 重复连接时表中为胜出的连接
+		ioc, ok := m.lookup(realId)
+		if !ok {
+			return realId, nil, ErrConnClosed
+		}
+
+		return realId, ioc, nil
+	case <-waitCtx.Done():
+		if ctx.Err() != nil {
+			return [32]byte{}, nil, ctx.Err()
+		}
+		wait := m.backoff.failure(addr)
+		logger.Debug("Handshake with %v timeout, retry after %v", addr, wait)
+		return [32]byte{}, nil, fmt.Errorf("handshake with %v timeout", addr)
+	}
+}
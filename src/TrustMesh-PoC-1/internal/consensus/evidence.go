@@ -0,0 +1,279 @@
+package consensus
+
+import (
+	"TrustMesh-PoC-1/internal/db"
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/metrics"
+	"TrustMesh-PoC-1/internal/models"
+	"TrustMesh-PoC-1/internal/p2p"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+// 证据类型
+const (
+	// EvidenceProposal 提案者在同一轮次签名了两个不同的提案
+	EvidenceProposal uint8 = 1
+	// EvidenceRating 打分者对同一提案签名了互相矛盾的分数
+	EvidenceRating uint8 = 2
+)
+
+// signedVoteSize 证据中一条签名消息的长度，证据整体长度见 p2p.EvidenceSize
+const signedVoteSize = 32 + 4 + 8 + 64
+
+// EvidenceRoundWindow 只接受与当前轮次相差不超过该值的证据
+const EvidenceRoundWindow = 16
+
+// 证据校验错误
+var (
+	// ErrEvidenceMalformed 证据格式错误
+	ErrEvidenceMalformed = errors.New("malformed evidence")
+	// ErrEvidenceNoConflict 两条签名消息并不矛盾
+	ErrEvidenceNoConflict = errors.New("evidence messages do not conflict")
+	// ErrEvidenceSignature 证据中的签名无效
+	ErrEvidenceSignature = errors.New("invalid evidence signature")
+	// ErrEvidenceRound 证据的轮次不在当前轮次附近
+	ErrEvidenceRound = errors.New("evidence round out of window")
+	// ErrEvidenceUnknown 违规者不在节点表中
+	ErrEvidenceUnknown = errors.New("evidence offender is not a known peer")
+	// ErrEvidenceRateLimited 发送方的证据超出限速
+	ErrEvidenceRateLimited = errors.New("evidence rate limited")
+)
+
+// SignedVote 证据中的一条签名消息，提案签名不使用分数与时间戳
+type SignedVote struct {
+	PHash     [32]byte
+	Score     uint32
+	Timestamp uint64
+	Sig       [64]byte
+}
+
+// Evidence 双重签名证据，包含两条由同一公钥签名且互相冲突的消息，无需其他数据即可校验
+type Evidence struct {
+	Kind  uint8
+	PK    [32]byte
+	Round int64
+	Votes [2]SignedVote
+}
+
+// NewProposalEvidence 构建双重提案证据
+func NewProposalEvidence(round int64, pk [32]byte, pHashA [32]byte, sigA [64]byte, pHashB [32]byte, sigB [64]byte) Evidence {
+	return Evidence{
+		Kind:  EvidenceProposal,
+		PK:    pk,
+		Round: round,
+		Votes: [2]SignedVote{
+			{PHash: pHashA, Sig: sigA},
+			{PHash: pHashB, Sig: sigB},
+		},
+	}
+}
+
+// NewRatingEvidence 构建矛盾打分证据
+func NewRatingEvidence(round int64, pHash [32]byte, a models.Attestation, b models.Attestation) Evidence {
+	return Evidence{
+		Kind:  EvidenceRating,
+		PK:    a.SignerPubKey,
+		Round: round,
+		Votes: [2]SignedVote{
+			{PHash: pHash, Score: a.Score, Timestamp: a.Timestamp, Sig: a.Signature},
+			{PHash: pHash, Score: b.Score, Timestamp: b.Timestamp, Sig: b.Signature},
+		},
+	}
+}
+
+// KindName 证据类型名称，用于证据表与指标标签
+func (e Evidence) KindName() string {
+	switch e.Kind {
+	case EvidenceProposal:
+		return "proposal"
+	case EvidenceRating:
+		return "rating"
+	default:
+		return "unknown"
+	}
+}
+
+// Offender 违规者 NodeId
+func (e Evidence) Offender() [32]byte {
+	return blake3.Sum256(e.PK[:])
+}
+
+// Encode 编码证据
+func (e Evidence) Encode() [p2p.EvidenceSize]byte {
+	var out [p2p.EvidenceSize]byte
+	out[0] = e.Kind
+	copy(out[1:33], e.PK[:])
+	binary.BigEndian.PutUint64(out[33:41], uint64(e.Round))
+
+	idx := 41
+	for _, v := range e.Votes {
+		copy(out[idx:idx+32], v.PHash[:])
+		binary.BigEndian.PutUint32(out[idx+32:idx+36], v.Score)
+		binary.BigEndian.PutUint64(out[idx+36:idx+44], v.Timestamp)
+		copy(out[idx+44:idx+108], v.Sig[:])
+		idx += signedVoteSize
+	}
+
+	return out
+}
+
+// DecodeEvidence 解码证据
+func DecodeEvidence(b []byte) (Evidence, error) {
+	if len(b) != p2p.EvidenceSize {
+		return Evidence{}, ErrEvidenceMalformed
+	}
+
+	var e Evidence
+	e.Kind = b[0]
+	copy(e.PK[:], b[1:33])
+	e.Round = int64(binary.BigEndian.Uint64(b[33:41]))
+
+	idx := 41
+	for i := range e.Votes {
+		copy(e.Votes[i].PHash[:], b[idx:idx+32])
+		e.Votes[i].Score = binary.BigEndian.Uint32(b[idx+32 : idx+36])
+		e.Votes[i].Timestamp = binary.BigEndian.Uint64(b[idx+36 : idx+44])
+		copy(e.Votes[i].Sig[:], b[idx+44:idx+108])
+		idx += signedVoteSize
+	}
+
+	return e, nil
+}
+
+// Verify 校验两条消息确实矛盾且都由证据中的公钥签名
+func (e Evidence) Verify() error {
+	a, b := e.Votes[0], e.Votes[1]
+
+	switch e.Kind {
+	case EvidenceProposal:
+		if a.PHash == b.PHash {
+			return ErrEvidenceNoConflict
+		}
+	case EvidenceRating:
+		if a.PHash != b.PHash {
+			return ErrEvidenceMalformed
+		}
+		x := models.Attestation{Score: a.Score, Timestamp: a.Timestamp}
+		y := models.Attestation{Score: b.Score, Timestamp: b.Timestamp}
+		if !x.Conflicts(y) {
+			return ErrEvidenceNoConflict
+		}
+	default:
+		return ErrEvidenceMalformed
+	}
+
+	for _, v := range e.Votes {
+		digest := e.signedDigest(v)
+		if !ed25519.Verify(e.PK[:], digest[:], v.Sig[:]) {
+			return ErrEvidenceSignature
+		}
+	}
+
+	return nil
+}
+
+// signedDigest 一条消息的签名内容，与提案签名和打分签名的构建方式一致
+func (e Evidence) signedDigest(v SignedVote) [32]byte {
+	data := make([]byte, 0, 4+8+32+4+8)
+	if e.Kind == EvidenceProposal {
+		data = binary.BigEndian.AppendUint32(data, PROPOSERV1Domain)
+		data = binary.BigEndian.AppendUint64(data, uint64(e.Round))
+		data = append(data, v.PHash[:]...)
+	} else {
+		data = binary.BigEndian.AppendUint32(data, RATEV1Domain)
+		data = binary.BigEndian.AppendUint64(data, uint64(e.Round))
+		data = append(data, v.PHash[:]...)
+		data = binary.BigEndian.AppendUint32(data, v.Score)
+		data = binary.BigEndian.AppendUint64(data, v.Timestamp)
+	}
+
+	return blake3.Sum256(data)
+}
+
+// buildEvidenceMessage 构建证据消息
+// 格式：[4]header + [4]长度 + 证据
+func buildEvidenceMessage(e Evidence) []byte {
+	body := e.Encode()
+
+	message := make([]byte, 0, 4+4+p2p.EvidenceSize)
+	message = binary.BigEndian.AppendUint32(message, p2p.MsgEvidence)
+	message = binary.BigEndian.AppendUint32(message, p2p.EvidenceSize)
+	message = append(message, body[:]...)
+
+	return message
+}
+
+// SubmitEvidence 校验证据，首次见到该违规者在该轮次的此类证据时扣除其信誉并转发给除 from 以外的所有邻居
+// 本节点发现的证据 from 为零值，不受限速；轮次不在当前轮次附近或违规者不在节点表中的证据不保存也不转发
+// 返回证据是否为新证据
+func SubmitEvidence(mainState *models.MainStore, e Evidence, from [32]byte) (bool, error) {
+	if from != ([32]byte{}) && !mainState.EvidenceLimit.Allow(string(from[:])) {
+		return false, ErrEvidenceRateLimited
+	}
+
+	current := mainState.Clock.Now().UnixMilli() / mainState.Config.Interval().Milliseconds()
+	if e.Round < current-EvidenceRoundWindow || e.Round > current+EvidenceRoundWindow {
+		return false, ErrEvidenceRound
+	}
+
+	database := mainState.DB
+	offender := e.Offender()
+	known, err := db.HasPeer(database, offender)
+	if err != nil {
+		return false, fmt.Errorf("failed to find peer: %w", err)
+	}
+	if !known {
+		return false, ErrEvidenceUnknown
+	}
+
+	if err := e.Verify(); err != nil {
+		return false, err
+	}
+
+	body := e.Encode()
+	added, err := db.SaveEvidence(database, e.KindName(), offender, e.Round, body[:])
+	if err != nil {
+		return false, fmt.Errorf("failed to save evidence: %w", err)
+	}
+	if !added {
+		return false, nil
+	}
+
+	metrics.Evidence(e.KindName())
+	log := logger.With(logger.NodeId(offender), logger.Round(e.Round))
+	log.Warning("Equivocation evidence accepted: %s", e.KindName())
+
+	penalty := uint16(mainState.Config.Consensus.EvidencePenalty)
+	err = db.PenalizePeer(database, offender, penalty, MaxReputation)
+	if err != nil && !errors.Is(err, db.ErrPeerNotFound) {
+		log.Warning("Penalize peer failed: %v", err)
+	}
+
+	gossipEvidence(mainState, buildEvidenceMessage(e), from)
+
+	return true, nil
+}
+
+// gossipEvidence 将证据发送给除 from 以外的所有已连接邻居
+func gossipEvidence(mainState *models.MainStore, message []byte, from [32]byte) {
+	ct := mainState.ConnectionTable
+
+	ct.Lock.RLock()
+	targets := make([]*models.IOChannel, 0, len(ct.Connection))
+	for nodeId, ioc := range ct.Connection {
+		if nodeId != from {
+			targets = append(targets, ioc)
+		}
+	}
+	ct.Lock.RUnlock()
+
+	for _, ioc := range targets {
+		go p2p.Enqueue(ioc.Ctx, ioc, message, 3*time.Second)
+	}
+}
@@ -1,279 +1,342 @@
 package consensus
 
 import (
-	"TrustMesh-PoC-1/internal/db"
-	"TrustMesh-PoC-1/internal/keys"
+	"TrustMesh-PoC-1/internal/clock"
 	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/metrics"
 	"TrustMesh-PoC-1/internal/models"
-	"crypto/ed25519"
-	"encoding/binary"
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/zeebo/blake3"
 )
 
-// ExecuteRound 轮次执行函数
-func ExecuteRound(mainState *models.MainStore, round int64, interval time.Duration) error {
-	proposalSate := mainState.ProposalSate
+// resendPace 同一提案两次广播之间的最短间隔，期间分数的多次上升合并为一次广播
+// 分数随签名逐步收敛，每次上升都立即转发会使消息量随签名数成倍增长
+const resendPace = time.Second
 
-	// 删除轮次数据
-	defer func() {
-		proposalSate.UpdateLock.Lock()
-		delete(proposalSate.Update, round)
-		proposalSate.UpdateLock.Unlock()
-
-		proposalSate.DataLock.Lock()
-		delete(proposalSate.Data, round)
-		proposalSate.DataLock.Unlock()
-
-		proposalSate.SigLock.Lock()
-		delete(proposalSate.Sig, round)
-		proposalSate.SigLock.Unlock()
+// ExecuteRound 轮次执行函数，负责轮次的 I/O，共识决策由 Machine 完成
+// ctx 取消时保存当前领先的提案作为检查点并返回
+func ExecuteRound(ctx context.Context, mainState *models.MainStore, round int64, interval time.Duration) error {
+	cfg := mainState.Config.Consensus
 
-		proposalSate.GuaranteeLock.Lock()
-		delete(proposalSate.Guarantee, round)
-		proposalSate.GuaranteeLock.Unlock()
+	// 创建并注册轮次
+	rs := mainState.ProposalSate.OpenRound(round)
+	pChan := rs.Updates()
 
-		proposalSate.ScoreLock.Lock()
-		delete(proposalSate.Score, round)
-		proposalSate.ScoreLock.Unlock()
+	// 注销轮次
+	defer func() {
+		mainState.Tracer.Forget(round)
+		mainState.ProposalSate.CloseRound(round)
 	}()
 
-	proposalSate.DataLock.Lock()
-	proposalSate.Data[round] = make(map[[32]byte]models.ProposalBody)
-	proposalSate.DataLock.Unlock()
-
-	proposalSate.SigLock.Lock()
-	proposalSate.Sig[round] = make(map[[32]byte]map[[32]byte]models.Attestation)
-	proposalSate.SigLock.Unlock()
-
-	proposalSate.GuaranteeLock.Lock()
-	proposalSate.Guarantee[round] = make(map[[32]byte]map[[32]byte]map[[32]byte]models.Guarantee)
-	proposalSate.GuaranteeLock.Unlock()
+	clk := mainState.Clock
+	timer := NewRoundTimer(clk, interval)
+	defer timer.Stop()
 
-	proposalSate.ScoreLock.Lock()
-	proposalSate.Score[round] = make(map[[32]byte]models.Score)
-	proposalSate.ScoreLock.Unlock()
-
-	// 注册处理通道
-	pChan := make(chan [32]byte, 128)
-	proposalSate.UpdateLock.Lock()
-	proposalSate.Update[round] = pChan
-	proposalSate.UpdateLock.Unlock()
-
-	<-TimeNextRound(interval, round)
+	select {
+	case <-timer.TimeNextRound(round):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	x := &roundIO{
+		ctx:       ctx,
+		mainState: mainState,
+		rs:        rs,
+		start:     clk.Now(),
+		next:      make(map[[32]byte]time.Time),
+		pending:   make(map[[32]byte]bool),
+	}
+	defer x.stopResend()
 
 	// 随机信誉
-	if err := RandomDBReputation(db.GetDB()); err != nil {
+	if err := RandomDBReputation(mainState.DB); err != nil {
 		logger.Error("Error in random db reputation")
 	}
 
-	// 获取密钥
-	priKey, pubKey, err := keys.LoadOrCreateKey()
-	if err != nil {
-		return fmt.Errorf("failed to load or generate private key: %v", err)
-	}
 	// 生成载荷
 	wordPass, err := WordPass(32)
 	if err != nil {
 		logger.Error("Error in generate WordPass")
 	}
 
-	// NodeId
-	myNodeId := blake3.Sum256(pubKey)
-	// 提案载荷
-	myPayload := make([]byte, 0, len(wordPass))
-	myPayload = append(myPayload[:], wordPass...)
-	// 轮次
-	var proposalRound [8]byte
-	binary.BigEndian.PutUint64(proposalRound[:], uint64(round))
-	// 提案时间戳
-	var timestamp [8]byte
-	proposalTime := uint64(time.Now().UnixMilli())
-	binary.BigEndian.PutUint64(timestamp[:], proposalTime)
-	// 标签
-	var PUBLISHV1DomainTag [4]byte
-	binary.BigEndian.PutUint32(PUBLISHV1DomainTag[:], PROPOSERV1Domain)
-
-	// 构建 pHash
-	myProposalData := make([]byte, 0, 8+32+8+len(myPayload))
-	myProposalData = append(myProposalData, proposalRound[:]...)
-	myProposalData = append(myProposalData, myNodeId[:]...)
-	myProposalData = append(myProposalData, timestamp[:]...)
-	myProposalData = append(myProposalData, myPayload...)
-	mypHash := blake3.Sum256(myProposalData)
-
-	// 构建发起者签名
-	initiatorData := make([]byte, 0, 4+8+32)
-	initiatorData = append(initiatorData, PUBLISHV1DomainTag[:]...)
-	initiatorData = append(initiatorData, proposalRound[:]...)
-	initiatorData = append(initiatorData, mypHash[:]...)
-	initiatorDataHash := blake3.Sum256(initiatorData)
-	var initiatorSig [64]byte
-	copy(initiatorSig[:], ed25519.Sign(priKey, initiatorDataHash[:]))
-	keys.Zeroize(priKey)
-
-	logger.Debug("makeProposal: %v", mypHash)
-
-	// 构造提案结构体
-	myProposal := models.ProposalBody{
-		ProposerPubKey: [32]byte(pubKey),
-		Payload:        myPayload,
-		Timestamp:      proposalTime,
-		ProposerSig:    initiatorSig,
+	// 构建提案
+	myNodeId := blake3.Sum256(mainState.Signer.PublicKey())
+	mypHash, myProposal, err := SignProposal(mainState.Signer, round, []byte(wordPass), x.stamp())
+	if err != nil {
+		return err
 	}
+	logger.With(logger.Round(round), logger.PHash(mypHash)).Debug("makeProposal")
 
 	// 构造打分结构体
-	_, myAttestation, err := buildRateSig(round, mypHash, MyScore)
+	_, myAttestation, err := SignRating(mainState.Signer, round, mypHash, cfg.MyScore, x.stamp())
 	if err != nil {
 		logger.Error("Failed in build rate sig: %v", err)
 	}
 
-	// 写入提案
-	proposalSate.DataLock.Lock()
-	proposalSate.Data[round][mypHash] = myProposal
-	proposalSate.DataLock.Unlock()
+	// 写入提案，本节点的提案不会被淘汰
+	if _, err := rs.AddProposal(mypHash, myNodeId, myProposal, true); err != nil {
+		return fmt.Errorf("failed to store my proposal: %w", err)
+	}
 
 	// 写入打分签名
-	proposalSate.SigLock.Lock()
-	proposalSate.Sig[round][mypHash] = make(map[[32]byte]models.Attestation)
-	proposalSate.Sig[round][mypHash][myNodeId] = myAttestation
-	proposalSate.SigLock.Unlock()
+	if _, err := rs.AddAttestation(mypHash, myNodeId, myAttestation); err != nil {
+		logger.Error("Failed to store my attestation: %v", err)
+	}
 
 	// 写入打分
-	proposalSate.ScoreLock.Lock()
-	proposalSate.Score[round][mypHash] = models.Score{
-		Score:     0,
-		LastScore: 0,
-	}
-	proposalSate.ScoreLock.Unlock()
+	rs.UpdateScore(mypHash, func(models.Score) models.Score {
+		return models.Score{Score: 0, LastScore: 0}
+	})
+
+	mainState.Tracer.Publish(round, mypHash)
 
 	// 将自己的提案加入处理队列
-	select {
-	case pChan <- mypHash:
-	default:
+	rs.Notify(mypHash)
+
+	machineCfg := MachineConfig{
+		Round:      round,
+		Mine:       mypHash,
+		ScoreBurrs: cfg.ScoreBurrs,
+		End:        time.UnixMilli((round + 1) * interval.Milliseconds()),
 	}
+	x.machine = NewMachine(machineCfg)
 
-	// 循环外部变量
-	firstSend := false
-	nextRound := TimeNextRound(interval, round+1)
+	// 记录状态机的输入与输出
+	if dir := mainState.Config.JournalDir(); dir != "" {
+		if x.journal, err = OpenJournal(dir, machineCfg); err != nil {
+			logger.Warning("Failed to open journal: %v", err)
+		}
+		defer func() { _ = x.journal.Close() }()
+	}
 
 	// 处理循环
+	nextRound := timer.TimeNextRound(round + 1)
 	for {
-		if TimeNextRoundComing(interval, round+1) {
-			var winner [32]byte
-			var no1 uint32 = 0
-
-			// 选出分数第一
-			proposalSate.ScoreLock.RLock()
-			for k, v := range proposalSate.Score[round] {
-				logger.Debug("choose: %v score: %v", k, v.Score)
-				if v.Score >= no1 {
-					winner = k
-					no1 = v.Score
-				}
+		var done bool
+		var err error
+
+		select {
+		case proposalHash := <-pChan:
+			sigList, ok := rs.Attestations(proposalHash)
+			if !ok {
+				continue
 			}
-			proposalSate.ScoreLock.RUnlock()
 
-			logger.Info("round: %v winner: %v", round, winner)
+			// 每次打分前读取信誉快照，本轮内的信誉变化随即生效
+			weights, total, errR := LoadReputation(mainState.DB)
+			if errR != nil {
+				logger.Error("Failed to calculate score: %v", errR)
+				continue
+			}
+			if total == 0 {
+				logger.Error("Failed to calculate score: all the reputation data are zero")
+				continue
+			}
+			x.input(ReputationLoaded{Weights: weights, Total: total})
 
-			// 克隆胜利提案的结构体
-			proposalSate.DataLock.RLock()
-			wp := cloneProposalBody(proposalSate.Data[round][winner])
-			proposalSate.DataLock.RUnlock()
+			done, err = x.step(ProposalUpdated{PHash: proposalHash, Attestations: sigList})
+		case <-x.resendC():
+			x.flush()
+		case <-nextRound:
+			done, err = x.step(Tick{Now: clk.Now()})
+			if !done {
+				nextRound = timer.TimeNextRound(round + 1)
+			}
+		case <-ctx.Done():
+			leader, _ := x.machine.Leader()
+			leader, wp := x.proposal(leader)
+			logger.With(logger.Round(round), logger.PHash(leader)).Info("Round interrupted, writing checkpoint")
 
-			// 将胜利提案写入文件
-			if err := winnerProposal(wp, round); err != nil {
-				return fmt.Errorf("write winner proposal failed: %v", err)
+			if err := checkpointProposal(mainState.Config.DataDir, wp, round); err != nil {
+				return fmt.Errorf("write checkpoint failed: %v", err)
 			}
 
+			return ctx.Err()
+		}
+
+		if err != nil {
+			return err
+		}
+		if done {
 			return nil
 		}
+	}
+}
 
-		select {
-		case proposalHash := <-pChan:
+// roundIO 执行状态机输出的动作：签名、广播、写入分数与胜出提案
+type roundIO struct {
+	ctx       context.Context
+	mainState *models.MainStore
+	rs        *models.RoundState
+	machine   *Machine
+	// 轮次开始时间
+	start time.Time
+	// 状态机日志，未开启时为 nil
+	journal *Journal
+	// 上一个签名时间戳
+	lastStamp uint64
+	// 各提案下次允许广播的时间
+	next map[[32]byte]time.Time
+	// 等待间隔期满后广播的提案
+	pending map[[32]byte]bool
+	// pending 中最早期满的时间到期，首次推迟广播时创建
+	resend clock.Timer
+	// resend 的到期时间，零值表示未在计时
+	due time.Time
+}
 
-			proposalSate.DataLock.RLock()
-			if _, e := proposalSate.Data[round][proposalHash]; !e {
-				proposalSate.DataLock.RUnlock()
-				continue
-			}
-			proposalSate.DataLock.RUnlock()
+// input 向状态机输入事件并记录到日志
+func (x *roundIO) input(e Event) []Action {
+	actions := x.machine.Step(e)
+	x.journal.Record(e, actions)
 
-			proposalSate.SigLock.RLock()
-			sigList := cloneAttestationMap(proposalSate.Sig[round][proposalHash])
-			proposalSate.SigLock.RUnlock()
+	return actions
+}
 
-			score, err := RateScore(sigList, db.GetDB())
+// step 向状态机输入事件并执行其动作，轮次结束时返回 true
+func (x *roundIO) step(e Event) (bool, error) {
+	// 签名失败的提案不再广播
+	skip := make(map[[32]byte]bool)
+
+	for _, a := range x.input(e) {
+		switch a := a.(type) {
+		case Scored:
+			x.rs.UpdateScore(a.PHash, func(models.Score) models.Score { return a.Score })
+		case Sign:
+			nodeId, att, err := SignRating(x.mainState.Signer, x.rs.Round, a.PHash, a.Score, x.stamp())
 			if err != nil {
-				logger.Error("Failed to calculate score: %v", err)
+				logger.Error("failed to build rate signature: %v", err)
+				skip[a.PHash] = true
 				continue
 			}
 
-			// 获取分数
-			proposalSate.ScoreLock.Lock()
-			stateScore, ok := proposalSate.Score[round][proposalHash]
-
-			if !ok {
-				stateScore = models.Score{
-					LastScore: 0,
-				}
+			// 写入打分签名
+			if _, err := x.rs.AddAttestation(a.PHash, nodeId, att); err != nil {
+				logger.Debug("Failed to store rate signature: %v", err)
+				skip[a.PHash] = true
 			}
-			stateScore.Score = score
-
-			if proposalHash == mypHash {
-				if !firstSend || score-stateScore.LastScore >= ScoreBurrs {
-					// 写入 Last
-					stateScore.LastScore = score
-					proposalSate.Score[round][proposalHash] = stateScore
-					proposalSate.ScoreLock.Unlock()
-
-					// 广播
-					err := sendProposal(mainState, round, proposalHash, db.GetDB(), DiffuseHop)
-					if err != nil {
-						logger.Error("failed to send my proposal: %v", err)
-						continue
-					}
-					firstSend = true
-				} else {
-					proposalSate.Score[round][proposalHash] = stateScore
-					proposalSate.ScoreLock.Unlock()
-				}
-			} else if score-stateScore.LastScore >= ScoreBurrs {
-
-				// 写入 Last
-				stateScore.LastScore = score
-				proposalSate.Score[round][proposalHash] = stateScore
-				proposalSate.ScoreLock.Unlock()
-
-				// 创建打分签名
-				nodeId, att, errA := buildRateSig(round, proposalHash, score)
-				if errA != nil {
-					logger.Error("failed to build rate signature: %v", errA)
-					continue
-				}
-
-				// 写入打分签名
-				proposalSate.SigLock.Lock()
-				if _, e := proposalSate.Sig[round][proposalHash]; !e {
-					proposalSate.Sig[round][proposalHash] = make(map[[32]byte]models.Attestation)
-				}
-				proposalSate.Sig[round][proposalHash][nodeId] = att
-				proposalSate.SigLock.Unlock()
-
-				// 广播提案
-				errB := sendProposal(mainState, round, proposalHash, db.GetDB(), DiffuseHop)
-				if errB != nil {
-					logger.Error("failed to send proposal: %v", errB)
-					continue
-				}
-			} else {
-				proposalSate.Score[round][proposalHash] = stateScore
-				proposalSate.ScoreLock.Unlock()
+		case Broadcast:
+			if skip[a.PHash] {
+				continue
 			}
-		case <-nextRound:
+			x.broadcast(a.PHash)
+		case Finalize:
+			return true, x.finalize(a)
+		}
+	}
+
+	return false, nil
+}
+
+// broadcast 广播提案，距上次广播的间隔未满时推迟到期满后再发送当时的签名集
+func (x *roundIO) broadcast(pHash [32]byte) {
+	next, ok := x.next[pHash]
+	if !ok || !x.mainState.Clock.Now().Before(next) {
+		x.send(pHash)
+		return
+	}
+
+	if !x.pending[pHash] {
+		x.pending[pHash] = true
+		x.schedule(next)
+	}
+}
+
+// send 立即广播提案
+func (x *roundIO) send(pHash [32]byte) {
+	x.next[pHash] = x.mainState.Clock.Now().Add(resendPace)
+	if err := x.mainState.Sender.SendProposal(x.ctx, x.rs, pHash); err != nil {
+		logger.Error("failed to send proposal: %v", err)
+		x.input(BroadcastFailed{PHash: pHash})
+	}
+}
+
+// flush 广播已期满的推迟提案，并为其余提案重新计时
+func (x *roundIO) flush() {
+	x.due = time.Time{}
+	now := x.mainState.Clock.Now()
+
+	for pHash := range x.pending {
+		at := x.next[pHash]
+		if now.Before(at) {
+			x.schedule(at)
 			continue
 		}
+		delete(x.pending, pHash)
+		x.send(pHash)
+	}
+}
+
+// schedule 使 resend 不晚于 at 到期
+func (x *roundIO) schedule(at time.Time) {
+	if !x.due.IsZero() && !at.Before(x.due) {
+		return
+	}
+	x.due = at
+
+	d := clock.Until(x.mainState.Clock, at)
+	if x.resend == nil {
+		x.resend = x.mainState.Clock.NewTimer(d)
+	} else {
+		x.resend.Reset(d)
 	}
 }
+
+// resendC resend 的到期通道，未创建时返回 nil
+func (x *roundIO) resendC() <-chan time.Time {
+	if x.resend == nil {
+		return nil
+	}
+
+	return x.resend.C()
+}
+
+// stopResend 停止 resend
+func (x *roundIO) stopResend() {
+	if x.resend != nil {
+		x.resend.Stop()
+	}
+}
+
+// finalize 将胜出提案写入文件并记录指标
+func (x *roundIO) finalize(a Finalize) error {
+	round := x.rs.Round
+	winner, wp := x.proposal(a.PHash)
+	logger.With(logger.Round(round), logger.PHash(winner)).Info("Round finished")
+
+	// 将胜利提案写入文件
+	if err := WinnerProposal(x.mainState.Config.DataDir, wp, round); err != nil {
+		return fmt.Errorf("write winner proposal failed: %v", err)
+	}
+
+	metrics.RoundFinished(round, x.rs.Count(), a.Score, x.mainState.Clock.Now().Sub(x.start).Seconds())
+	if x.mainState.Observer != nil {
+		x.mainState.Observer.RoundFinished(round, winner, x.rs.Count())
+	}
+
+	return nil
+}
+
+// proposal 读取提案本体，提案已被淘汰时退回到存储中分数最高的提案
+func (x *roundIO) proposal(pHash [32]byte) ([32]byte, models.ProposalBody) {
+	if p, _, _, ok := x.rs.Snapshot(pHash); ok {
+		return pHash, p
+	}
+
+	pHash, p, _ := x.rs.Leading()
+	return pHash, p
+}
+
+// stamp 签名时间戳，取时钟的当前毫秒并保证轮次内严格递增
+// 同一毫秒内对同一提案的两次打分会构成矛盾打分
+func (x *roundIO) stamp() uint64 {
+	now := uint64(x.mainState.Clock.Now().UnixMilli())
+	if now <= x.lastStamp {
+		now = x.lastStamp + 1
+	}
+	x.lastStamp = now
+
+	return now
+}
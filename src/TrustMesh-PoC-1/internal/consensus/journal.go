@@ -0,0 +1,274 @@
+package consensus
+
+import (
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/models"
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// 状态机日志，每行一个 JSON 对象
+// 第一行为状态机参数，其后每行为一次 Step 的输入事件与输出动作，可用 Replay 重放并核对
+// 打分签名只记录分数，状态机不使用签名本身
+
+// 日志中事件与动作的类型
+const (
+	journalReputation      = "reputation_loaded"
+	journalProposal        = "proposal_updated"
+	journalBroadcastFailed = "broadcast_failed"
+	journalTick            = "tick"
+	journalScored          = "scored"
+	journalSign            = "sign"
+	journalBroadcast       = "broadcast"
+	journalFinalize        = "finalize"
+)
+
+// ErrReplayMismatch 重放产生的动作与日志记录的不一致
+var ErrReplayMismatch = errors.New("replay mismatch")
+
+// journalHeader 日志第一行，状态机参数
+type journalHeader struct {
+	Round      int64  `json:"round"`
+	Mine       string `json:"mine"`
+	ScoreBurrs uint32 `json:"score_burrs"`
+	// 轮次结束时间（Unix 纳秒）
+	End int64 `json:"end"`
+}
+
+// journalItem 一个事件或动作，只填写该类型用到的字段
+type journalItem struct {
+	Type  string `json:"type"`
+	PHash string `json:"p_hash,omitempty"`
+	// ReputationLoaded：NodeId | 信誉值
+	Weights map[string]uint32 `json:"weights,omitempty"`
+	Total   uint64            `json:"total,omitempty"`
+	// ProposalUpdated：NodeId | 分数
+	Attestations map[string]uint32 `json:"attestations,omitempty"`
+	// Tick（Unix 纳秒）
+	Now int64 `json:"now,omitempty"`
+	// Scored、Sign、Finalize
+	Score     uint32 `json:"score,omitempty"`
+	LastScore uint32 `json:"last_score,omitempty"`
+}
+
+// journalStep 一次 Step
+type journalStep struct {
+	Event   journalItem   `json:"event"`
+	Actions []journalItem `json:"actions"`
+}
+
+// Journal 将一个轮次中状态机的输入与输出写入日志文件
+// nil 表示不记录，所有方法均可在 nil 上调用
+type Journal struct {
+	lock sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// OpenJournal 在 dir 下创建轮次的日志文件 <round>.jsonl 并写入状态机参数
+func OpenJournal(dir string, cfg MachineConfig) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0o0755); err != nil {
+		return nil, fmt.Errorf("cannot create journal directory: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%d.jsonl", cfg.Round))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open journal file: %w", err)
+	}
+
+	j := &Journal{file: file, enc: json.NewEncoder(file)}
+	header := journalHeader{
+		Round:      cfg.Round,
+		Mine:       hex.EncodeToString(cfg.Mine[:]),
+		ScoreBurrs: cfg.ScoreBurrs,
+		End:        cfg.End.UnixNano(),
+	}
+	if err := j.enc.Encode(header); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// Record 记录一次 Step 的输入与输出，写入失败只记录日志
+func (j *Journal) Record(e Event, actions []Action) {
+	if j == nil {
+		return
+	}
+
+	step := journalStep{Event: encodeEvent(e), Actions: encodeActions(actions)}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if err := j.enc.Encode(step); err != nil {
+		logger.Warning("Write journal failed: %v", err)
+	}
+}
+
+// Close 关闭日志文件
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	return j.file.Close()
+}
+
+// Replay 读取日志，将记录的事件依次输入新的状态机，并核对每一步的动作与记录一致
+// 返回重放的步数，第一处不一致返回 ErrReplayMismatch
+func Replay(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64<<20)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("journal is empty")
+	}
+	var header journalHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return 0, fmt.Errorf("invalid journal header: %w", err)
+	}
+	mine, err := decodeHash(header.Mine)
+	if err != nil {
+		return 0, fmt.Errorf("invalid journal header: %w", err)
+	}
+	m := NewMachine(MachineConfig{
+		Round:      header.Round,
+		Mine:       mine,
+		ScoreBurrs: header.ScoreBurrs,
+		End:        time.Unix(0, header.End),
+	})
+
+	n := 0
+	for scanner.Scan() {
+		n++
+		var step journalStep
+		if err := json.Unmarshal(scanner.Bytes(), &step); err != nil {
+			return n, fmt.Errorf("step %d: %w", n, err)
+		}
+		e, err := decodeEvent(step.Event)
+		if err != nil {
+			return n, fmt.Errorf("step %d: %w", n, err)
+		}
+
+		got := encodeActions(m.Step(e))
+		if (len(got) != 0 || len(step.Actions) != 0) && !reflect.DeepEqual(got, step.Actions) {
+			return n, fmt.Errorf("%w at step %d (%s): want %+v, got %+v", ErrReplayMismatch, n, step.Event.Type, step.Actions, got)
+		}
+	}
+
+	return n, scanner.Err()
+}
+
+// encodeEvent 事件转换为日志格式
+func encodeEvent(e Event) journalItem {
+	switch e := e.(type) {
+	case ReputationLoaded:
+		weights := make(map[string]uint32, len(e.Weights))
+		for nodeId, w := range e.Weights {
+			weights[hex.EncodeToString(nodeId[:])] = w
+		}
+		return journalItem{Type: journalReputation, Weights: weights, Total: e.Total}
+	case ProposalUpdated:
+		atts := make(map[string]uint32, len(e.Attestations))
+		for nodeId, a := range e.Attestations {
+			atts[hex.EncodeToString(nodeId[:])] = a.Score
+		}
+		return journalItem{Type: journalProposal, PHash: hex.EncodeToString(e.PHash[:]), Attestations: atts}
+	case BroadcastFailed:
+		return journalItem{Type: journalBroadcastFailed, PHash: hex.EncodeToString(e.PHash[:])}
+	case Tick:
+		return journalItem{Type: journalTick, Now: e.Now.UnixNano()}
+	default:
+		return journalItem{Type: fmt.Sprintf("%T", e)}
+	}
+}
+
+// decodeEvent 日志格式转换为事件
+func decodeEvent(item journalItem) (Event, error) {
+	switch item.Type {
+	case journalReputation:
+		weights := make(map[[32]byte]uint32, len(item.Weights))
+		for k, w := range item.Weights {
+			nodeId, err := decodeHash(k)
+			if err != nil {
+				return nil, err
+			}
+			weights[nodeId] = w
+		}
+		return ReputationLoaded{Weights: weights, Total: item.Total}, nil
+	case journalProposal:
+		pHash, err := decodeHash(item.PHash)
+		if err != nil {
+			return nil, err
+		}
+		atts := make(map[[32]byte]models.Attestation, len(item.Attestations))
+		for k, score := range item.Attestations {
+			nodeId, err := decodeHash(k)
+			if err != nil {
+				return nil, err
+			}
+			atts[nodeId] = models.Attestation{Score: score}
+		}
+		return ProposalUpdated{PHash: pHash, Attestations: atts}, nil
+	case journalBroadcastFailed:
+		pHash, err := decodeHash(item.PHash)
+		if err != nil {
+			return nil, err
+		}
+		return BroadcastFailed{PHash: pHash}, nil
+	case journalTick:
+		return Tick{Now: time.Unix(0, item.Now)}, nil
+	default:
+		return nil, fmt.Errorf("unknown event type %q", item.Type)
+	}
+}
+
+// encodeActions 动作转换为日志格式，没有动作时为空切片
+func encodeActions(actions []Action) []journalItem {
+	out := make([]journalItem, 0, len(actions))
+	for _, a := range actions {
+		switch a := a.(type) {
+		case Scored:
+			out = append(out, journalItem{Type: journalScored, PHash: hex.EncodeToString(a.PHash[:]), Score: a.Score.Score, LastScore: a.Score.LastScore})
+		case Sign:
+			out = append(out, journalItem{Type: journalSign, PHash: hex.EncodeToString(a.PHash[:]), Score: a.Score})
+		case Broadcast:
+			out = append(out, journalItem{Type: journalBroadcast, PHash: hex.EncodeToString(a.PHash[:])})
+		case Finalize:
+			out = append(out, journalItem{Type: journalFinalize, PHash: hex.EncodeToString(a.PHash[:]), Score: a.Score})
+		default:
+			out = append(out, journalItem{Type: fmt.Sprintf("%T", a)})
+		}
+	}
+
+	return out
+}
+
+// decodeHash 解码 32 字节的十六进制哈希
+func decodeHash(s string) ([32]byte, error) {
+	var out [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 32 {
+		return out, fmt.Errorf("invalid hash %q", s)
+	}
+	copy(out[:], b)
+
+	return out, nil
+}
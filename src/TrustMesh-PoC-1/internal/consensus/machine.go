@@ -0,0 +1,187 @@
+package consensus
+
+import (
+	"TrustMesh-PoC-1/internal/models"
+	"bytes"
+	"time"
+)
+
+// Event 状态机的输入
+type Event interface {
+	event()
+}
+
+// ReputationLoaded 信誉快照，之后的打分使用这份快照
+type ReputationLoaded struct {
+	// NodeId | 信誉值
+	Weights map[[32]byte]uint32
+	// 节点表中全部信誉值之和
+	Total uint64
+}
+
+// ProposalUpdated 已收到本体的提案或其签名集有更新，携带当前的签名集
+type ProposalUpdated struct {
+	PHash        [32]byte
+	Attestations map[[32]byte]models.Attestation
+}
+
+// BroadcastFailed 广播未能发出，本节点的提案会在下次更新时重新广播
+type BroadcastFailed struct {
+	PHash [32]byte
+}
+
+// Tick 时钟推进，Now 到达轮次结束时间时结束轮次
+type Tick struct {
+	Now time.Time
+}
+
+func (ReputationLoaded) event() {}
+func (ProposalUpdated) event()  {}
+func (BroadcastFailed) event()  {}
+func (Tick) event()             {}
+
+// Action 状态机的输出，由调用方按顺序执行
+type Action interface {
+	action()
+}
+
+// Scored 提案的本地分数有变化
+type Scored struct {
+	PHash [32]byte
+	Score models.Score
+}
+
+// Sign 以该分数为提案签名打分，签名失败时跳过同一提案随后的广播
+type Sign struct {
+	PHash [32]byte
+	Score uint32
+}
+
+// Broadcast 广播提案及其签名集
+type Broadcast struct {
+	PHash [32]byte
+}
+
+// Finalize 轮次结束，PHash 为胜出提案
+type Finalize struct {
+	PHash [32]byte
+	Score uint32
+}
+
+func (Scored) action()    {}
+func (Sign) action()      {}
+func (Broadcast) action() {}
+func (Finalize) action()  {}
+
+// MachineConfig 状态机参数
+type MachineConfig struct {
+	Round int64
+	// 本节点的提案哈希
+	Mine [32]byte
+	// 广播阈值
+	ScoreBurrs uint32
+	// 轮次结束时间
+	End time.Time
+}
+
+// Machine 单个轮次的共识状态机
+// 不做任何 I/O，也不读取时钟，相同的事件序列总是产生相同的动作
+type Machine struct {
+	cfg MachineConfig
+	// 信誉快照
+	weights map[[32]byte]uint32
+	total   uint64
+	// 提案哈希 | 本地分数，只包含已打分的提案
+	scores map[[32]byte]models.Score
+	// 本节点的提案是否已广播
+	firstSend bool
+	finalized bool
+}
+
+// NewMachine 创建状态机，本节点的提案以零分参与排名
+func NewMachine(cfg MachineConfig) *Machine {
+	return &Machine{
+		cfg: cfg,
+		scores: map[[32]byte]models.Score{
+			cfg.Mine: {},
+		},
+	}
+}
+
+// Step 处理一个事件并返回需要执行的动作，轮次结束后不再产生动作
+func (m *Machine) Step(e Event) []Action {
+	if m.finalized {
+		return nil
+	}
+
+	switch e := e.(type) {
+	case ReputationLoaded:
+		m.weights = e.Weights
+		m.total = e.Total
+	case ProposalUpdated:
+		return m.rate(e.PHash, e.Attestations)
+	case BroadcastFailed:
+		if e.PHash == m.cfg.Mine {
+			m.firstSend = false
+		}
+	case Tick:
+		if e.Now.Before(m.cfg.End) {
+			return nil
+		}
+		m.finalized = true
+		winner, score := m.Leader()
+		return []Action{Finalize{PHash: winner, Score: score}}
+	}
+
+	return nil
+}
+
+// rate 重新计算提案分数，分数上升至少 ScoreBurrs 时签名并广播，本节点的提案首次必定广播
+func (m *Machine) rate(pHash [32]byte, sigs map[[32]byte]models.Attestation) []Action {
+	// 没有信誉数据时无法打分
+	if m.total == 0 {
+		return nil
+	}
+
+	score := WeightedScore(sigs, m.weights, m.total)
+	mine := pHash == m.cfg.Mine
+
+	s := m.scores[pHash]
+	s.Score = score
+
+	actions := make([]Action, 0, 3)
+	if (mine && !m.firstSend) || raised(score, s.LastScore, m.cfg.ScoreBurrs) {
+		s.LastScore = score
+		// 只在分数上升时重新打分，更低的分数会与已发出的签名矛盾
+		if !mine {
+			actions = append(actions, Sign{PHash: pHash, Score: score})
+		}
+		actions = append(actions, Broadcast{PHash: pHash})
+		if mine {
+			m.firstSend = true
+		}
+	}
+	m.scores[pHash] = s
+
+	return append([]Action{Scored{PHash: pHash, Score: s}}, actions...)
+}
+
+// Leader 已打分的提案中分数第一的提案，同分时取提案哈希较小者
+func (m *Machine) Leader() ([32]byte, uint32) {
+	var winner [32]byte
+	var no1 uint32
+	found := false
+
+	for pHash, s := range m.scores {
+		if !found || s.Score > no1 || (s.Score == no1 && bytes.Compare(pHash[:], winner[:]) < 0) {
+			winner, no1, found = pHash, s.Score, true
+		}
+	}
+
+	return winner, no1
+}
+
+// raised 分数是否比上次广播时上升了至少 burrs
+func raised(score uint32, last uint32, burrs uint32) bool {
+	return score > last && score-last >= burrs
+}
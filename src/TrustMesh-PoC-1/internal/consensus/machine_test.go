@@ -0,0 +1,195 @@
+package consensus
+
+import (
+	"TrustMesh-PoC-1/internal/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// hash 测试用的提案哈希或 NodeId
+func hash(b byte) [32]byte {
+	var out [32]byte
+	out[0] = b
+	return out
+}
+
+// votes 按 NodeId 构建签名集，只填写分数
+func votes(scores map[byte]uint32) map[[32]byte]models.Attestation {
+	out := make(map[[32]byte]models.Attestation, len(scores))
+	for id, s := range scores {
+		out[hash(id)] = models.Attestation{Score: s}
+	}
+	return out
+}
+
+// step 一次输入及期望的动作
+type step struct {
+	event Event
+	want  []Action
+}
+
+var (
+	testEnd  = time.UnixMilli(10_000)
+	testMine = hash(0xa0)
+	// 节点 1 与 2 各占一半信誉
+	testReputation = ReputationLoaded{
+		Weights: map[[32]byte]uint32{hash(1): 5_000, hash(2): 5_000},
+		Total:   10_000,
+	}
+)
+
+func TestMachineStep(t *testing.T) {
+	other := hash(0xb0)
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "no reputation yet",
+			steps: []step{
+				{ProposalUpdated{PHash: testMine, Attestations: votes(map[byte]uint32{1: 5_000})}, nil},
+			},
+		},
+		{
+			name: "own proposal is sent first",
+			steps: []step{
+				{testReputation, nil},
+				{ProposalUpdated{PHash: testMine, Attestations: votes(map[byte]uint32{1: 5_000})}, []Action{
+					Scored{PHash: testMine, Score: models.Score{Score: 2_500, LastScore: 2_500}},
+					Broadcast{PHash: testMine},
+				}},
+				{ProposalUpdated{PHash: testMine, Attestations: votes(map[byte]uint32{1: 5_000})}, []Action{
+					Scored{PHash: testMine, Score: models.Score{Score: 2_500, LastScore: 2_500}},
+				}},
+			},
+		},
+		{
+			name: "score rising by score burrs is signed and re-broadcast",
+			steps: []step{
+				{testReputation, nil},
+				{ProposalUpdated{PHash: other, Attestations: votes(map[byte]uint32{1: 1_000})}, []Action{
+					Scored{PHash: other, Score: models.Score{Score: 500, LastScore: 500}},
+					Sign{PHash: other, Score: 500},
+					Broadcast{PHash: other},
+				}},
+				// 上升 50，低于阈值
+				{ProposalUpdated{PHash: other, Attestations: votes(map[byte]uint32{1: 1_000, 2: 100})}, []Action{
+					Scored{PHash: other, Score: models.Score{Score: 550, LastScore: 500}},
+				}},
+				// 相对上次广播上升 100，达到阈值
+				{ProposalUpdated{PHash: other, Attestations: votes(map[byte]uint32{1: 1_000, 2: 200})}, []Action{
+					Scored{PHash: other, Score: models.Score{Score: 600, LastScore: 600}},
+					Sign{PHash: other, Score: 600},
+					Broadcast{PHash: other},
+				}},
+				// 分数下降时不签名
+				{ProposalUpdated{PHash: other, Attestations: votes(map[byte]uint32{1: 1_000})}, []Action{
+					Scored{PHash: other, Score: models.Score{Score: 500, LastScore: 600}},
+				}},
+			},
+		},
+		{
+			name: "broadcast failure resends own proposal",
+			steps: []step{
+				{testReputation, nil},
+				{ProposalUpdated{PHash: testMine, Attestations: votes(map[byte]uint32{1: 5_000})}, []Action{
+					Scored{PHash: testMine, Score: models.Score{Score: 2_500, LastScore: 2_500}},
+					Broadcast{PHash: testMine},
+				}},
+				{BroadcastFailed{PHash: testMine}, nil},
+				{ProposalUpdated{PHash: testMine, Attestations: votes(map[byte]uint32{1: 5_000})}, []Action{
+					Scored{PHash: testMine, Score: models.Score{Score: 2_500, LastScore: 2_500}},
+					Broadcast{PHash: testMine},
+				}},
+			},
+		},
+		{
+			name: "broadcast failure of other proposals waits for the next rise",
+			steps: []step{
+				{testReputation, nil},
+				{ProposalUpdated{PHash: other, Attestations: votes(map[byte]uint32{1: 1_000})}, []Action{
+					Scored{PHash: other, Score: models.Score{Score: 500, LastScore: 500}},
+					Sign{PHash: other, Score: 500},
+					Broadcast{PHash: other},
+				}},
+				{BroadcastFailed{PHash: other}, nil},
+				{ProposalUpdated{PHash: other, Attestations: votes(map[byte]uint32{1: 1_000})}, []Action{
+					Scored{PHash: other, Score: models.Score{Score: 500, LastScore: 500}},
+				}},
+			},
+		},
+		{
+			name: "tick finalizes the round",
+			steps: []step{
+				{testReputation, nil},
+				{ProposalUpdated{PHash: other, Attestations: votes(map[byte]uint32{1: 1_000})}, []Action{
+					Scored{PHash: other, Score: models.Score{Score: 500, LastScore: 500}},
+					Sign{PHash: other, Score: 500},
+					Broadcast{PHash: other},
+				}},
+				{Tick{Now: testEnd.Add(-time.Nanosecond)}, nil},
+				{Tick{Now: testEnd}, []Action{Finalize{PHash: other, Score: 500}}},
+				// 结束后不再产生动作
+				{ProposalUpdated{PHash: other, Attestations: votes(map[byte]uint32{1: 2_000})}, nil},
+				{Tick{Now: testEnd.Add(time.Second)}, nil},
+			},
+		},
+		{
+			name: "own proposal wins an empty round",
+			steps: []step{
+				{Tick{Now: testEnd}, []Action{Finalize{PHash: testMine, Score: 0}}},
+			},
+		},
+		{
+			name: "equal scores are won by the smaller hash",
+			steps: []step{
+				{testReputation, nil},
+				{ProposalUpdated{PHash: hash(0xc0), Attestations: votes(map[byte]uint32{1: 1_000})}, []Action{
+					Scored{PHash: hash(0xc0), Score: models.Score{Score: 500, LastScore: 500}},
+					Sign{PHash: hash(0xc0), Score: 500},
+					Broadcast{PHash: hash(0xc0)},
+				}},
+				{ProposalUpdated{PHash: other, Attestations: votes(map[byte]uint32{2: 1_000})}, []Action{
+					Scored{PHash: other, Score: models.Score{Score: 500, LastScore: 500}},
+					Sign{PHash: other, Score: 500},
+					Broadcast{PHash: other},
+				}},
+				{Tick{Now: testEnd}, []Action{Finalize{PHash: other, Score: 500}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMachine(MachineConfig{Round: 1, Mine: testMine, ScoreBurrs: 100, End: testEnd})
+			for i, s := range tt.steps {
+				got := m.Step(s.event)
+				if len(got) == 0 && len(s.want) == 0 {
+					continue
+				}
+				if !reflect.DeepEqual(got, s.want) {
+					t.Fatalf("step %d (%T): got %+v, want %+v", i, s.event, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMachineLeaderTieBreak(t *testing.T) {
+	// 分数相同的提案较多时，map 的遍历顺序不影响结果
+	m := NewMachine(MachineConfig{Round: 1, Mine: testMine, ScoreBurrs: 100, End: testEnd})
+	m.Step(testReputation)
+	for b := byte(0xff); b > 0x10; b-- {
+		m.Step(ProposalUpdated{PHash: hash(b), Attestations: votes(map[byte]uint32{1: 1_000})})
+	}
+
+	want := hash(0x11)
+	for i := 0; i < 20; i++ {
+		winner, score := m.Leader()
+		if winner != want || score != 500 {
+			t.Fatalf("leader = %x/%d, want %x/500", winner[:1], score, want[:1])
+		}
+	}
+}
@@ -1,20 +1,20 @@
 package consensus
 
 import (
+	"TrustMesh-PoC-1/internal/constants"
 	"TrustMesh-PoC-1/internal/keys"
 	"TrustMesh-PoC-1/internal/models"
 	"TrustMesh-PoC-1/internal/p2p"
-	"crypto/ed25519"
+	"TrustMesh-PoC-1/internal/trace"
 	"encoding/binary"
 	"fmt"
-	"time"
 
 	"github.com/zeebo/blake3"
 )
 
-// buildProposalBodyMessage 构建提案数据消息
-func buildProposalBodyMessage(store models.ProposalBody, round int64) []byte {
-	message := make([]byte, 0, 4+4+(8+32+8+64+len(store.Payload)))
+// BuildProposalBodyMessage 构建提案数据消息，tc 不为 nil 时携带追踪上下文
+func BuildProposalBodyMessage(store models.ProposalBody, round int64, tc *trace.Context) []byte {
+	message := make([]byte, 0, 4+4+(1+trace.ContextSize+8+32+8+64+len(store.Payload)))
 
 	// 创建 [4]byte 格式的 header
 	var header [4]byte
@@ -29,7 +29,8 @@ func buildProposalBodyMessage(store models.ProposalBody, round int64) []byte {
 	binary.BigEndian.PutUint64(timestamp[:], store.Timestamp)
 
 	// 提案内容
-	msgPayload := make([]byte, 0, 8+32+8+64+len(store.Payload))
+	msgPayload := make([]byte, 0, 1+trace.ContextSize+8+32+8+64+len(store.Payload))
+	msgPayload = trace.AppendContext(msgPayload, tc)
 	msgPayload = append(msgPayload, roundBytes[:]...)
 	msgPayload = append(msgPayload, store.ProposerPubKey[:]...)
 	msgPayload = append(msgPayload, timestamp[:]...)
@@ -47,10 +48,10 @@ func buildProposalBodyMessage(store models.ProposalBody, round int64) []byte {
 	return message
 }
 
-// buildProposalSigMessage 构建提案签名&担保消息
-func buildProposalSigMessage(sigList map[[32]byte]models.Attestation, guarantee map[[32]byte]map[[32]byte]models.Guarantee, round int64, proposalHash [32]byte) []byte {
+// BuildProposalSigMessage 构建提案签名&担保消息，tc 不为 nil 时携带追踪上下文
+func BuildProposalSigMessage(sigList map[[32]byte]models.Attestation, guarantee map[[32]byte]map[[32]byte]models.Guarantee, round int64, proposalHash [32]byte, tc *trace.Context) []byte {
 	// (没有计算被担保者签名)
-	message := make([]byte, 0, 4+4+8+32+2+((32+4+8+64+2)*len(sigList)))
+	message := make([]byte, 0, 4+4+1+trace.ContextSize+8+32+2+((32+4+8+64+2)*len(sigList)))
 
 	// header
 	var header [4]byte
@@ -58,19 +59,27 @@ func buildProposalSigMessage(sigList map[[32]byte]models.Attestation, guarantee
 	message = append(message, header[:]...)
 
 	// payload
-	payload := make([]byte, 0, 8+32+2+((32+4+8+64+2)*len(sigList)))
+	payload := make([]byte, 0, 1+trace.ContextSize+8+32+2+((32+4+8+64+2)*len(sigList)))
+	// 追踪上下文
+	payload = trace.AppendContext(payload, tc)
 	// 写入轮次
 	var roundByte [8]byte
 	binary.BigEndian.PutUint64(roundByte[:], uint64(round))
 	payload = append(payload, roundByte[:]...)
 	// 写入提案哈希
 	payload = append(payload, proposalHash[:]...)
-	// 写入签名者数量
+	// 写入签名者数量，超出接收方上限的签名者不发送
+	count := min(len(sigList), constants.MaxSigners)
 	var signerCount [2]byte
-	binary.BigEndian.PutUint16(signerCount[:], uint16(len(sigList)))
+	binary.BigEndian.PutUint16(signerCount[:], uint16(count))
 	payload = append(payload, signerCount[:]...)
 
 	for signerId, val := range sigList {
+		if count == 0 {
+			break
+		}
+		count--
+
 		// 公钥
 		payload = append(payload, val.SignerPubKey[:]...)
 		// 分数
@@ -106,16 +115,13 @@ func buildProposalSigMessage(sigList map[[32]byte]models.Attestation, guarantee
 	return message
 }
 
-// buildRateSig 构建打分签名
-func buildRateSig(round int64, pHash [32]byte, score uint32) ([32]byte, models.Attestation, error) {
-	priKey, pubKey, err := keys.LoadOrCreateKey()
-	if err != nil {
-		return [32]byte{}, models.Attestation{}, fmt.Errorf("failed to get keys: %w", err)
-	}
+// SignRating 构建打分签名，timestamp 为毫秒时间戳，返回签名者 NodeId
+// 同一签名者对同一提案的签名时间戳必须随分数递增，否则构成矛盾打分
+func SignRating(signer keys.Signer, round int64, pHash [32]byte, score uint32, timestamp uint64) ([32]byte, models.Attestation, error) {
+	pubKey := signer.PublicKey()
 
 	// 时间戳
 	var timestampByte [8]byte
-	timestamp := uint64(time.Now().UnixMilli())
 	binary.BigEndian.PutUint64(timestampByte[:], timestamp)
 	// 公钥
 	var pk [32]byte
@@ -139,8 +145,10 @@ func buildRateSig(round int64, pHash [32]byte, score uint32) ([32]byte, models.A
 	sigDataHash := blake3.Sum256(sigData)
 
 	// 签名
-	signature := ed25519.Sign(priKey, sigDataHash[:])
-	keys.Zeroize(priKey)
+	signature, err := signer.Sign(sigDataHash[:])
+	if err != nil {
+		return [32]byte{}, models.Attestation{}, fmt.Errorf("failed to sign: %w", err)
+	}
 
 	var sig [64]byte
 	copy(sig[:], signature)
@@ -154,3 +162,51 @@ func buildRateSig(round int64, pHash [32]byte, score uint32) ([32]byte, models.A
 
 	return blake3.Sum256(pubKey), out, nil
 }
+
+// SignProposal 构建并签名提案，timestamp 为毫秒时间戳，返回提案哈希
+func SignProposal(signer keys.Signer, round int64, payload []byte, proposalTime uint64) ([32]byte, models.ProposalBody, error) {
+	// 获取密钥
+	pubKey := signer.PublicKey()
+	// NodeId
+	myNodeId := blake3.Sum256(pubKey)
+	// 轮次
+	var proposalRound [8]byte
+	binary.BigEndian.PutUint64(proposalRound[:], uint64(round))
+	// 提案时间戳
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], proposalTime)
+	// 标签
+	var PUBLISHV1DomainTag [4]byte
+	binary.BigEndian.PutUint32(PUBLISHV1DomainTag[:], PROPOSERV1Domain)
+
+	// 构建 pHash
+	myProposalData := make([]byte, 0, 8+32+8+len(payload))
+	myProposalData = append(myProposalData, proposalRound[:]...)
+	myProposalData = append(myProposalData, myNodeId[:]...)
+	myProposalData = append(myProposalData, timestamp[:]...)
+	myProposalData = append(myProposalData, payload...)
+	mypHash := blake3.Sum256(myProposalData)
+
+	// 构建发起者签名
+	initiatorData := make([]byte, 0, 4+8+32)
+	initiatorData = append(initiatorData, PUBLISHV1DomainTag[:]...)
+	initiatorData = append(initiatorData, proposalRound[:]...)
+	initiatorData = append(initiatorData, mypHash[:]...)
+	initiatorDataHash := blake3.Sum256(initiatorData)
+	signature, err := signer.Sign(initiatorDataHash[:])
+	if err != nil {
+		return [32]byte{}, models.ProposalBody{}, fmt.Errorf("failed to sign proposal: %w", err)
+	}
+	var initiatorSig [64]byte
+	copy(initiatorSig[:], signature)
+
+	// 构造提案结构体
+	myProposal := models.ProposalBody{
+		ProposerPubKey: [32]byte(pubKey),
+		Payload:        payload,
+		Timestamp:      proposalTime,
+		ProposerSig:    initiatorSig,
+	}
+
+	return mypHash, myProposal, nil
+}
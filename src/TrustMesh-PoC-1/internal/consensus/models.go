@@ -2,10 +2,7 @@ package consensus
 
 // 关键常量
 const (
-	// ScoreBurrs 广播阈值
-	ScoreBurrs = 10
-	// DiffuseHop 传播节点数量（具体逻辑参考代码）
-	DiffuseHop = 100
+	// 广播阈值、传播节点数量与自评分见 config.ConsensusConfig
 
 	// MaxReputation 最大信誉值
 	MaxReputation = 10_000
@@ -16,8 +13,6 @@ const (
 	MaxScore = 10_000
 	// MinScore 最小分数
 	MinScore = 0
-	// MyScore 给自己的评分
-	MyScore = 5_000
 )
 
 const (
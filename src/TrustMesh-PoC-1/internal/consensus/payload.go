@@ -3,6 +3,7 @@ package consensus
 import (
 	"crypto/rand"
 	"fmt"
+	"io"
 	"math/big"
 	"strings"
 )
@@ -16,6 +17,11 @@ var natoWords = []string{
 
 // WordPass returns a random word-based password: e.g. "alpha-hotel-zulu"
 func WordPass(count int) (string, error) {
+	return WordPassFrom(rand.Reader, count)
+}
+
+// WordPassFrom is WordPass drawing randomness from src, so a seeded source gives a reproducible payload
+func WordPassFrom(src io.Reader, count int) (string, error) {
 	if count <= 0 {
 		return "", fmt.Errorf("invalid count %d", count)
 	}
@@ -24,7 +30,7 @@ func WordPass(count int) (string, error) {
 	n := big.NewInt(int64(len(natoWords)))
 
 	for i := 0; i < count; i++ {
-		r, err := rand.Int(rand.Reader, n)
+		r, err := rand.Int(src, n)
 		if err != nil {
 			return "", fmt.Errorf("rand failed: %w", err)
 		}
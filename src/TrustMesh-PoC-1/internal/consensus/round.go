@@ -1,41 +1,83 @@
 package consensus
 
-import "time"
+import (
+	"TrustMesh-PoC-1/internal/clock"
+	"context"
+	"time"
+)
 
-// TimeRoundEngine 根据目标轮次与实际轮次对齐执行时机
-func TimeRoundEngine(interval time.Duration, targetRound int64) chan int64 {
-	ch := make(chan int64)
+// RoundTimer 按轮次边界计时，循环中复用同一个定时器
+// 不能并发使用
+type RoundTimer struct {
+	clock    clock.Clock
+	interval time.Duration
+	timer    clock.Timer
+}
+
+// NewRoundTimer 创建按 c 计时的轮次定时器
+func NewRoundTimer(c clock.Clock, interval time.Duration) *RoundTimer {
+	return &RoundTimer{clock: c, interval: interval}
+}
 
-	go func() {
-		intervalMs := interval.Milliseconds()
+// Stop 停止定时器
+func (t *RoundTimer) Stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
 
-		for {
-			realRound := time.Now().UnixMilli() / intervalMs
+// reset 将定时器改为在 at 到期
+func (t *RoundTimer) reset(at time.Time) <-chan time.Time {
+	d := clock.Until(t.clock, at)
+	if t.timer == nil {
+		t.timer = t.clock.NewTimer(d)
+	} else {
+		t.timer.Reset(d)
+	}
 
-			if targetRound <= realRound {
-				// 目标轮次已过期或正在当前轮 → 直接用当前轮
-				ch <- realRound
-				return
-			}
+	return t.timer.C()
+}
 
-			if targetRound == realRound+1 {
-				// 目标刚好等于下一轮 → 提前启动
-				ch <- targetRound
-				return
-			}
+// TimeRoundEngine 根据目标轮次与实际轮次对齐执行时机，阻塞到应启动的轮次
+// ctx 取消时返回 ctx.Err()
+func (t *RoundTimer) TimeRoundEngine(ctx context.Context, targetRound int64) (int64, error) {
+	for {
+		round, at := AlignRound(t.clock.Now(), t.interval, targetRound)
+		if at.IsZero() {
+			return round, nil
+		}
 
-			// 目标超前超过1轮 → 等到下轮开始
-			nextTime := time.UnixMilli((realRound + 1) * intervalMs)
-			time.Sleep(time.Until(nextTime))
+		select {
+		case <-t.reset(at):
+		case <-ctx.Done():
+			return 0, ctx.Err()
 		}
-	}()
+	}
+}
 
-	return ch
+// AlignRound 在 now 时刻对齐目标轮次，返回应启动的轮次
+// 目标超前超过一轮时 at 为下一轮的开始时间，调用方到时重新对齐；否则 at 为零值，立即启动
+func AlignRound(now time.Time, interval time.Duration, targetRound int64) (int64, time.Time) {
+	intervalMs := interval.Milliseconds()
+	realRound := now.UnixMilli() / intervalMs
+
+	if targetRound <= realRound {
+		// 目标轮次已过期或正在当前轮 → 直接用当前轮
+		return realRound, time.Time{}
+	}
+
+	if targetRound == realRound+1 {
+		// 目标刚好等于下一轮 → 提前启动
+		return targetRound, time.Time{}
+	}
+
+	// 目标超前超过1轮 → 等到下轮开始
+	return realRound, time.UnixMilli((realRound + 1) * intervalMs)
 }
 
 // TimeNextRoundComing 现在是否已经是目标轮次
-func TimeNextRoundComing(interval time.Duration, targetRound int64) bool {
-	round := time.Now().UnixMilli() / interval.Milliseconds()
+func TimeNextRoundComing(c clock.Clock, interval time.Duration, targetRound int64) bool {
+	round := c.Now().UnixMilli() / interval.Milliseconds()
 	if round < targetRound {
 		return false
 	}
@@ -43,27 +85,8 @@ func TimeNextRoundComing(interval time.Duration, targetRound int64) bool {
 	return true
 }
 
-// TimeNextRound 到达目标轮次后 close chan
-func TimeNextRound(interval time.Duration, targetRound int64) chan struct{} {
-	out := make(chan struct{})
-
-	go func() {
-		defer close(out)
-
-		round := time.Now().UnixMilli() / interval.Milliseconds()
-		if round < targetRound {
-			targetTime := time.UnixMilli(targetRound * interval.Milliseconds())
-			timer := time.NewTimer(time.Until(targetTime))
-			defer timer.Stop()
-
-			select {
-			case <-timer.C:
-				return
-			}
-		} else {
-			return
-		}
-	}()
-
-	return out
+// TimeNextRound 返回到达目标轮次时接收时间的通道，已到达时立即可读
+// 再次调用或 Stop 后之前返回的通道不再到期
+func (t *RoundTimer) TimeNextRound(targetRound int64) <-chan time.Time {
+	return t.reset(time.UnixMilli(targetRound * t.interval.Milliseconds()))
 }
@@ -1,7 +1,6 @@
 package consensus
 
 import (
-	"TrustMesh-PoC-1/internal/logger"
 	"TrustMesh-PoC-1/internal/models"
 	"TrustMesh-PoC-1/internal/table"
 	"fmt"
@@ -9,45 +8,45 @@ import (
 	"gorm.io/gorm"
 )
 
-// RateScore 打分
-func RateScore(sigList map[[32]byte]models.Attestation, db *gorm.DB) (uint32, error) {
-	var score uint32 = 0
-	var total uint64
+// LoadReputation 读取节点表的信誉快照，返回各节点的信誉值与总和
+func LoadReputation(db *gorm.DB) (map[[32]byte]uint32, uint64, error) {
+	peers := make([]table.Peer, 0)
+	if err := db.Select("node_id", "reputation").Find(&peers).Error; err != nil {
+		return nil, 0, fmt.Errorf("error reputation statistics failed: %v", err)
+	}
 
-	// 获取总值
-	err := db.Model(&table.Peer{}).
-		Select("COALESCE(SUM(reputation), 0)").
-		Scan(&total).Error
-	if err != nil {
-		return 0, fmt.Errorf("error reputation statistics failed: %v", err)
+	weights := make(map[[32]byte]uint32, len(peers))
+	var total uint64
+	for _, p := range peers {
+		total += uint64(p.Reputation)
+		if len(p.NodeID) != 32 {
+			continue
+		}
+		weights[[32]byte(p.NodeID)] = uint32(p.Reputation)
 	}
 
+	return weights, total, nil
+}
+
+// WeightedScore 打分，每个签名者的分数按其信誉占总信誉的比例加权，不在快照中的签名者不计分
+func WeightedScore(sigList map[[32]byte]models.Attestation, weights map[[32]byte]uint32, total uint64) uint32 {
+	var score uint32 = 0
 	if total == 0 {
-		return 0, fmt.Errorf("all the reputation data are zero")
+		return 0
 	}
 
 	for k, v := range sigList {
-		if v.Score > MaxScore {
-			// TODO: 最大限制
-			// 由于 PoC 的分数可能会经常变动，因此不加最大限制，有溢出风险注意
-			logger.Warning("max score exceeded")
-			//continue
-		}
-
-		var proportion float64
-		var reputation uint32
-		err := db.Model(&table.Peer{}).
-			Select("reputation").
-			Where("node_id = ?", k[:]).
-			Take(&reputation).Error
-		if err != nil {
+		// TODO: 最大限制
+		// 由于 PoC 的分数可能会经常变动，因此不对超过 MaxScore 的分数加限制，有溢出风险注意
+		reputation, ok := weights[k]
+		if !ok {
 			continue
 		}
 
-		proportion = float64(reputation) / float64(total)
+		proportion := float64(reputation) / float64(total)
 
 		score += uint32(float64(v.Score) * proportion)
 	}
 
-	return score, nil
+	return score
 }
@@ -1,24 +1,40 @@
 package consensus
 
 import (
+	"TrustMesh-PoC-1/internal/clock"
 	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/metrics"
 	"TrustMesh-PoC-1/internal/models"
 	"TrustMesh-PoC-1/internal/p2p"
 	"TrustMesh-PoC-1/internal/table"
-	"TrustMesh-PoC-1/internal/tools"
+	"TrustMesh-PoC-1/internal/trace"
+	"context"
 	"crypto/rand"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"net"
 	"time"
-
-	"gorm.io/gorm"
 )
 
+// NewSender 通过连接管理器发送提案的 ProposalSender，节点与模拟器共用
+func NewSender(mainState *models.MainStore) models.ProposalSender {
+	return connSender{mainState: mainState}
+}
+
+// connSender 通过连接管理器向节点表中随机的 DiffuseHop 个节点发送提案
+type connSender struct {
+	mainState *models.MainStore
+}
+
+// SendProposal 见 sendProposal
+func (s connSender) SendProposal(ctx context.Context, rs *models.RoundState, pHash [32]byte) error {
+	return sendProposal(ctx, s.mainState, rs, pHash, s.mainState.Config.Consensus.DiffuseHop)
+}
+
 // sendProposal 发送提案，不允许异步执行
-func sendProposal(mainState *models.MainStore, round int64, proposalHash [32]byte, db *gorm.DB, hop int) error {
-	proposalState := mainState.ProposalSate
-	ct := mainState.ConnectionTable
+// 发送协程随 ctx 一同取消
+func sendProposal(ctx context.Context, mainState *models.MainStore, rs *models.RoundState, proposalHash [32]byte, hop int) error {
+	round := rs.Round
 
 	// 构建问询消息
 	message := make([]byte, 0, 4+8+32)
@@ -35,7 +51,7 @@ func sendProposal(mainState *models.MainStore, round int64, proposalHash [32]byt
 	message = append(message, proposalHash[:]...)
 
 	peers := make([]table.Peer, 0)
-	err := db.
+	err := mainState.DB.
 		Select("node_id").
 		Order("RANDOM()").
 		Limit(hop).
@@ -44,23 +60,9 @@ func sendProposal(mainState *models.MainStore, round int64, proposalHash [32]byt
 		return fmt.Errorf("failed to find peers: %w", err)
 	}
 
-	proposalState.DataLock.RLock()
-	if _, e := proposalState.Data[round][proposalHash]; !e {
-		logger.Error("failed to find proposal state: %v", proposalHash)
+	if !rs.HasProposal(proposalHash) {
+		return ErrProposalNotFound
 	}
-	proposalData := cloneProposalBody(proposalState.Data[round][proposalHash])
-	proposalState.DataLock.RUnlock()
-
-	proposalState.SigLock.RLock()
-	att := cloneAttestationMap(proposalState.Sig[round][proposalHash])
-	proposalState.SigLock.RUnlock()
-
-	proposalState.GuaranteeLock.RLock()
-	gua := cloneGuaranteeMapMap(proposalState.Guarantee[round][proposalHash])
-	proposalState.GuaranteeLock.RUnlock()
-
-	proposalBodyMsg := buildProposalBodyMessage(proposalData, round)
-	proposalSigMsg := buildProposalSigMessage(att, gua, round, proposalHash)
 
 	// 循环发送
 	for _, peer := range peers {
@@ -72,149 +74,143 @@ func sendProposal(mainState *models.MainStore, round int64, proposalHash [32]byt
 			var nodeId [32]byte
 			copy(nodeId[:], peer.NodeID)
 
-			ct.Lock.RLock()
-			ioChan, exists := ct.Connection[nodeId]
-			ct.Lock.RUnlock()
-
-			// 如果没有已有连接就创建
-			if !exists {
-				// 根据节点 ID 查询对方地址
-				var addr string
-				err := db.Model(&table.Peer{}).
-					Select("address").
-					Where("node_id = ?", peer.NodeID).
-					Take(&addr).Error
-				if err != nil {
-					logger.Error(err.Error())
-					return
-				}
-
-				// 连接
-				rawConn, err := net.Dial("tcp", addr)
-				if err != nil {
-					logger.Debug(err.Error())
-					return
-				}
-
-				// 将连接移交给管理函数
-				ready := make(chan [32]byte, 1)
-				go p2p.HandleConnection(rawConn, mainState, ready, true)
-
-				// 等待连接完毕
-				done := make(chan struct{})
-				select {
-				case realID := <-ready:
-					close(done)
-
-					// 检查对方 ID 和指定 ID 是否吻合
-					if realID != nodeId {
-						logger.Debug("The node id is incorrect: %v", realID)
-						return
-					}
-
-					// 重新赋值
-					ct.Lock.RLock()
-					ioChan, exists = ct.Connection[nodeId]
-					ct.Lock.RUnlock()
-
-					if !exists {
-						logger.Debug("The connection is ready but doesn't exist")
-						return
-					}
-				case <-tools.WaitTimeout(done, 5*time.Second):
-					return
-				}
+			// 只发送对方还没有的签名，都已发过时不再联系对方
+			proposalData, att, gua, seq, held, ok := rs.Unsent(proposalHash, nodeId)
+			if !ok || len(att) == 0 {
+				return
 			}
 
-			// 发送消息
+			// 通过连接管理器获取连接，没有已有连接时自动创建
+			ioChan, err := mainState.ConnManager.Acquire(ctx, nodeId)
+			if err != nil {
+				metrics.SendResult(metrics.SendError)
+				logger.Debug("Acquire connection failed: %v", err)
+				return
+			}
+
+			// 等待握手完成
+			readyCtx, cancelReady := clock.WithTimeout(ctx, mainState.Clock, 3*time.Second)
+			defer cancelReady()
 			select {
-			case <-ioChan.Done:
+			case <-ioChan.Ctx.Done():
+				metrics.SendResult(metrics.SendError)
 				logger.Warning("Connection not deleted from ConnectionTable, BUT connection is closed!")
 				return
+			case <-readyCtx.Done():
+				metrics.SendResult(metrics.SendTimeout)
+				return
 			case <-ioChan.Ready:
-				// 生成事务 ID
-				var transaction [32]byte
-				if _, err := rand.Read(transaction[:]); err != nil {
-					logger.Error("Get nonce failed: %v", err)
-					return
-				}
-
-				sendMessage := message
-				sendMessage = append(sendMessage, transaction[:]...)
-
-				// 注册清理逻辑
-				defer func() {
-					ioChan.ChannelsLock.Lock()
-					delete(ioChan.Channels, transaction)
-					ioChan.ChannelsLock.Unlock()
-				}()
-
-				// 写入返回通道
-				isHave := make(chan []byte, 1)
-				ioChan.ChannelsLock.Lock()
-				ioChan.Channels[transaction] = isHave
-				ioChan.ChannelsLock.Unlock()
-
-				// 发送消息
-				{
-					ok := make(chan struct{})
-					select {
-					case ioChan.WriteQueue <- sendMessage:
-						close(ok)
-					case <-tools.WaitTimeout(ok, 3*time.Second):
-						logger.Debug("Send 'proposal is have?' timeout!")
-						return
-					}
-				}
-
-				// 等待返回消息
-				ok := make(chan struct{})
-				select {
-				case b := <-isHave:
-					close(ok)
-
-					// 检查返回长度防止 panic
-					if len(b) < 4 {
-						logger.Debug("The length of isHave is incorrect! Actual length: %v", len(b))
-						return
-					}
-
-					// 发送提案本体
-					reply := binary.BigEndian.Uint32(b)
-					if reply == p2p.TrueOrYes {
-						logger.Test("remote node already have")
-					} else if reply == p2p.RefuseOrNoNeed {
-						logger.Test("remote node refuse")
-						return
-					} else if reply == p2p.FalseOrNo {
-						logger.Test("remote node need")
-						done := make(chan struct{})
-						select {
-						case ioChan.WriteQueue <- proposalBodyMsg:
-							close(done)
-						case <-tools.WaitTimeout(done, 3*time.Second):
-							return
-						}
-					} else {
-						logger.Debug("The field of isHave is incorrect")
-						return
-					}
-
-					// 发送签名集
-					done := make(chan struct{})
-					select {
-					case ioChan.WriteQueue <- proposalSigMsg:
-						close(done)
-					case <-tools.WaitTimeout(done, 5*time.Second):
-						return
-					}
-				case <-tools.WaitTimeout(ok, 10*time.Second):
-					logger.Debug("Wait 'proposal is have?' reply timeout!")
-					return
-				}
+			}
+
+			// 本次投递的追踪上下文
+			tc := mainState.Tracer.Outgoing(round, proposalHash)
+
+			// 对方已持有提案本体时不再问询
+			if held {
+				metrics.SendResult(metrics.SendHave)
+			} else if !inquire(ctx, mainState, ioChan, message, proposalData, round, tc) {
+				return
+			}
+
+			// 发送签名集
+			proposalSigMsg := BuildProposalSigMessage(att, gua, round, proposalHash, tc)
+			if p2p.Enqueue(ctx, ioChan, proposalSigMsg, 5*time.Second) {
+				rs.Delivered(proposalHash, nodeId, seq)
 			}
 		}()
 	}
 
 	return nil
 }
+
+// inquire 问询对方是否已有提案，需要时发送提案本体，返回是否继续发送签名集
+func inquire(ctx context.Context, mainState *models.MainStore, ioChan *models.IOChannel, message []byte, proposalData models.ProposalBody, round int64, tc *trace.Context) bool {
+	// 生成事务 ID
+	var transaction [32]byte
+	if _, err := rand.Read(transaction[:]); err != nil {
+		logger.Error("Get nonce failed: %v", err)
+		return false
+	}
+
+	sendMessage := append(message[:len(message):len(message)], transaction[:]...)
+
+	// 注册清理逻辑
+	defer func() {
+		ioChan.ChannelsLock.Lock()
+		delete(ioChan.Channels, transaction)
+		ioChan.ChannelsLock.Unlock()
+	}()
+
+	// 写入返回通道
+	isHave := make(chan []byte, 1)
+	ioChan.ChannelsLock.Lock()
+	ioChan.Channels[transaction] = isHave
+	ioChan.ChannelsLock.Unlock()
+
+	// 发送消息
+	if !p2p.Enqueue(ctx, ioChan, sendMessage, 3*time.Second) {
+		metrics.SendResult(metrics.SendTimeout)
+		logger.Debug("Send 'proposal is have?' timeout!")
+		return false
+	}
+
+	// 等待返回消息
+	replyCtx, cancelReply := clock.WithTimeout(ctx, mainState.Clock, 10*time.Second)
+	defer cancelReply()
+
+	var b []byte
+	select {
+	case b = <-isHave:
+	case <-ioChan.Ctx.Done():
+		metrics.SendResult(metrics.SendError)
+		return false
+	case <-replyCtx.Done():
+		metrics.SendResult(metrics.SendTimeout)
+		logger.Debug("Wait 'proposal is have?' reply timeout!")
+		return false
+	}
+
+	// 检查返回长度防止 panic
+	if len(b) < 4 {
+		metrics.SendResult(metrics.SendError)
+		logger.Debug("The length of isHave is incorrect! Actual length: %v", len(b))
+		return false
+	}
+
+	// 发送提案本体
+	reply := binary.BigEndian.Uint32(b)
+	if reply == p2p.TrueOrYes {
+		metrics.SendResult(metrics.SendHave)
+		logger.Test("remote node already have")
+	} else if reply == p2p.RefuseOrNoNeed {
+		metrics.SendResult(metrics.SendRefuse)
+		logger.Test("remote node refuse")
+		return false
+	} else if reply == p2p.FalseOrNo {
+		metrics.SendResult(metrics.SendNeed)
+		logger.Test("remote node need")
+		proposalBodyMsg := BuildProposalBodyMessage(proposalData, round, tc)
+		if !p2p.Enqueue(ctx, ioChan, proposalBodyMsg, 3*time.Second) {
+			return false
+		}
+	} else {
+		metrics.SendResult(metrics.SendError)
+		logger.Debug("The field of isHave is incorrect")
+		return false
+	}
+
+	return true
+}
+
+// ErrProposalNotFound 活跃轮次中没有该提案
+var ErrProposalNotFound = errors.New("proposal not found in active rounds")
+
+// Resend 在活跃轮次中查找提案并重新广播，返回提案所在轮次
+func Resend(ctx context.Context, mainState *models.MainStore, proposalHash [32]byte) (int64, error) {
+	rs, ok := mainState.ProposalSate.Find(proposalHash)
+	if !ok {
+		return 0, ErrProposalNotFound
+	}
+
+	return rs.Round, mainState.Sender.SendProposal(ctx, rs, proposalHash)
+}
@@ -1,7 +1,6 @@
 package consensus
 
 import (
-	"TrustMesh-PoC-1/internal/constants"
 	"TrustMesh-PoC-1/internal/models"
 	"TrustMesh-PoC-1/internal/table"
 	"encoding/hex"
@@ -22,61 +21,28 @@ type storedProposal struct {
 	ProposerSig    string `json:"proposer_sig"`
 }
 
-func cloneAttestationMap(src map[[32]byte]models.Attestation) map[[32]byte]models.Attestation {
-	dst := make(map[[32]byte]models.Attestation, len(src))
-	for k, v := range src {
-		dst[k] = v
-	}
-	return dst
-}
-
-func cloneGuaranteeMapMap(src map[[32]byte]map[[32]byte]models.Guarantee) map[[32]byte]map[[32]byte]models.Guarantee {
-	dst := make(map[[32]byte]map[[32]byte]models.Guarantee, len(src))
-
-	for outerKey, innerMap := range src {
-		if innerMap == nil {
-			dst[outerKey] = nil
-			continue
-		}
-
-		copiedInner := make(map[[32]byte]models.Guarantee, len(innerMap))
-		for innerKey, guarantee := range innerMap {
-			copiedInner[innerKey] = guarantee
-		}
-
-		dst[outerKey] = copiedInner
-	}
-
-	return dst
+func proposalPath(dir string) string {
+	path := filepath.Join(dir, "block")
+	return path
 }
 
-func cloneProposalBody(src models.ProposalBody) models.ProposalBody {
-	dst := models.ProposalBody{
-		ProposerPubKey: src.ProposerPubKey,
-		Timestamp:      src.Timestamp,
-		ProposerSig:    src.ProposerSig,
-	}
-
-	// 对 Payload 做深拷贝
-	if src.Payload != nil {
-		dst.Payload = make([]byte, len(src.Payload))
-		copy(dst.Payload, src.Payload)
-	}
-
-	return dst
+// WinnerProposal 将胜出提案写入 <dir>/block/<round>.json
+func WinnerProposal(dir string, p models.ProposalBody, round int64) error {
+	return writeProposal(dir, p, fmt.Sprintf("%d.json", round))
 }
 
-func proposalPath() string {
-	path := filepath.Join(constants.ConfigDir, "block")
-	return path
+// checkpointProposal 轮次被中断时保存当前领先的提案
+func checkpointProposal(dir string, p models.ProposalBody, round int64) error {
+	return writeProposal(dir, p, fmt.Sprintf("%d.checkpoint.json", round))
 }
 
-func winnerProposal(p models.ProposalBody, round int64) error {
+// writeProposal 将提案写入区块目录
+func writeProposal(dir string, p models.ProposalBody, name string) error {
 	// 转换
 	stored := storedProposal{
 		ProposerPubKey: hex.EncodeToString(p.ProposerPubKey[:]),
 		Payload:        string(p.Payload),
-		Timestamp:      time.UnixMilli(int64(p.Timestamp)).UTC().Format(time.RFC3339),
+		Timestamp:      time.UnixMilli(int64(p.Timestamp)).UTC().Format(time.RFC3339Nano),
 		ProposerSig:    hex.EncodeToString(p.ProposerSig[:]),
 	}
 
@@ -87,12 +53,12 @@ func winnerProposal(p models.ProposalBody, round int64) error {
 	}
 
 	// 确保目录存在
-	if err := os.MkdirAll(proposalPath(), 0o755); err != nil {
+	if err := os.MkdirAll(proposalPath(dir), 0o755); err != nil {
 		return fmt.Errorf("mkdir failed: %w", err)
 	}
 
 	// 文件路径
-	filePath := filepath.Join(proposalPath(), fmt.Sprintf("%d.json", round))
+	filePath := filepath.Join(proposalPath(dir), name)
 
 	// 写入文件
 	if err := os.WriteFile(filePath, data, 0o644); err != nil {
@@ -102,7 +68,8 @@ func winnerProposal(p models.ProposalBody, round int64) error {
 	return nil
 }
 
-func randomReputation(r *rand.Rand) uint32 {
+// RandomReputation 按截断正态分布生成一个信誉值
+func RandomReputation(r *rand.Rand) uint32 {
 	mean := 5000.0
 	sigma := 1500.0
 	lower, upper := MinReputation, MaxReputation
@@ -115,7 +82,7 @@ func randomReputation(r *rand.Rand) uint32 {
 	}
 }
 
-// RandomDBReputation 随机数据库信誉值
+// RandomDBReputation 随机数据库信誉值，并扣除节点累计的惩罚
 func RandomDBReputation(db *gorm.DB) error {
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 
@@ -134,7 +101,8 @@ func RandomDBReputation(db *gorm.DB) error {
 		}
 
 		for j := i; j < end; j++ {
-			newRep := randomReputation(r)
+			newRep := RandomReputation(r)
+			newRep -= min(newRep, uint32(peers[j].Penalty))
 
 			if err := db.Model(&peers[j]).Update("reputation", newRep).Error; err != nil {
 				return err
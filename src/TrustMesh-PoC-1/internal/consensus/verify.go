@@ -0,0 +1,90 @@
+package consensus
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+// BlockDir 区块文件目录
+func BlockDir(dir string) string {
+	return proposalPath(dir)
+}
+
+// VerifyBlockFile 校验区块文件的格式与提案者签名，返回文件对应的轮次
+// 文件名为 <round>.json 或 <round>.checkpoint.json
+func VerifyBlockFile(path string) (int64, error) {
+	// 轮次
+	name := filepath.Base(path)
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".json"), ".checkpoint")
+	round, err := strconv.ParseInt(name, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid block file name: %s", filepath.Base(path))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return round, err
+	}
+
+	var stored storedProposal
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return round, fmt.Errorf("json unmarshal failed: %w", err)
+	}
+
+	// 字段
+	pk, err := hex.DecodeString(stored.ProposerPubKey)
+	if err != nil || len(pk) != ed25519.PublicKeySize {
+		return round, errors.New("invalid proposer_pub_key")
+	}
+	sig, err := hex.DecodeString(stored.ProposerSig)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return round, errors.New("invalid proposer_sig")
+	}
+	ts, err := time.Parse(time.RFC3339Nano, stored.Timestamp)
+	if err != nil {
+		return round, fmt.Errorf("invalid timestamp: %w", err)
+	}
+
+	// 轮次
+	var proposalRound [8]byte
+	binary.BigEndian.PutUint64(proposalRound[:], uint64(round))
+	// 提案时间戳
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], uint64(ts.UnixMilli()))
+	// 标签
+	var PUBLISHV1DomainTag [4]byte
+	binary.BigEndian.PutUint32(PUBLISHV1DomainTag[:], PROPOSERV1Domain)
+
+	// 构建 pHash
+	nodeId := blake3.Sum256(pk)
+	proposalData := make([]byte, 0, 8+32+8+len(stored.Payload))
+	proposalData = append(proposalData, proposalRound[:]...)
+	proposalData = append(proposalData, nodeId[:]...)
+	proposalData = append(proposalData, timestamp[:]...)
+	proposalData = append(proposalData, stored.Payload...)
+	pHash := blake3.Sum256(proposalData)
+
+	// 发起者签名
+	initiatorData := make([]byte, 0, 4+8+32)
+	initiatorData = append(initiatorData, PUBLISHV1DomainTag[:]...)
+	initiatorData = append(initiatorData, proposalRound[:]...)
+	initiatorData = append(initiatorData, pHash[:]...)
+	initiatorDataHash := blake3.Sum256(initiatorData)
+
+	if !ed25519.Verify(pk, initiatorDataHash[:], sig) {
+		return round, errors.New("proposer signature verification failed")
+	}
+
+	return round, nil
+}
@@ -1,4 +1,4 @@
 package constants
 
-// ConfigDir 程序数据目录
-const ConfigDir = "/data"
+// DefaultConfigDir 默认程序数据目录，可通过配置 data_dir 修改
+const DefaultConfigDir = "/data"
@@ -0,0 +1,10 @@
+package constants
+
+// MaxPayloadSize 提案载荷上限
+const MaxPayloadSize = 1 << 20
+
+// MaxSigners 单条签名集消息中的签名者上限
+const MaxSigners = 8192
+
+// MaxMessageSize 单条消息的上限，连接的字节突发量不能小于该值
+const MaxMessageSize = 2 << 20
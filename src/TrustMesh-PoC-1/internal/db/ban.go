@@ -0,0 +1,53 @@
+package db
+
+import (
+	"TrustMesh-PoC-1/internal/table"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 封禁对象类型
+const (
+	BanNode = "node"
+	BanIP   = "ip"
+)
+
+// SaveBan 写入封禁表，已存在时覆盖解封时间与原因，until 为零值表示永久
+func SaveBan(database *gorm.DB, kind string, target []byte, until time.Time, reason string) error {
+	ban := table.Ban{
+		Kind:    kind,
+		Target:  target,
+		Reason:  reason,
+		Created: uint64(time.Now().UnixMilli()),
+	}
+	if !until.IsZero() {
+		ban.Until = uint64(until.UnixMilli())
+	}
+
+	return database.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "kind"}, {Name: "target"}},
+		DoUpdates: clause.AssignmentColumns([]string{"until", "reason", "created"}),
+	}).Create(&ban).Error
+}
+
+// DeleteBan 删除封禁记录
+func DeleteBan(database *gorm.DB, kind string, target []byte) error {
+	return database.Where("kind = ? AND target = ?", kind, target).Delete(&table.Ban{}).Error
+}
+
+// ActiveBans 删除已过期的封禁并返回其余记录
+func ActiveBans(database *gorm.DB) ([]table.Ban, error) {
+	now := uint64(time.Now().UnixMilli())
+	if err := database.Where("until != 0 AND until <= ?", now).Delete(&table.Ban{}).Error; err != nil {
+		return nil, err
+	}
+
+	bans := make([]table.Ban, 0)
+	if err := database.Find(&bans).Error; err != nil {
+		return nil, err
+	}
+
+	return bans, nil
+}
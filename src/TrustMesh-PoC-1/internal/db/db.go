@@ -1,12 +1,10 @@
 package db
 
 import (
-	"TrustMesh-PoC-1/internal/constants"
 	"TrustMesh-PoC-1/internal/table"
 	"log"
 	"os"
 	"path/filepath"
-	"sync"
 	"time"
 
 	"github.com/glebarez/sqlite"
@@ -14,64 +12,99 @@ import (
 	"gorm.io/gorm/logger"
 )
 
-// 包级变量
-var (
-	instance *gorm.DB
-	once     sync.Once
-)
-
 // Path 数据库文件路径
-func Path() string {
-	path := filepath.Join(constants.ConfigDir, "data.db")
+func Path(dir string) string {
+	path := filepath.Join(dir, "data.db")
 	return path
 }
 
-// GetDB 获取数据库对象，*必须* 先进行初始化
-func GetDB() *gorm.DB {
-	return instance
+// InitDB 打开数据目录中的数据库，dir 为数据目录
+func InitDB(dir string) (*gorm.DB, error) {
+	return Open(Path(dir))
 }
 
-// InitDB 初始化数据库对象
-func InitDB() (*gorm.DB, error) {
-	var errMsg error = nil
-
-	once.Do(func() {
-		// 日志配置
-		newLogger := logger.New(
-			log.New(os.Stdout, "[GORM] ", log.LstdFlags),
-			logger.Config{
-				SlowThreshold:             time.Second,  // Slow SQL threshold
-				LogLevel:                  logger.Error, // Log level
-				IgnoreRecordNotFoundError: true,         // Ignore ErrRecordNotFound error for logger
-				ParameterizedQueries:      true,         // Don't include params in the SQL log
-				Colorful:                  false,        // Disable color
-			},
-		)
-
-		// 连接数据库
-		instance, errMsg = gorm.Open(sqlite.Open(Path()), &gorm.Config{
-			Logger: newLogger,
-		})
-
-		if errMsg != nil {
-			return
-		}
+// Open 打开 path 处的数据库并创建表结构，path 为 ":memory:" 时使用内存数据库
+// 只使用一个连接，内存数据库在关闭前一直有效
+func Open(path string) (*gorm.DB, error) {
+	// 日志配置
+	newLogger := logger.New(
+		log.New(os.Stdout, "[GORM] ", log.LstdFlags),
+		logger.Config{
+			SlowThreshold:             time.Second,  // Slow SQL threshold
+			LogLevel:                  logger.Error, // Log level
+			IgnoreRecordNotFoundError: true,         // Ignore ErrRecordNotFound error for logger
+			ParameterizedQueries:      true,         // Don't include params in the SQL log
+			Colorful:                  false,        // Disable color
+		},
+	)
+
+	// 连接数据库
+	database, err := gorm.Open(sqlite.Open(path), &gorm.Config{
+		Logger: newLogger,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := database.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetMaxIdleConns(1)
+
+	// 创建表结构
+	if err := database.AutoMigrate(&table.Peer{}, &table.PeerAddress{}, &table.Ban{}, &table.Evidence{}); err != nil {
+		_ = sqlDB.Close()
+		return nil, err
+	}
+	if err := migrateLegacyPeers(database); err != nil {
+		_ = sqlDB.Close()
+		return nil, err
+	}
 
-		sqlDB, err := instance.DB()
+	return database, nil
+}
+
+// migrateLegacyPeers 将旧版节点表中的地址列迁移到地址表，并删除地址列及其唯一索引
+func migrateLegacyPeers(database *gorm.DB) error {
+	migrator := database.Migrator()
+	if !migrator.HasColumn(&table.Peer{}, "address") {
+		return nil
+	}
+
+	return database.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`INSERT OR IGNORE INTO peer_addresses (node_id, address, last_success, last_failure, failures)
+			SELECT node_id, address, last_seen, 0, 0 FROM peers WHERE address <> ''`).Error
 		if err != nil {
-			errMsg = err
-			return
+			return err
 		}
 
-		sqlDB.SetMaxOpenConns(1)
-		sqlDB.SetMaxIdleConns(1)
-
-		// 创建表结构
-		errMsg = instance.AutoMigrate(&table.Peer{})
-		if errMsg != nil {
-			return
+		m := tx.Migrator()
+		for _, name := range []string{"idx_node_addr", "idx_node_id_addr"} {
+			if m.HasIndex(&table.Peer{}, name) {
+				if err := m.DropIndex(&table.Peer{}, name); err != nil {
+					return err
+				}
+			}
 		}
+
+		// 直接 ALTER TABLE，避免重建表时丢失其余索引
+		return tx.Exec("ALTER TABLE peers DROP COLUMN address").Error
 	})
+}
+
+// Close 关闭数据库，确保数据落盘
+func Close(database *gorm.DB) error {
+	if database == nil {
+		return nil
+	}
+
+	sqlDB, err := database.DB()
+	if err != nil {
+		return err
+	}
 
-	return instance, errMsg
+	return sqlDB.Close()
 }
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"TrustMesh-PoC-1/internal/table"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SaveEvidence 写入证据表，同一违规者、轮次与类型已有记录时不写入并返回 false
+func SaveEvidence(database *gorm.DB, kind string, nodeId [32]byte, round int64, data []byte) (bool, error) {
+	evidence := table.Evidence{
+		Kind:    kind,
+		NodeID:  nodeId[:],
+		Round:   round,
+		Data:    data,
+		Created: uint64(time.Now().UnixMilli()),
+	}
+
+	result := database.Clauses(clause.OnConflict{DoNothing: true}).Create(&evidence)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
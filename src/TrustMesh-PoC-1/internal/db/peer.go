@@ -0,0 +1,180 @@
+package db
+
+import (
+	"TrustMesh-PoC-1/internal/maddr"
+	"TrustMesh-PoC-1/internal/table"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SavePeer 写入节点表，并将地址追加到该节点的地址表中
+func SavePeer(database *gorm.DB, nodeId [32]byte, address string, status string) error {
+	now := uint64(time.Now().UnixMilli())
+
+	peer := table.Peer{
+		NodeID:     nodeId[:],
+		Reputation: 0,
+		LastSeen:   now,
+		Status:     status,
+	}
+
+	err := database.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "node_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_seen", "status"}),
+	}).Create(&peer).Error
+	if err != nil {
+		return err
+	}
+
+	// 写入前都经过握手验证，视为一次成功
+	return RecordDial(database, nodeId, address, true)
+}
+
+// RecordDial 记录一次对指定地址的拨号结果
+func RecordDial(database *gorm.DB, nodeId [32]byte, address string, ok bool) error {
+	now := uint64(time.Now().UnixMilli())
+
+	addr := table.PeerAddress{
+		NodeID:  nodeId[:],
+		Address: maddr.Normalize(address),
+	}
+	columns := []string{"last_success", "failures"}
+	if ok {
+		addr.LastSuccess = now
+	} else {
+		addr.LastFailure = now
+		addr.Failures = 1
+		columns = []string{"last_failure"}
+	}
+
+	assignments := clause.AssignmentColumns(columns)
+	if !ok {
+		assignments = append(assignments, clause.Assignment{
+			Column: clause.Column{Name: "failures"},
+			Value:  gorm.Expr("failures + 1"),
+		})
+	}
+
+	return database.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "node_id"}, {Name: "address"}},
+		DoUpdates: assignments,
+	}).Create(&addr).Error
+}
+
+// PeerAddresses 按最近成功时间排序返回节点的全部地址
+// 从未成功过的地址排在后面，其中最近失败的排在最后
+func PeerAddresses(database *gorm.DB, nodeId [32]byte) ([]string, error) {
+	addrs := make([]string, 0)
+	err := database.Model(&table.PeerAddress{}).
+		Select("address").
+		Where("node_id = ?", nodeId[:]).
+		Order("last_success DESC").
+		Order("last_failure ASC").
+		Find(&addrs).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, ErrNoAddress
+	}
+
+	return addrs, nil
+}
+
+// BestAddress 返回节点最近成功的地址
+func BestAddress(database *gorm.DB, nodeId [32]byte) (string, error) {
+	addrs, err := PeerAddresses(database, nodeId)
+	if err != nil {
+		return "", err
+	}
+
+	return addrs[0], nil
+}
+
+// RotatePeer 将旧 NodeId 的节点记录与地址迁移到新 NodeId，新记录已存在时保留新记录
+func RotatePeer(database *gorm.DB, oldId [32]byte, newId [32]byte) error {
+	return database.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&table.Peer{}).Where("node_id = ?", newId[:]).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			if err := tx.Where("node_id = ?", oldId[:]).Delete(&table.Peer{}).Error; err != nil {
+				return err
+			}
+		} else {
+			if err := tx.Model(&table.Peer{}).Where("node_id = ?", oldId[:]).Update("node_id", newId[:]).Error; err != nil {
+				return err
+			}
+		}
+
+		// 地址逐条迁移，已存在的地址保留新记录的统计
+		addrs := make([]table.PeerAddress, 0)
+		if err := tx.Where("node_id = ?", oldId[:]).Find(&addrs).Error; err != nil {
+			return err
+		}
+		for _, a := range addrs {
+			moved := table.PeerAddress{
+				NodeID:      newId[:],
+				Address:     a.Address,
+				LastSuccess: a.LastSuccess,
+				LastFailure: a.LastFailure,
+				Failures:    a.Failures,
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&moved).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Where("node_id = ?", oldId[:]).Delete(&table.PeerAddress{}).Error
+	})
+}
+
+// ErrPeerNotFound 节点表中没有该节点
+var ErrPeerNotFound = errors.New("peer not found")
+
+// ErrNoAddress 地址表中没有该节点的地址
+var ErrNoAddress = errors.New("peer has no address")
+
+// HasPeer 节点表中是否有该节点
+func HasPeer(database *gorm.DB, nodeId [32]byte) (bool, error) {
+	var count int64
+	err := database.Model(&table.Peer{}).Where("node_id = ?", nodeId[:]).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// SetReputation 设置节点信誉值
+func SetReputation(database *gorm.DB, nodeId [32]byte, reputation uint16) error {
+	result := database.Model(&table.Peer{}).Where("node_id = ?", nodeId[:]).Update("reputation", reputation)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPeerNotFound
+	}
+
+	return nil
+}
+
+// PenalizePeer 扣除节点信誉值并累计惩罚，两者都在 [0, maxReputation] 内饱和
+func PenalizePeer(database *gorm.DB, nodeId [32]byte, amount uint16, maxReputation uint16) error {
+	result := database.Model(&table.Peer{}).Where("node_id = ?", nodeId[:]).Updates(map[string]any{
+		"reputation": gorm.Expr("MAX(CAST(reputation AS INTEGER) - ?, 0)", amount),
+		"penalty":    gorm.Expr("MIN(CAST(penalty AS INTEGER) + ?, ?)", amount, maxReputation),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPeerNotFound
+	}
+
+	return nil
+}
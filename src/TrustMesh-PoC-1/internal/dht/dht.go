@@ -0,0 +1,112 @@
+package dht
+
+import (
+	"TrustMesh-PoC-1/internal/db"
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/models"
+	"TrustMesh-PoC-1/internal/table"
+	"context"
+	"crypto/rand"
+	"time"
+)
+
+const (
+	// refreshInterval 路由表刷新间隔
+	refreshInterval = 60 * time.Second
+	// seedLimit 每次从节点表载入的种子数量
+	seedLimit = 256
+)
+
+// seedFromPeers 从节点表载入联系人
+func seedFromPeers(mainState *models.MainStore) {
+	peers := make([]table.Peer, 0, seedLimit)
+	err := mainState.DB.
+		Select("node_id", "last_seen").
+		Order("RANDOM()").
+		Limit(seedLimit).
+		Find(&peers).Error
+	if err != nil {
+		logger.Error("Failed to find peers: %v", err)
+		return
+	}
+
+	for _, peer := range peers {
+		if len(peer.NodeID) != 32 {
+			continue
+		}
+		var c models.Contact
+		copy(c.NodeId[:], peer.NodeID)
+		addr, err := db.BestAddress(mainState.DB, c.NodeId)
+		if err != nil {
+			continue
+		}
+		c.Address = addr
+		c.LastSeen = time.UnixMilli(int64(peer.LastSeen))
+		mainState.RoutingTable.Add(c)
+	}
+}
+
+// seedFromAddrs 拨号种子地址并将其加入路由表
+func seedFromAddrs(ctx context.Context, mainState *models.MainStore, seeds []string) {
+	for _, addr := range seeds {
+		nodeId, err := mainState.ConnManager.Connect(ctx, addr, [32]byte{})
+		if err != nil {
+			logger.Debug("Dht seed %v failed: %v", addr, err)
+			continue
+		}
+		mainState.RoutingTable.Add(models.Contact{NodeId: nodeId, Address: addr})
+	}
+}
+
+// randomTarget 在指定 bucket 范围内生成随机目标
+func randomTarget(self [32]byte, bucket int) [32]byte {
+	var out [32]byte
+	if _, err := rand.Read(out[:]); err != nil {
+		return self
+	}
+
+	// 保留前 bucket 位与 self 相同，第 bucket 位取反
+	byteIdx, bitIdx := bucket/8, uint(bucket%8)
+	copy(out[:byteIdx], self[:byteIdx])
+	mask := byte(0xFF) << (8 - bitIdx)
+	flip := byte(0x80) >> bitIdx
+	out[byteIdx] = (self[byteIdx] & mask) | (^self[byteIdx] & flip) | (out[byteIdx] &^ (mask | flip))
+
+	return out
+}
+
+// refresh 查找自身并随机刷新一个 bucket
+func refresh(ctx context.Context, mainState *models.MainStore, seeds []string) {
+	rt := mainState.RoutingTable
+
+	if rt.Size() < models.BucketSize {
+		seedFromPeers(mainState)
+		seedFromAddrs(ctx, mainState, seeds)
+	}
+
+	found := Lookup(ctx, mainState, rt.Self)
+	logger.Debug("Dht self lookup found %v nodes, routing table size: %v", len(found), rt.Size())
+
+	var b [1]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return
+	}
+	// 只刷新前 64 个 bucket，更深的 bucket 在小网络中几乎为空
+	Lookup(ctx, mainState, randomTarget(rt.Self, int(b[0])%64))
+}
+
+// Run 维护路由表，阻塞运行直到 ctx 取消
+func Run(ctx context.Context, mainState *models.MainStore, seeds []string) {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		refresh(ctx, mainState, seeds)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package dht
+
+import (
+	"TrustMesh-PoC-1/internal/db"
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/models"
+	"TrustMesh-PoC-1/internal/p2p"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// Alpha 迭代查找的并发度
+	Alpha = 3
+	// queryTimeout 单次查询超时
+	queryTimeout = 5 * time.Second
+)
+
+// connectContact 获取到联系人的连接，未连接时按地址拨号并校验 NodeId
+func connectContact(ctx context.Context, mainState *models.MainStore, c models.Contact) (*models.IOChannel, error) {
+	ct := mainState.ConnectionTable
+
+	ct.Lock.RLock()
+	ioc, exists := ct.Connection[c.NodeId]
+	ct.Lock.RUnlock()
+
+	if exists {
+		select {
+		case <-ioc.Ctx.Done():
+		default:
+			return ioc, nil
+		}
+	}
+
+	if _, err := mainState.ConnManager.Connect(ctx, c.Address, c.NodeId); err != nil {
+		return nil, err
+	}
+
+	return mainState.ConnManager.Acquire(ctx, c.NodeId)
+}
+
+// queryNode 向联系人发送 FIND_NODE 并等待回复
+func queryNode(ctx context.Context, mainState *models.MainStore, c models.Contact, target [32]byte) ([]models.Contact, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	ioc, err := connectContact(ctx, mainState, c)
+	if err != nil {
+		return nil, err
+	}
+
+	// 生成事务 ID
+	var transaction [32]byte
+	if _, err := rand.Read(transaction[:]); err != nil {
+		return nil, fmt.Errorf("get nonce failed: %w", err)
+	}
+
+	// 写入返回通道
+	reply := make(chan []byte, 1)
+	ioc.ChannelsLock.Lock()
+	ioc.Channels[transaction] = reply
+	ioc.ChannelsLock.Unlock()
+
+	// 注册清理逻辑
+	defer func() {
+		ioc.ChannelsLock.Lock()
+		delete(ioc.Channels, transaction)
+		ioc.ChannelsLock.Unlock()
+	}()
+
+	// 发送请求
+	select {
+	case ioc.WriteQueue <- p2p.BuildFindNode(target, transaction):
+	case <-ioc.Ctx.Done():
+		return nil, errors.New("connection is closed")
+	case <-ctx.Done():
+		return nil, fmt.Errorf("send find node: %w", ctx.Err())
+	}
+
+	// 等待回复
+	select {
+	case b := <-reply:
+		records := p2p.ParseFindNodeReply(b)
+		out := make([]models.Contact, 0, len(records))
+		for _, r := range records {
+			out = append(out, models.Contact{NodeId: r.NodeId, Address: r.Address})
+		}
+		return out, nil
+	case <-ioc.Ctx.Done():
+		return nil, errors.New("connection is closed")
+	case <-ctx.Done():
+		return nil, fmt.Errorf("wait find node reply: %w", ctx.Err())
+	}
+}
+
+// savePeer 将已验证的联系人写入路由表和节点表
+func savePeer(mainState *models.MainStore, c models.Contact) {
+	c.LastSeen = time.Now()
+	mainState.RoutingTable.Add(c)
+
+	err := db.SavePeer(mainState.DB, c.NodeId, c.Address, "FROM Dht")
+	if err != nil {
+		logger.Error("Failed to save peer: %v", err)
+	}
+}
+
+// Lookup 迭代查找距离 target 最近的 k 个节点，返回成功应答的联系人
+func Lookup(ctx context.Context, mainState *models.MainStore, target [32]byte) []models.Contact {
+	rt := mainState.RoutingTable
+
+	shortlist := rt.Closest(target, models.BucketSize)
+	seen := make(map[[32]byte]bool, len(shortlist))
+	for _, c := range shortlist {
+		seen[c.NodeId] = true
+	}
+	queried := make(map[[32]byte]bool)
+	responded := make([]models.Contact, 0, models.BucketSize)
+
+	for {
+		// 选取最近的 k 个中尚未查询的 alpha 个
+		models.SortByDistance(shortlist, target)
+		batch := make([]models.Contact, 0, Alpha)
+		for i := 0; i < len(shortlist) && i < models.BucketSize && len(batch) < Alpha; i++ {
+			if !queried[shortlist[i].NodeId] {
+				batch = append(batch, shortlist[i])
+				queried[shortlist[i].NodeId] = true
+			}
+		}
+		if len(batch) == 0 || ctx.Err() != nil {
+			break
+		}
+
+		// 并发查询
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		failed := make(map[[32]byte]bool)
+		for _, c := range batch {
+			wg.Add(1)
+			go func(c models.Contact) {
+				defer wg.Done()
+
+				found, err := queryNode(ctx, mainState, c, target)
+				if err != nil && ctx.Err() != nil {
+					// 整体查找被取消，不代表联系人失效
+					return
+				}
+				if err != nil {
+					logger.Test("Find node from %v failed: %v", c.NodeId, err)
+					rt.Remove(c.NodeId)
+					mu.Lock()
+					failed[c.NodeId] = true
+					mu.Unlock()
+					return
+				}
+				savePeer(mainState, c)
+
+				mu.Lock()
+				responded = append(responded, c)
+				for _, f := range found {
+					if f.NodeId == rt.Self || seen[f.NodeId] {
+						continue
+					}
+					seen[f.NodeId] = true
+					shortlist = append(shortlist, f)
+				}
+				mu.Unlock()
+			}(c)
+		}
+		wg.Wait()
+
+		// 移除失败的联系人
+		if len(failed) > 0 {
+			kept := shortlist[:0]
+			for _, c := range shortlist {
+				if !failed[c.NodeId] {
+					kept = append(kept, c)
+				}
+			}
+			shortlist = kept
+		}
+	}
+
+	models.SortByDistance(responded, target)
+	if len(responded) > models.BucketSize {
+		responded = responded[:models.BucketSize]
+	}
+
+	return responded
+}
+
+// FindNode 在网络中查找指定 NodeId 的地址
+func FindNode(ctx context.Context, mainState *models.MainStore, target [32]byte) (models.Contact, bool) {
+	for _, c := range Lookup(ctx, mainState, target) {
+		if c.NodeId == target {
+			return c, true
+		}
+	}
+
+	return models.Contact{}, false
+}
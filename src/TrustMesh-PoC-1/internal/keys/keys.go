@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"unsafe"
 )
 
@@ -26,45 +27,164 @@ func Zeroize(b []byte) {
 	runtime.KeepAlive(b)
 }
 
+// dataDir 密钥所在的数据目录，启动时由配置设置
+var dataDir = constants.DefaultConfigDir
+
+// SetDir 设置密钥所在的数据目录
+func SetDir(dir string) {
+	dataDir = dir
+	forget()
+}
+
+// passphrase 加密密钥文件的口令，为空时使用明文 seed 文件
+var passphrase []byte
+
+// SetPassphrase 设置密钥文件口令，新建或轮换的密钥将加密保存
+func SetPassphrase(p []byte) {
+	passphrase = p
+	forget()
+}
+
+// 加密密钥文件解锁后的 seed，避免每次签名都重新派生口令
+var (
+	unlocked     []byte
+	unlockedLock sync.Mutex
+)
+
+// forget 清除已解锁的 seed
+func forget() {
+	unlockedLock.Lock()
+	defer unlockedLock.Unlock()
+
+	Zeroize(unlocked)
+	unlocked = nil
+}
+
+// remember 缓存已解锁的 seed
+func remember(seed []byte) {
+	unlockedLock.Lock()
+	defer unlockedLock.Unlock()
+
+	Zeroize(unlocked)
+	unlocked = append([]byte(nil), seed...)
+}
+
 // seedPath seed 文件路径
 func seedPath() string {
-	path := filepath.Join(constants.ConfigDir, "seed.key")
+	path := filepath.Join(dataDir, "seed.key")
 	return path
 }
 
-// LoadOrCreateKey 返回公/私钥
+// ErrKeyExists 密钥文件已存在
+var ErrKeyExists = errors.New("seed file already exists")
+
+// LoadOrCreateKey 返回公/私钥，密钥不存在时创建
 func LoadOrCreateKey() (ed25519.PrivateKey, ed25519.PublicKey, error) {
-	path := seedPath()
+	// 如果文件不存在 → 创建新 seed
+	if _, err := os.Stat(seedPath()); errors.Is(err, os.ErrNotExist) {
+		return createKey(seedPath())
+	}
+
+	return loadKey(seedPath())
+}
+
+// LoadKey 返回公/私钥，密钥不存在时返回错误
+func LoadKey() (ed25519.PrivateKey, ed25519.PublicKey, error) {
+	return loadKey(seedPath())
+}
+
+// CreateKey 生成新密钥，overwrite 为 false 时不覆盖已有密钥
+func CreateKey(overwrite bool) (ed25519.PrivateKey, ed25519.PublicKey, error) {
+	if _, err := os.Stat(seedPath()); err == nil && !overwrite {
+		return nil, nil, ErrKeyExists
+	}
+
+	return createKey(seedPath())
+}
+
+// Unlock 启动时加载或创建密钥并创建本地签名服务
+// 设置了口令时将明文 seed 文件改写为加密格式，返回值 bool 表示是否发生了改写
+func Unlock() (*LocalSigner, bool, error) {
+	privateKey, publicKey, err := LoadOrCreateKey()
+	if err != nil {
+		return nil, false, err
+	}
+	defer Zeroize(privateKey)
+
+	encrypted := false
+	if passphrase != nil {
+		data, err := os.ReadFile(seedPath())
+		if err != nil {
+			return nil, false, fmt.Errorf("cannot read seed file: %w", err)
+		}
+		if !isKeystore(data) {
+			if err := writeSeed(seedPath(), privateKey.Seed()); err != nil {
+				Zeroize(data)
+				return nil, false, err
+			}
+			encrypted = true
+		}
+		Zeroize(data)
+	}
+
+	// 签名服务持有私钥后不再需要缓存的 seed
+	forget()
+
+	return newLocalSigner(privateKey, publicKey), encrypted, nil
+}
 
+// createKey 生成 seed 并写入文件
+func createKey(path string) (ed25519.PrivateKey, ed25519.PublicKey, error) {
 	// 创建目录
 	if err := os.MkdirAll(filepath.Dir(path), 0o0700); err != nil {
 		return nil, nil, fmt.Errorf("cannot create keys directory: %w", err)
 	}
 
-	// 如果文件不存在 → 创建新 seed
-	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
-		seed := make([]byte, ed25519.SeedSize)
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, nil, fmt.Errorf("cannot generate seed: %w", err)
+	}
 
-		if _, err := rand.Read(seed); err != nil {
-			return nil, nil, fmt.Errorf("cannot generate seed: %w", err)
-		}
+	if err := writeSeed(path, seed); err != nil {
+		Zeroize(seed)
+		return nil, nil, err
+	}
 
-		// 写入 seed 文件（权限 0600）
-		if err := os.WriteFile(path, seed, 0o0600); err != nil {
-			Zeroize(seed)
-			return nil, nil, fmt.Errorf("cannot write seed file: %w", err)
-		}
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	Zeroize(seed) // 清理 seed 内存
+
+	return privateKey, privateKey.Public().(ed25519.PublicKey), nil
+}
 
-		privateKey := ed25519.NewKeyFromSeed(seed)
-		Zeroize(seed) // 清理 seed 内存
+// writeSeed 写入 seed 文件（权限 0600），设置了口令时加密保存
+func writeSeed(path string, seed []byte) error {
+	data := seed
+	if passphrase != nil {
+		sealed, err := sealSeed(seed, passphrase)
+		if err != nil {
+			return err
+		}
+		data = sealed
+		remember(seed)
+	}
 
-		return privateKey, privateKey.Public().(ed25519.PublicKey), nil
+	// 先写临时文件再替换，避免中途失败损坏已有密钥
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o0600); err != nil {
+		return fmt.Errorf("cannot write seed file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("cannot write seed file: %w", err)
 	}
 
-	// 文件存在 → 尝试读取
-	seed, err := os.ReadFile(path)
+	return nil
+}
+
+// loadKey 从文件读取 seed
+func loadKey(path string) (ed25519.PrivateKey, ed25519.PublicKey, error) {
+	seed, err := readSeed(path)
 	if err != nil {
-		return nil, nil, fmt.Errorf("cannot read seed file: %w", err)
+		return nil, nil, err
 	}
 
 	if len(seed) != ed25519.SeedSize {
@@ -77,3 +197,32 @@ func LoadOrCreateKey() (ed25519.PrivateKey, ed25519.PublicKey, error) {
 
 	return privateKey, privateKey.Public().(ed25519.PublicKey), nil
 }
+
+// readSeed 读取 seed 文件，加密格式时用口令解密，解密结果缓存于内存
+func readSeed(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read seed file: %w", err)
+	}
+	if !isKeystore(data) {
+		return data, nil
+	}
+
+	unlockedLock.Lock()
+	defer unlockedLock.Unlock()
+
+	if unlocked != nil {
+		return append([]byte(nil), unlocked...), nil
+	}
+	if passphrase == nil {
+		return nil, ErrLocked
+	}
+
+	seed, err := openSeed(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	unlocked = append([]byte(nil), seed...)
+
+	return seed, nil
+}
@@ -0,0 +1,128 @@
+package keys
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// 加密密钥文件格式
+// [4]魔数 + [1]版本 + [1]scrypt logN + [1]r + [1]p + [16]盐 + [12]随机数 + 密文（AES-256-GCM，头部作为附加数据）
+const (
+	keystoreVersion byte = 1
+	keystoreHeader       = 4 + 1 + 1 + 1 + 1 + 16 + 12
+)
+
+// scrypt 参数
+const (
+	scryptLogN byte = 15
+	scryptR    byte = 8
+	scryptP    byte = 1
+)
+
+// keystoreMagic 加密密钥文件魔数
+var keystoreMagic = [4]byte{'T', 'M', 'K', 'S'}
+
+var (
+	// ErrLocked 密钥文件已加密但未提供口令
+	ErrLocked = errors.New("seed file is encrypted, passphrase required")
+	// ErrPassphrase 口令错误或密钥文件已损坏
+	ErrPassphrase = errors.New("wrong passphrase or corrupted seed file")
+)
+
+// isKeystore 是否为加密密钥文件
+func isKeystore(data []byte) bool {
+	return len(data) >= 4 && bytes.Equal(data[:4], keystoreMagic[:])
+}
+
+// deriveKey 由口令派生 AES-256 密钥
+func deriveKey(pass []byte, salt []byte, logN byte, r byte, p byte) ([]byte, error) {
+	if logN < 10 || logN > 20 || r == 0 || p == 0 {
+		return nil, fmt.Errorf("invalid scrypt parameters %d/%d/%d", logN, r, p)
+	}
+
+	return scrypt.Key(pass, salt, 1<<logN, int(r), int(p), 32)
+}
+
+// newGCM 创建 AES-256-GCM
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// sealSeed 用口令加密 seed
+func sealSeed(seed []byte, pass []byte) ([]byte, error) {
+	header := make([]byte, 0, keystoreHeader)
+	header = append(header, keystoreMagic[:]...)
+	header = append(header, keystoreVersion, scryptLogN, scryptR, scryptP)
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("cannot generate salt: %w", err)
+	}
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("cannot generate nonce: %w", err)
+	}
+	header = append(header, salt...)
+	header = append(header, nonce...)
+
+	key, err := deriveKey(pass, salt, scryptLogN, scryptR, scryptP)
+	if err != nil {
+		return nil, err
+	}
+	defer Zeroize(key)
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(header, nonce, seed, header), nil
+}
+
+// openSeed 用口令解密 seed
+func openSeed(data []byte, pass []byte) ([]byte, error) {
+	if len(data) < keystoreHeader || !isKeystore(data) {
+		return nil, errors.New("invalid seed file")
+	}
+	if data[4] != keystoreVersion {
+		return nil, fmt.Errorf("unsupported seed file version %d", data[4])
+	}
+
+	header := data[:keystoreHeader]
+	salt := header[8:24]
+	nonce := header[24:36]
+
+	key, err := deriveKey(pass, salt, header[5], header[6], header[7])
+	if err != nil {
+		return nil, err
+	}
+	defer Zeroize(key)
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := aead.Open(nil, nonce, data[keystoreHeader:], header)
+	if err != nil {
+		return nil, ErrPassphrase
+	}
+	if len(seed) != ed25519.SeedSize {
+		Zeroize(seed)
+		return nil, fmt.Errorf("invalid seed length %d", len(seed))
+	}
+
+	return seed, nil
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package keys
+
+// lockedAlloc 不支持锁定内存的平台使用普通内存
+func lockedAlloc(n int) ([]byte, bool) {
+	return make([]byte, n), false
+}
+
+// lockedFree 清零内存
+func lockedFree(buf []byte, _ bool) {
+	Zeroize(buf)
+}
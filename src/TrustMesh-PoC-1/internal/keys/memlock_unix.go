@@ -0,0 +1,24 @@
+//go:build unix
+
+package keys
+
+import "golang.org/x/sys/unix"
+
+// lockedAlloc 分配内存并锁定所在内存页，防止被换出到磁盘，失败时退回普通内存
+// 私钥必须位于 Go 堆上（ed25519 以私钥地址作缓存键），Go 堆上的对象不会移动，可以直接锁定
+func lockedAlloc(n int) ([]byte, bool) {
+	buf := make([]byte, n)
+	if err := unix.Mlock(buf); err != nil {
+		return buf, false
+	}
+
+	return buf, true
+}
+
+// lockedFree 清零并解锁 lockedAlloc 分配的内存
+func lockedFree(buf []byte, locked bool) {
+	Zeroize(buf)
+	if locked {
+		_ = unix.Munlock(buf)
+	}
+}
@@ -0,0 +1,304 @@
+package keys
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 外部签名服务协议，基于 Unix 套接字
+// 请求：[1]操作 + [4]长度 + 内容
+// 回复：[1]状态 + [4]长度 + 内容（公钥、签名或错误信息）
+const (
+	signerOpPublicKey byte = 0x01
+	signerOpSign      byte = 0x02
+
+	signerStatusOK    byte = 0x00
+	signerStatusError byte = 0x01
+)
+
+// 外部签名服务参数
+const (
+	// maxSignerMessage 单条签名内容的最大长度
+	maxSignerMessage = 64 * 1024
+	// signerTimeout 单次请求的读写期限
+	signerTimeout = 5 * time.Second
+)
+
+// RemoteSigner 通过 Unix 套接字调用外部签名进程，私钥不进入本进程
+type RemoteSigner struct {
+	path      string
+	mu        sync.Mutex
+	conn      net.Conn
+	publicKey ed25519.PublicKey
+	closed    bool
+}
+
+// DialSigner 连接外部签名进程并获取公钥
+func DialSigner(path string) (*RemoteSigner, error) {
+	s := &RemoteSigner{path: path}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pk, err := s.call(signerOpPublicKey, nil)
+	if err != nil {
+		s.closeConn()
+		return nil, fmt.Errorf("external signer %s: %w", path, err)
+	}
+	if len(pk) != ed25519.PublicKeySize {
+		s.closeConn()
+		return nil, fmt.Errorf("external signer %s: invalid public key length %d", path, len(pk))
+	}
+	s.publicKey = pk
+
+	return s, nil
+}
+
+// PublicKey 返回公钥
+func (s *RemoteSigner) PublicKey() ed25519.PublicKey {
+	return s.publicKey
+}
+
+// Sign 请求外部进程签名，并用公钥校验返回的签名
+func (s *RemoteSigner) Sign(message []byte) ([]byte, error) {
+	if len(message) > maxSignerMessage {
+		return nil, fmt.Errorf("message too long %d", len(message))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrSignerClosed
+	}
+
+	sig, err := s.call(signerOpSign, message)
+	if err != nil {
+		return nil, err
+	}
+	if len(sig) != ed25519.SignatureSize || !ed25519.Verify(s.publicKey, message, sig) {
+		return nil, errors.New("external signer returned an invalid signature")
+	}
+
+	return sig, nil
+}
+
+// Close 断开与外部签名进程的连接
+func (s *RemoteSigner) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	s.closeConn()
+
+	return nil
+}
+
+// call 发送一次请求，连接出错时重连重试一次
+func (s *RemoteSigner) call(op byte, body []byte) ([]byte, error) {
+	out, err := s.roundTrip(op, body)
+	if err == nil {
+		return out, nil
+	}
+
+	var remote remoteError
+	if errors.As(err, &remote) {
+		return nil, err
+	}
+
+	s.closeConn()
+	return s.roundTrip(op, body)
+}
+
+// roundTrip 在当前连接上完成一次请求与回复
+func (s *RemoteSigner) roundTrip(op byte, body []byte) ([]byte, error) {
+	if s.conn == nil {
+		conn, err := net.DialTimeout("unix", s.path, signerTimeout)
+		if err != nil {
+			return nil, err
+		}
+		s.conn = conn
+	}
+
+	if err := s.conn.SetDeadline(time.Now().Add(signerTimeout)); err != nil {
+		s.closeConn()
+		return nil, err
+	}
+	if err := writeSignerFrame(s.conn, op, body); err != nil {
+		s.closeConn()
+		return nil, err
+	}
+
+	status, out, err := readSignerFrame(s.conn)
+	if err != nil {
+		s.closeConn()
+		return nil, err
+	}
+	if status != signerStatusOK {
+		return nil, remoteError(out)
+	}
+
+	return out, nil
+}
+
+// closeConn 关闭当前连接
+func (s *RemoteSigner) closeConn() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// remoteError 外部签名进程返回的错误
+type remoteError string
+
+func (e remoteError) Error() string {
+	return "external signer: " + string(e)
+}
+
+// writeSignerFrame 写入 [1]类型 + [4]长度 + 内容
+func writeSignerFrame(w io.Writer, kind byte, body []byte) error {
+	frame := make([]byte, 0, 1+4+len(body))
+	frame = append(frame, kind)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(body)))
+	frame = append(frame, body...)
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// readSignerFrame 读取 [1]类型 + [4]长度 + 内容
+func readSignerFrame(r io.Reader) (byte, []byte, error) {
+	var head [5]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+
+	length := binary.BigEndian.Uint32(head[1:5])
+	if length > maxSignerMessage {
+		return 0, nil, fmt.Errorf("frame too long %d", length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+
+	return head[0], body, nil
+}
+
+// ListenSigner 在 Unix 套接字上监听，仅允许当前用户访问，旧的套接字文件会被删除
+// 套接字先在同目录下新建的 0700 临时目录中创建并收紧权限，再移动到 path，其他用户始终无法在权限收紧前连接
+func ListenSigner(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".signer")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	tmp := filepath.Join(dir, "s")
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// 移动之后由 signerListener 在关闭时删除套接字文件
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	if err := os.Chmod(tmp, 0o0600); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+
+	return &signerListener{Listener: l, path: path}, nil
+}
+
+// signerListener 关闭时删除套接字文件
+type signerListener struct {
+	net.Listener
+	path string
+	once sync.Once
+}
+
+// Close 关闭监听并删除套接字文件
+func (l *signerListener) Close() error {
+	err := l.Listener.Close()
+	l.once.Do(func() { _ = os.Remove(l.path) })
+	return err
+}
+
+// ServeSigner 作为外部签名进程，用 signer 回复套接字上的请求，ctx 取消时返回
+func ServeSigner(ctx context.Context, l net.Listener, signer Signer) error {
+	stop := context.AfterFunc(ctx, func() { _ = l.Close() })
+	defer stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveSignerConn(ctx, conn, signer)
+		}()
+	}
+}
+
+// serveSignerConn 处理一个客户端的连续请求
+func serveSignerConn(ctx context.Context, conn net.Conn, signer Signer) {
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	for {
+		op, body, err := readSignerFrame(conn)
+		if err != nil {
+			return
+		}
+
+		var out []byte
+		switch op {
+		case signerOpPublicKey:
+			out = signer.PublicKey()
+		case signerOpSign:
+			out, err = signer.Sign(body)
+		default:
+			err = fmt.Errorf("unknown operation %d", op)
+		}
+
+		if err != nil {
+			err = writeSignerFrame(conn, signerStatusError, []byte(err.Error()))
+		} else {
+			err = writeSignerFrame(conn, signerStatusOK, out)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// TMROTV1Domain 密钥轮换声明签名 Tag
+const TMROTV1Domain uint32 = 0x8F3A6C21
+
+// RotationSize 轮换声明长度：[32]旧公钥 + [32]新公钥 + [8]时间 + [64]旧密钥签名
+const RotationSize = 32 + 32 + 8 + 64
+
+// RotationTTL 轮换声明有效期，过期后不再发送也不再接受
+const RotationTTL = 30 * 24 * time.Hour
+
+// rotationSkew 允许的时钟偏差
+const rotationSkew = 5 * time.Minute
+
+// ErrRotationSignature 轮换声明签名无效
+var ErrRotationSignature = errors.New("invalid rotation signature")
+
+// Rotation 密钥轮换声明，由旧密钥签名，指明新公钥
+type Rotation struct {
+	Old  [32]byte
+	New  [32]byte
+	Time uint64
+	Sig  [64]byte
+}
+
+// rotationPath 轮换声明文件路径
+func rotationPath() string {
+	return filepath.Join(dataDir, "rotation.bin")
+}
+
+// rotationMessage 签名内容：[4]Tag + [32]旧公钥 + [32]新公钥 + [8]时间
+func rotationMessage(old [32]byte, new [32]byte, t uint64) []byte {
+	msg := make([]byte, 0, 4+32+32+8)
+	msg = binary.BigEndian.AppendUint32(msg, TMROTV1Domain)
+	msg = append(msg, old[:]...)
+	msg = append(msg, new[:]...)
+	msg = binary.BigEndian.AppendUint64(msg, t)
+
+	return msg
+}
+
+// Encode 编码轮换声明
+func (r Rotation) Encode() [RotationSize]byte {
+	var out [RotationSize]byte
+	copy(out[0:32], r.Old[:])
+	copy(out[32:64], r.New[:])
+	binary.BigEndian.PutUint64(out[64:72], r.Time)
+	copy(out[72:136], r.Sig[:])
+
+	return out
+}
+
+// DecodeRotation 解码轮换声明
+func DecodeRotation(b [RotationSize]byte) Rotation {
+	var r Rotation
+	copy(r.Old[:], b[0:32])
+	copy(r.New[:], b[32:64])
+	r.Time = binary.BigEndian.Uint64(b[64:72])
+	copy(r.Sig[:], b[72:136])
+
+	return r
+}
+
+// Verify 校验签名与有效期
+func (r Rotation) Verify(now time.Time) error {
+	if r.Old == r.New {
+		return errors.New("rotation to the same key")
+	}
+
+	t := time.UnixMilli(int64(r.Time))
+	if t.After(now.Add(rotationSkew)) {
+		return errors.New("rotation time is in the future")
+	}
+	if now.Sub(t) > RotationTTL {
+		return errors.New("rotation expired")
+	}
+
+	if !ed25519.Verify(r.Old[:], rotationMessage(r.Old, r.New, r.Time), r.Sig[:]) {
+		return ErrRotationSignature
+	}
+
+	return nil
+}
+
+// Rotate 生成新密钥并用旧密钥签署轮换声明，旧 seed 文件按时间归档
+func Rotate() (Rotation, error) {
+	oldPrivate, oldPublic, err := LoadKey()
+	if err != nil {
+		return Rotation{}, err
+	}
+	defer Zeroize(oldPrivate)
+
+	// 归档旧 seed 文件，保持原有格式
+	data, err := os.ReadFile(seedPath())
+	if err != nil {
+		return Rotation{}, fmt.Errorf("cannot read seed file: %w", err)
+	}
+	now := time.Now().UnixMilli()
+	archive := seedPath() + "." + strconv.FormatInt(now, 10) + ".old"
+	err = os.WriteFile(archive, data, 0o0600)
+	Zeroize(data)
+	if err != nil {
+		return Rotation{}, fmt.Errorf("cannot archive seed file: %w", err)
+	}
+
+	newPrivate, newPublic, err := createKey(seedPath())
+	if err != nil {
+		return Rotation{}, err
+	}
+	Zeroize(newPrivate)
+
+	r := Rotation{Time: uint64(now)}
+	copy(r.Old[:], oldPublic)
+	copy(r.New[:], newPublic)
+	copy(r.Sig[:], ed25519.Sign(oldPrivate, rotationMessage(r.Old, r.New, r.Time)))
+
+	encoded := r.Encode()
+	if err := os.WriteFile(rotationPath(), encoded[:], 0o0600); err != nil {
+		return Rotation{}, fmt.Errorf("cannot write rotation file: %w", err)
+	}
+
+	return r, nil
+}
+
+// CurrentRotation 返回指向 publicKey 且仍有效的轮换声明
+func CurrentRotation(publicKey ed25519.PublicKey) (Rotation, bool) {
+	data, err := os.ReadFile(rotationPath())
+	if err != nil || len(data) != RotationSize {
+		return Rotation{}, false
+	}
+
+	r := DecodeRotation([RotationSize]byte(data))
+	if r.Verify(time.Now()) != nil {
+		return Rotation{}, false
+	}
+
+	if len(publicKey) != ed25519.PublicKeySize || [32]byte(publicKey) != r.New {
+		return Rotation{}, false
+	}
+
+	return r, true
+}
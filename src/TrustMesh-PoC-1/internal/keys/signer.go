@@ -0,0 +1,76 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"sync"
+)
+
+// Signer 签名服务，节点启动时创建一次，所有签名都经由它完成
+type Signer interface {
+	// PublicKey 返回公钥
+	PublicKey() ed25519.PublicKey
+	// Sign 对消息签名
+	Sign(message []byte) ([]byte, error)
+	// Close 释放密钥
+	Close() error
+}
+
+// ErrSignerClosed 签名服务已关闭
+var ErrSignerClosed = errors.New("signer is closed")
+
+// LocalSigner 本地签名服务，私钥只从磁盘读取一次并保存在锁定内存中
+type LocalSigner struct {
+	mu         sync.RWMutex
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+	locked     bool
+}
+
+// newLocalSigner 将私钥复制到锁定内存
+func newLocalSigner(privateKey ed25519.PrivateKey, publicKey ed25519.PublicKey) *LocalSigner {
+	buf, locked := lockedAlloc(ed25519.PrivateKeySize)
+	copy(buf, privateKey)
+
+	return &LocalSigner{
+		privateKey: buf,
+		publicKey:  append(ed25519.PublicKey(nil), publicKey...),
+		locked:     locked,
+	}
+}
+
+// Locked 私钥所在内存是否已锁定，不会被换出到磁盘
+func (s *LocalSigner) Locked() bool {
+	return s.locked
+}
+
+// PublicKey 返回公钥
+func (s *LocalSigner) PublicKey() ed25519.PublicKey {
+	return s.publicKey
+}
+
+// Sign 对消息签名
+func (s *LocalSigner) Sign(message []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.privateKey == nil {
+		return nil, ErrSignerClosed
+	}
+
+	return ed25519.Sign(s.privateKey, message), nil
+}
+
+// Close 清除并释放私钥
+func (s *LocalSigner) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.privateKey == nil {
+		return nil
+	}
+	lockedFree(s.privateKey, s.locked)
+	s.privateKey = nil
+
+	return nil
+}
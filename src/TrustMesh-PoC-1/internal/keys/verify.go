@@ -0,0 +1,50 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"sync"
+
+	"github.com/zeebo/blake3"
+)
+
+// VerifyCache 校验通过的签名，多个节点共用一个进程时（例如模拟器）同一签名只校验一次
+// 条目不淘汰，只用于生命周期有限的场景
+type VerifyCache struct {
+	lock sync.RWMutex
+	seen map[[32]byte]struct{}
+}
+
+// NewVerifyCache 创建签名校验缓存
+func NewVerifyCache() *VerifyCache {
+	return &VerifyCache{seen: make(map[[32]byte]struct{})}
+}
+
+// Verify 校验 ed25519 签名，已校验通过的签名直接返回 true；c 为 nil 时每次都校验
+func (c *VerifyCache) Verify(publicKey []byte, message []byte, sig []byte) bool {
+	if c == nil {
+		return ed25519.Verify(publicKey, message, sig)
+	}
+
+	h := blake3.New()
+	_, _ = h.Write(publicKey)
+	_, _ = h.Write(message)
+	_, _ = h.Write(sig)
+	var key [32]byte
+	h.Sum(key[:0])
+
+	c.lock.RLock()
+	_, ok := c.seen[key]
+	c.lock.RUnlock()
+	if ok {
+		return true
+	}
+
+	if !ed25519.Verify(publicKey, message, sig) {
+		return false
+	}
+
+	c.lock.Lock()
+	c.seen[key] = struct{}{}
+	c.lock.Unlock()
+	return true
+}
@@ -0,0 +1,66 @@
+package logger
+
+import "log/slog"
+
+// NodeId 节点 ID 字段
+func NodeId(id [32]byte) slog.Attr {
+	return slog.Any("nodeId", ID(id[:]))
+}
+
+// Round 轮次字段
+func Round(round int64) slog.Attr {
+	return slog.Int64("round", round)
+}
+
+// PHash 提案哈希字段
+func PHash(pHash [32]byte) slog.Attr {
+	return slog.Any("pHash", ID(pHash[:]))
+}
+
+// Peer 对端地址字段
+func Peer(addr string) slog.Attr {
+	return slog.String("peer", addr)
+}
+
+// Entry 带结构化字段的日志
+type Entry struct {
+	attrs []slog.Attr
+}
+
+// With 创建带字段的日志
+func With(attrs ...slog.Attr) Entry {
+	return Entry{attrs: attrs}
+}
+
+// With 追加字段
+func (e Entry) With(attrs ...slog.Attr) Entry {
+	out := make([]slog.Attr, 0, len(e.attrs)+len(attrs))
+	out = append(out, e.attrs...)
+	out = append(out, attrs...)
+	return Entry{attrs: out}
+}
+
+// Test 日志
+func (e Entry) Test(format string, a ...interface{}) {
+	output(3, LevelTest, e.attrs, format, a)
+}
+
+// Debug 日志
+func (e Entry) Debug(format string, a ...interface{}) {
+	output(3, LevelDebug, e.attrs, format, a)
+}
+
+// Info 日志
+func (e Entry) Info(format string, a ...interface{}) {
+	output(3, LevelInfo, e.attrs, format, a)
+}
+
+// Warning 日志
+func (e Entry) Warning(format string, a ...interface{}) {
+	output(3, LevelWarning, e.attrs, format, a)
+}
+
+// Error 日志
+func (e Entry) Error(format string, a ...interface{}) {
+	output(3, LevelError, e.attrs, format, a)
+}
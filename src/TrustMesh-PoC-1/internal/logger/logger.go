@@ -1,64 +1,312 @@
 package logger
 
 import (
+	"context"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// 日志级别常量
+// 日志级别，TEST 低于 DEBUG，仅在开发时使用
 const (
-	TEST    = "TEST"
-	DEBUG   = "DEBUG"
-	INFO    = "INFO"
-	WARNING = "WARNING"
-	ERROR   = "ERROR"
-	FATAL   = "FATAL"
+	LevelTest    = slog.Level(-8)
+	LevelDebug   = slog.LevelDebug
+	LevelInfo    = slog.LevelInfo
+	LevelWarning = slog.LevelWarn
+	LevelError   = slog.LevelError
 )
 
-// 格式化输出函数
-func log(level string, format string, a ...interface{}) {
-	timestamp := time.Now().Format(time.RFC3339Nano)
-	msg := fmt.Sprintf(format, a...)
-	fmt.Printf("[%s] [%s] %s\n", timestamp, level, msg)
+// 输出格式
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// levelNames 级别名称，与旧日志保持一致
+var levelNames = map[slog.Level]string{
+	LevelTest:    "TEST",
+	LevelDebug:   "DEBUG",
+	LevelInfo:    "INFO",
+	LevelWarning: "WARNING",
+	LevelError:   "ERROR",
 }
 
-// Test 日志，仅在开发时使用，发布时删除
-func Test(format string, a ...interface{}) {
-	if debugMode, isExist := os.LookupEnv("TEST_MODE"); !isExist || debugMode != "true" {
-		return
+// ParseLevel 解析级别名称，不区分大小写
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "test":
+		return LevelTest, nil
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warning", "warn":
+		return LevelWarning, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", s)
 	}
+}
 
-	log(TEST, format, a...)
+// LevelName 级别名称
+func LevelName(level slog.Level) string {
+	if name, ok := levelNames[level]; ok {
+		return name
+	}
+	return level.String()
 }
 
-// Debug 日志，仅在 DEBUG_MOD=true 时打印
-func Debug(format string, a ...interface{}) {
-	if debugMode, isExist := os.LookupEnv("DEBUG_MODE"); !isExist || debugMode != "true" {
+// Options 日志配置
+type Options struct {
+	// 输出格式 text 或 json
+	Format string
+	// 默认级别
+	Level slog.Level
+	// 子系统级别，子系统为调用方的包名，例如 p2p、consensus、db
+	Levels map[string]slog.Level
+	// 输出位置，默认标准输出
+	Output io.Writer
+}
+
+// 日志状态
+var (
+	// handler 当前输出
+	handler atomic.Pointer[slog.Handler]
+	// defaultLevel 未单独设置的子系统使用的级别
+	defaultLevel slog.LevelVar
+	// levels 子系统级别
+	levels     = make(map[string]*slog.LevelVar)
+	levelsLock sync.RWMutex
+	// minLevel 所有级别中的最低值，低于它的日志无需定位调用方
+	minLevel atomic.Int64
+	// subsystems 调用位置到子系统的缓存
+	subsystems sync.Map
+)
+
+func init() {
+	_ = Configure(Options{Level: LevelInfo})
+}
+
+// Configure 设置输出格式与级别，可在运行时重复调用
+func Configure(opts Options) error {
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+
+	handlerOpts := &slog.HandlerOptions{
+		// 级别由本包过滤
+		Level:       LevelTest,
+		ReplaceAttr: replaceLevel,
+	}
+
+	var h slog.Handler
+	switch opts.Format {
+	case "", FormatText:
+		h = slog.NewTextHandler(out, handlerOpts)
+	case FormatJSON:
+		h = slog.NewJSONHandler(out, handlerOpts)
+	default:
+		return fmt.Errorf("unknown log format %q", opts.Format)
+	}
+	handler.Store(&h)
+
+	levelsLock.Lock()
+	defaultLevel.Set(opts.Level)
+	levels = make(map[string]*slog.LevelVar, len(opts.Levels))
+	for name, level := range opts.Levels {
+		v := new(slog.LevelVar)
+		v.Set(level)
+		levels[name] = v
+	}
+	updateMinLevel()
+	levelsLock.Unlock()
+
+	return nil
+}
+
+// SetLevel 在运行时修改级别，subsystem 为空时修改默认级别
+func SetLevel(subsystem string, level slog.Level) {
+	levelsLock.Lock()
+	defer levelsLock.Unlock()
+
+	if subsystem == "" {
+		defaultLevel.Set(level)
+	} else if v, ok := levels[subsystem]; ok {
+		v.Set(level)
+	} else {
+		v := new(slog.LevelVar)
+		v.Set(level)
+		levels[subsystem] = v
+	}
+	updateMinLevel()
+}
+
+// Levels 返回当前级别，键 "" 为默认级别
+func Levels() map[string]string {
+	levelsLock.RLock()
+	defer levelsLock.RUnlock()
+
+	out := make(map[string]string, len(levels)+1)
+	out[""] = LevelName(defaultLevel.Level())
+	for name, v := range levels {
+		out[name] = LevelName(v.Level())
+	}
+	return out
+}
+
+// ParseLevels 解析 "p2p=debug,db=warning" 形式的子系统级别
+func ParseLevels(s string) (map[string]slog.Level, error) {
+	out := make(map[string]slog.Level)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid log level %q, want subsystem=level", item)
+		}
+		level, err := ParseLevel(value)
+		if err != nil {
+			return nil, err
+		}
+		out[strings.TrimSpace(name)] = level
+	}
+	return out, nil
+}
+
+// updateMinLevel 重新计算最低级别，调用方持有 levelsLock
+func updateMinLevel() {
+	lowest := defaultLevel.Level()
+	for _, v := range levels {
+		if l := v.Level(); l < lowest {
+			lowest = l
+		}
+	}
+	minLevel.Store(int64(lowest))
+}
+
+// levelFor 子系统当前级别
+func levelFor(subsystem string) slog.Level {
+	levelsLock.RLock()
+	defer levelsLock.RUnlock()
+
+	if v, ok := levels[subsystem]; ok {
+		return v.Level()
+	}
+	return defaultLevel.Level()
+}
+
+// replaceLevel 输出旧的级别名称
+func replaceLevel(_ []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey {
+		if level, ok := a.Value.Any().(slog.Level); ok {
+			a.Value = slog.StringValue(LevelName(level))
+		}
+	}
+	return a
+}
+
+// subsystemOf 由调用位置得到子系统，即调用方的包名
+func subsystemOf(pc uintptr) string {
+	if name, ok := subsystems.Load(pc); ok {
+		return name.(string)
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	fn := frame.Function
+	if i := strings.LastIndex(fn, "/"); i >= 0 {
+		fn = fn[i+1:]
+	}
+	if i := strings.Index(fn, "."); i >= 0 {
+		fn = fn[:i]
+	}
+
+	subsystems.Store(pc, fn)
+	return fn
+}
+
+// ID 以十六进制输出的标识，例如 NodeId、pHash、公钥
+type ID []byte
+
+// String 十六进制
+func (id ID) String() string {
+	return hex.EncodeToString(id)
+}
+
+// Format 任何格式动词都输出十六进制
+func (id ID) Format(f fmt.State, _ rune) {
+	_, _ = io.WriteString(f, id.String())
+}
+
+// LogValue 结构化字段中的值
+func (id ID) LogValue() slog.Value {
+	return slog.StringValue(id.String())
+}
+
+// hexArgs 将 [32]byte 与 [64]byte 参数替换为十六进制输出
+func hexArgs(a []interface{}) []interface{} {
+	for i, v := range a {
+		switch b := v.(type) {
+		case [32]byte:
+			a[i] = ID(b[:])
+		case [64]byte:
+			a[i] = ID(b[:])
+		}
+	}
+	return a
+}
+
+// output 输出一条日志，skip 为到业务调用方的栈深度
+func output(skip int, level slog.Level, attrs []slog.Attr, format string, a []interface{}) {
+	if level < slog.Level(minLevel.Load()) {
 		return
 	}
 
-	log(DEBUG, format, a...)
+	var pcs [1]uintptr
+	runtime.Callers(skip, pcs[:])
+	subsystem := subsystemOf(pcs[0])
+	if level < levelFor(subsystem) {
+		return
+	}
+
+	r := slog.NewRecord(time.Now(), level, fmt.Sprintf(format, hexArgs(a)...), pcs[0])
+	r.AddAttrs(slog.String("subsystem", subsystem))
+	r.AddAttrs(attrs...)
+
+	_ = (*handler.Load()).Handle(context.Background(), r)
+}
+
+// Test 日志，仅在开发时使用，发布时删除
+func Test(format string, a ...interface{}) {
+	output(3, LevelTest, nil, format, a)
+}
+
+// Debug 日志
+func Debug(format string, a ...interface{}) {
+	output(3, LevelDebug, nil, format, a)
 }
 
 // Info 日志
 func Info(format string, a ...interface{}) {
-	log(INFO, format, a...)
+	output(3, LevelInfo, nil, format, a)
 }
 
 // Warning 日志
 func Warning(format string, a ...interface{}) {
-	log(WARNING, format, a...)
+	output(3, LevelWarning, nil, format, a)
 }
 
 // Error 日志
 func Error(format string, a ...interface{}) {
-	log(ERROR, format, a...)
-}
-
-// Fatal 日志，输出后立即退出程序
-func Fatal(format string, a ...interface{}) {
-	log(FATAL, format, a...)
-	// 退出程序
-	os.Exit(1)
+	output(3, LevelError, nil, format, a)
 }
@@ -0,0 +1,151 @@
+package maddr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 地址协议
+const (
+	ProtoIP4  = "ip4"
+	ProtoIP6  = "ip6"
+	ProtoDNS  = "dns"
+	ProtoUnix = "unix"
+)
+
+// Addr multiaddr 风格的地址，例如：
+// /ip4/10.0.0.1/tcp/5776、/ip6/::1/tcp/5776、/dns/node-1/tcp/5776、/unix/tmp/node-1.sock
+// 同时兼容旧的 host:port 格式
+type Addr struct {
+	Proto string
+	// IP、域名或 Unix 套接字路径
+	Host string
+	Port string
+}
+
+// Parse 解析 multiaddr 或 host:port 格式的地址
+func Parse(s string) (Addr, error) {
+	if s == "" {
+		return Addr{}, errors.New("address is empty")
+	}
+
+	// 旧格式
+	if !strings.HasPrefix(s, "/") {
+		host, port, err := net.SplitHostPort(s)
+		if err != nil {
+			return Addr{}, fmt.Errorf("invalid address %s: %w", s, err)
+		}
+		return fromHostPort(host, port)
+	}
+
+	parts := strings.Split(s[1:], "/")
+	switch parts[0] {
+	case ProtoUnix:
+		path := "/" + strings.Join(parts[1:], "/")
+		if len(parts) < 2 || path == "/" {
+			return Addr{}, fmt.Errorf("invalid unix address %s", s)
+		}
+		return Addr{Proto: ProtoUnix, Host: path}, nil
+	case ProtoIP4, ProtoIP6, ProtoDNS, "dns4", "dns6":
+		if len(parts) != 4 || parts[2] != "tcp" {
+			return Addr{}, fmt.Errorf("invalid address %s", s)
+		}
+		a, err := fromHostPort(parts[1], parts[3])
+		if err != nil {
+			return Addr{}, err
+		}
+		// 显式声明的 IP 协议必须与地址一致
+		if (parts[0] == ProtoIP4 || parts[0] == ProtoIP6) && a.Proto != parts[0] {
+			return Addr{}, fmt.Errorf("address %s does not match protocol %s", parts[1], parts[0])
+		}
+		return a, nil
+	default:
+		return Addr{}, fmt.Errorf("unknown protocol %s", parts[0])
+	}
+}
+
+// fromHostPort 根据 host 判断协议
+func fromHostPort(host string, port string) (Addr, error) {
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 {
+		return Addr{}, fmt.Errorf("invalid port %s", port)
+	}
+	if host == "" {
+		return Addr{}, errors.New("host is empty")
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() != nil {
+			return Addr{Proto: ProtoIP4, Host: ip.String(), Port: port}, nil
+		}
+		return Addr{Proto: ProtoIP6, Host: ip.String(), Port: port}, nil
+	}
+
+	return Addr{Proto: ProtoDNS, Host: host, Port: port}, nil
+}
+
+// String multiaddr 格式
+func (a Addr) String() string {
+	if a.Proto == ProtoUnix {
+		return "/unix" + a.Host
+	}
+	return "/" + a.Proto + "/" + a.Host + "/tcp/" + a.Port
+}
+
+// Network 对应 net 包中的网络类型
+func (a Addr) Network() string {
+	if a.Proto == ProtoUnix {
+		return "unix"
+	}
+	return "tcp"
+}
+
+// DialString 对应 net 包中的地址
+func (a Addr) DialString() string {
+	if a.Proto == ProtoUnix {
+		return a.Host
+	}
+	return net.JoinHostPort(a.Host, a.Port)
+}
+
+// Normalize 转为 multiaddr 格式，无法解析时原样返回
+func Normalize(s string) string {
+	a, err := Parse(s)
+	if err != nil {
+		return s
+	}
+	return a.String()
+}
+
+// Dial 拨号任意支持的地址格式
+func Dial(s string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return DialContext(ctx, s)
+}
+
+// DialContext 拨号任意支持的地址格式，ctx 取消时放弃
+func DialContext(ctx context.Context, s string) (net.Conn, error) {
+	a, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	return d.DialContext(ctx, a.Network(), a.DialString())
+}
+
+// Listen 监听任意支持的地址格式
+func Listen(s string) (net.Listener, error) {
+	a, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return net.Listen(a.Network(), a.DialString())
+}
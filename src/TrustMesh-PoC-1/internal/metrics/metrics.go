@@ -0,0 +1,236 @@
+package metrics
+
+import (
+	"TrustMesh-PoC-1/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// namespace 指标前缀
+const namespace = "trustmesh"
+
+// 消息方向
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// sendProposal 的问询结果
+const (
+	SendHave    = "have"
+	SendNeed    = "need"
+	SendRefuse  = "refuse"
+	SendTimeout = "timeout"
+	SendError   = "error"
+)
+
+// registry 指标注册表，只包含本程序的指标与 Go 运行时指标
+var registry = prometheus.NewRegistry()
+
+var (
+	handshakes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "handshakes_total",
+		Help:      "Handshakes by result (success or failure).",
+	}, []string{"result"})
+
+	messages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_total",
+		Help:      "Messages read and written by direction and protocol.",
+	}, []string{"direction", "protocol"})
+
+	signatureFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "signature_failures_total",
+		Help:      "Signature verification failures by kind.",
+	}, []string{"kind"})
+
+	proposalsReceived = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "proposals_received_total",
+		Help:      "Proposal bodies accepted from peers.",
+	})
+
+	roundProposals = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "round_proposals",
+		Help:      "Proposals seen in the last finished round.",
+	})
+
+	roundWinnerScore = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "round_winner_score",
+		Help:      "Score of the local winner of the last finished round.",
+	})
+
+	roundLast = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "round_last",
+		Help:      "Number of the last finished round.",
+	})
+
+	roundDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "round_duration_seconds",
+		Help:      "Time from the start of a round to writing its winner.",
+		Buckets:   []float64{1, 2, 5, 10, 15, 20, 30, 45, 60, 120},
+	})
+
+	sendResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "send_proposal_results_total",
+		Help:      "Proposal fan-out results per peer (have, need, refuse, timeout, error).",
+	}, []string{"result"})
+
+	misbehaviours = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "misbehaviours_total",
+		Help:      "Peer misbehaviours by reason.",
+	}, []string{"reason"})
+
+	bans = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bans_total",
+		Help:      "Peers banned for reaching the misbehaviour limit.",
+	})
+
+	rateLimited = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Inbound messages delayed by the per-connection token buckets.",
+	})
+
+	rejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rejected_connections_total",
+		Help:      "Inbound connections closed before the handshake by reason (banned or rate_limited).",
+	}, []string{"reason"})
+
+	evidence = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "evidence_total",
+		Help:      "Equivocation evidence accepted by kind (proposal or rating), each offender and round counted once.",
+	}, []string{"kind"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		handshakes,
+		messages,
+		signatureFailures,
+		proposalsReceived,
+		roundProposals,
+		roundWinnerScore,
+		roundLast,
+		roundDuration,
+		sendResults,
+		misbehaviours,
+		bans,
+		rateLimited,
+		rejected,
+		evidence,
+	)
+}
+
+// Register 注册需要从主状态读取的指标，启动时调用一次
+func Register(mainState *models.MainStore) {
+	table := mainState.ConnectionTable
+
+	registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "connections",
+			Help:      "Active connections in the connection table.",
+		}, func() float64 {
+			table.Lock.RLock()
+			defer table.Lock.RUnlock()
+			return float64(len(table.Connection))
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "write_queue_depth",
+			Help:      "Messages waiting in the write queues of all connections.",
+		}, func() float64 {
+			table.Lock.RLock()
+			defer table.Lock.RUnlock()
+			depth := 0
+			for _, ioc := range table.Connection {
+				depth += len(ioc.WriteQueue)
+			}
+			return float64(depth)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "proposal_store_bytes",
+			Help:      "Estimated memory held by proposals and signatures of active rounds.",
+		}, func() float64 {
+			return float64(mainState.ProposalSate.Bytes())
+		}),
+	)
+}
+
+// Handshake 记录一次握手结果
+func Handshake(ok bool) {
+	if ok {
+		handshakes.WithLabelValues("success").Inc()
+	} else {
+		handshakes.WithLabelValues("failure").Inc()
+	}
+}
+
+// Message 记录一条读写的消息
+func Message(direction string, protocol string) {
+	messages.WithLabelValues(direction, protocol).Inc()
+}
+
+// SignatureFailure 记录一次签名校验失败
+func SignatureFailure(kind string) {
+	signatureFailures.WithLabelValues(kind).Inc()
+}
+
+// ProposalReceived 记录一个接收的提案
+func ProposalReceived() {
+	proposalsReceived.Inc()
+}
+
+// RoundFinished 记录一个完成的轮次
+func RoundFinished(round int64, proposals int, winnerScore uint32, seconds float64) {
+	roundLast.Set(float64(round))
+	roundProposals.Set(float64(proposals))
+	roundWinnerScore.Set(float64(winnerScore))
+	roundDuration.Observe(seconds)
+}
+
+// SendResult 记录一次向单个节点发送提案的结果
+func SendResult(result string) {
+	sendResults.WithLabelValues(result).Inc()
+}
+
+// Misbehaviour 记录一次对端违规
+func Misbehaviour(reason string) {
+	misbehaviours.WithLabelValues(reason).Inc()
+}
+
+// Banned 记录一次因违规产生的封禁
+func Banned() {
+	bans.Inc()
+}
+
+// RateLimited 记录一条因限速而延迟读取的消息
+func RateLimited() {
+	rateLimited.Inc()
+}
+
+// Rejected 记录一个握手前被拒绝的入站连接
+func Rejected(reason string) {
+	rejected.WithLabelValues(reason).Inc()
+}
+
+// Evidence 记录一条新接受的双重签名证据
+func Evidence(kind string) {
+	evidence.WithLabelValues(kind).Inc()
+}
@@ -0,0 +1,45 @@
+package models
+
+import "errors"
+
+// 提案存储的错误
+var (
+	// ErrRoundInactive 轮次未开始或已结束
+	ErrRoundInactive = errors.New("round is not active")
+	// ErrEquivocation 提案者在同一轮次中已有另一个提案
+	ErrEquivocation = errors.New("proposer already has another proposal in this round")
+	// ErrPayloadTooLarge 载荷超过上限
+	ErrPayloadTooLarge = errors.New("payload too large")
+	// ErrStoreFull 没有可淘汰的条目
+	ErrStoreFull = errors.New("proposal store is full")
+	// ErrConflictingAttestation 签名者对同一提案已有一个互相矛盾的打分
+	ErrConflictingAttestation = errors.New("signer already signed a conflicting score")
+)
+
+// 单条记录的估算占用（字节），载荷另计
+const (
+	// proposalOverhead 提案哈希、公钥、时间戳、签名与本地分数
+	proposalOverhead = 32 + 32 + 8 + 64 + 8
+	// attestationSize 签名者 NodeId 与打分签名
+	attestationSize = 32 + 32 + 4 + 8 + 64
+	// proposerSize 提案者 NodeId、提案哈希与提案签名，轮次结束前不释放
+	proposerSize = 32 + 32 + 64
+)
+
+// ProposalLimits 提案存储的资源上限
+type ProposalLimits struct {
+	// 每轮提案数上限，尚未收到本体的签名集另计同样的数量
+	MaxProposals int
+	// 载荷上限
+	MaxPayload int
+	// 全部轮次的提案与签名集占用的字节上限，各轮次并发写入时可能短暂超出一个条目
+	MaxBytes int
+	// 每个提案的签名者上限
+	MaxSigners int
+}
+
+// proposerEntry 提案者在本轮的首个提案
+type proposerEntry struct {
+	pHash [32]byte
+	sig   [64]byte
+}
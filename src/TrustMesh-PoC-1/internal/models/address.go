@@ -0,0 +1,74 @@
+package models
+
+import "sync"
+
+// AddressBook 本节点地址的观测信息
+type AddressBook struct {
+	Lock sync.Mutex
+	// 对方观测到的 IP | 观测者 NodeId
+	Observed map[string]map[[32]byte]struct{}
+	// 自报地址 | 最近一次回拨检查是否可达
+	Reachable map[string]bool
+}
+
+// makeAddressBook 初始化地址观测信息
+func makeAddressBook() *AddressBook {
+	out := AddressBook{
+		Observed:  make(map[string]map[[32]byte]struct{}),
+		Reachable: make(map[string]bool),
+	}
+
+	return &out
+}
+
+// AddObservation 记录一次观测，同一观测者只计一次
+func (b *AddressBook) AddObservation(observer [32]byte, ip string) {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+
+	// 同一观测者只保留最新的观测
+	for k, v := range b.Observed {
+		delete(v, observer)
+		if len(v) == 0 {
+			delete(b.Observed, k)
+		}
+	}
+
+	if _, ok := b.Observed[ip]; !ok {
+		b.Observed[ip] = make(map[[32]byte]struct{})
+	}
+	b.Observed[ip][observer] = struct{}{}
+}
+
+// BestObserved 返回观测者最多的 IP 与观测者数量
+func (b *AddressBook) BestObserved() (string, int) {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+
+	var best string
+	votes := 0
+	for k, v := range b.Observed {
+		if len(v) > votes || (len(v) == votes && k < best) {
+			best = k
+			votes = len(v)
+		}
+	}
+
+	return best, votes
+}
+
+// SetReachable 记录自报地址的回拨结果
+func (b *AddressBook) SetReachable(addr string, ok bool) {
+	b.Lock.Lock()
+	b.Reachable[addr] = ok
+	b.Lock.Unlock()
+}
+
+// IsReachable 查询自报地址的回拨结果，known 为 false 表示尚未检查
+func (b *AddressBook) IsReachable(addr string) (ok bool, known bool) {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+
+	ok, known = b.Reachable[addr]
+	return ok, known
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"TrustMesh-PoC-1/internal/clock"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// Ban 一条封禁
+type Ban struct {
+	// 解封时间，零值表示永久
+	Until  time.Time
+	Reason string
+}
+
+// active 是否仍在封禁期内
+func (b Ban) active(now time.Time) bool {
+	return b.Until.IsZero() || now.Before(b.Until)
+}
+
+// BanList 被封禁的节点与 IP，封禁期间不建立也不接受连接
+// 只保存在内存中，持久化由调用方完成
+type BanList struct {
+	// 判断封禁是否到期的时间来源
+	clock clock.Clock
+	lock  sync.RWMutex
+	nodes map[[32]byte]Ban
+	ips   map[netip.Addr]Ban
+}
+
+// makeBanList 初始化封禁表，按 c 判断封禁是否到期
+func makeBanList(c clock.Clock) *BanList {
+	return &BanList{
+		clock: c,
+		nodes: make(map[[32]byte]Ban),
+		ips:   make(map[netip.Addr]Ban),
+	}
+}
+
+// Ban 封禁节点，until 为零值时永久封禁
+func (b *BanList) Ban(nodeId [32]byte, until time.Time, reason string) {
+	b.lock.Lock()
+	b.nodes[nodeId] = Ban{Until: until, Reason: reason}
+	b.lock.Unlock()
+}
+
+// Unban 解除节点封禁
+func (b *BanList) Unban(nodeId [32]byte) {
+	b.lock.Lock()
+	delete(b.nodes, nodeId)
+	b.lock.Unlock()
+}
+
+// IsBanned 节点是否处于封禁期
+func (b *BanList) IsBanned(nodeId [32]byte) bool {
+	b.lock.RLock()
+	ban, ok := b.nodes[nodeId]
+	b.lock.RUnlock()
+
+	return ok && ban.active(b.clock.Now())
+}
+
+// BanIP 封禁 IP，until 为零值时永久封禁
+func (b *BanList) BanIP(ip netip.Addr, until time.Time, reason string) {
+	b.lock.Lock()
+	b.ips[ip.Unmap()] = Ban{Until: until, Reason: reason}
+	b.lock.Unlock()
+}
+
+// UnbanIP 解除 IP 封禁
+func (b *BanList) UnbanIP(ip netip.Addr) {
+	b.lock.Lock()
+	delete(b.ips, ip.Unmap())
+	b.lock.Unlock()
+}
+
+// IsIPBanned IP 是否处于封禁期
+func (b *BanList) IsIPBanned(ip netip.Addr) bool {
+	b.lock.RLock()
+	ban, ok := b.ips[ip.Unmap()]
+	b.lock.RUnlock()
+
+	return ok && ban.active(b.clock.Now())
+}
+
+// List 仍在封禁期内的节点
+func (b *BanList) List() map[[32]byte]Ban {
+	now := b.clock.Now()
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	out := make(map[[32]byte]Ban, len(b.nodes))
+	for nodeId, ban := range b.nodes {
+		if ban.active(now) {
+			out[nodeId] = ban
+		}
+	}
+	return out
+}
+
+// ListIPs 仍在封禁期内的 IP
+func (b *BanList) ListIPs() map[netip.Addr]Ban {
+	now := b.clock.Now()
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	out := make(map[netip.Addr]Ban, len(b.ips))
+	for ip, ban := range b.ips {
+		if ban.active(now) {
+			out[ip] = ban
+		}
+	}
+	return out
+}
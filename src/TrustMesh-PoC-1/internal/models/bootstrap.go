@@ -0,0 +1,32 @@
+package models
+
+import "sync"
+
+// BootstrapSet 本节点按配置地址拨号连接到的引导节点
+// 引导节点回复只在这些出站连接上接受
+type BootstrapSet struct {
+	lock sync.RWMutex
+	ids  map[[32]byte]struct{}
+}
+
+// makeBootstrapSet 初始化引导节点集合
+func makeBootstrapSet() *BootstrapSet {
+	return &BootstrapSet{ids: make(map[[32]byte]struct{})}
+}
+
+// Add 记录按配置地址拨号得到的引导节点
+func (b *BootstrapSet) Add(nodeId [32]byte) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.ids[nodeId] = struct{}{}
+}
+
+// Contains 是否为按配置地址拨号得到的引导节点
+func (b *BootstrapSet) Contains(nodeId [32]byte) bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	_, ok := b.ids[nodeId]
+	return ok
+}
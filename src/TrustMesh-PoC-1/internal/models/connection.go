@@ -1,16 +1,27 @@
 package models
 
-import "sync"
+import (
+	"context"
+	"net"
+	"sync"
+)
 
 // IOChannel 外部读写接口
 type IOChannel struct {
 	WriteQueue   chan []byte
 	Channels     map[[32]byte]chan []byte
 	ChannelsLock *sync.RWMutex
-	Done         chan struct{}
-	OnceDone     *sync.Once
-	Ready        chan struct{}
-	NodeId       [32]byte
+	// 连接上下文，Cancel 即关闭连接
+	Ctx    context.Context
+	Cancel context.CancelFunc
+	Ready  chan struct{}
+	NodeId [32]byte
+	// 对端地址与方向
+	Addr        string
+	IsInitiator bool
+	// 发起方 NodeId 与 Hello 随机数，用于重复连接裁决
+	Initiator [32]byte
+	Nonce     [32]byte
 }
 
 // ConnectionTable 连接表
@@ -19,6 +30,32 @@ type ConnectionTable struct {
 	Connection map[[32]byte]*IOChannel
 }
 
+// ConnManager 连接管理接口，所有发送方都通过它发送消息
+type ConnManager interface {
+	// Send 向指定节点发送消息，必要时建立连接
+	Send(nodeId [32]byte, message []byte) error
+	// Acquire 获取到指定节点的连接，必要时建立连接，ctx 取消时放弃拨号
+	Acquire(ctx context.Context, nodeId [32]byte) (*IOChannel, error)
+	// Connect 按地址建立连接，返回对方 NodeId，expect 不为零值时 NodeId 不吻合的连接被关闭
+	Connect(ctx context.Context, addr string, expect [32]byte) ([32]byte, error)
+	// Probe 拨号验证地址，完成握手后立即断开，返回对方 NodeId
+	Probe(ctx context.Context, addr string) ([32]byte, error)
+	// Accept 接管入站连接
+	Accept(conn net.Conn)
+}
+
+// ProposalSender 广播提案及其签名集，轮次执行与重发都通过它发送
+type ProposalSender interface {
+	// SendProposal 向邻居发送轮次中的提案，不等待投递完成
+	SendProposal(ctx context.Context, rs *RoundState, pHash [32]byte) error
+}
+
+// RoundObserver 接收本节点每个轮次的结果
+type RoundObserver interface {
+	// RoundFinished 轮次结束，winner 为写入区块的提案，proposals 为收到本体的提案数
+	RoundFinished(round int64, winner [32]byte, proposals int)
+}
+
 // makeConnectionTable 初始化连接表
 func makeConnectionTable() *ConnectionTable {
 	out := ConnectionTable{
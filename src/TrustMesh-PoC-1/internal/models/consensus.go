@@ -1,6 +1,10 @@
 package models
 
-import "sync"
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
 
 // ProposalBody 提案数据
 type ProposalBody struct {
@@ -18,6 +22,19 @@ type Attestation struct {
 	Signature    [64]byte
 }
 
+// Conflicts 两个打分签名是否互相矛盾
+// 诚实节点只会在更晚的时间给出更高的分数，同一时间戳的不同分数或时间更晚而分数更低都视为矛盾
+func (a Attestation) Conflicts(b Attestation) bool {
+	switch {
+	case a.Timestamp == b.Timestamp:
+		return a.Score != b.Score
+	case a.Timestamp < b.Timestamp:
+		return a.Score > b.Score
+	default:
+		return a.Score < b.Score
+	}
+}
+
 // Guarantee 担保信息
 type Guarantee struct {
 	Signature [64]byte
@@ -29,34 +46,86 @@ type Score struct {
 	LastScore uint32
 }
 
-// ProposalStore 提案汇总结构体
+// ProposalStore 轮次注册表，每个活跃轮次对应一个 RoundState
 type ProposalStore struct {
-	// 轮次 | 提案哈希 | 提案内容
-	Data     map[int64]map[[32]byte]ProposalBody
-	DataLock sync.RWMutex
-	// 轮次 | 提案哈希 | 签名者NodeId | 签名信息
-	Sig     map[int64]map[[32]byte]map[[32]byte]Attestation
-	SigLock sync.RWMutex
-	// 轮次 | 提案哈希 | 担保者 | 被担保者 | 签名信息
-	Guarantee     map[int64]map[[32]byte]map[[32]byte]map[[32]byte]Guarantee
-	GuaranteeLock sync.RWMutex
-	// 轮次 | 提案哈希 | 本地分数
-	Score     map[int64]map[[32]byte]Score
-	ScoreLock sync.RWMutex
-	// 轮次 | 通知通道
-	Update     map[int64]chan [32]byte
-	UpdateLock sync.RWMutex
-}
-
-// makeProposalStore 初始化提案结构体
-func makeProposalStore() *ProposalStore {
+	lock   sync.RWMutex
+	rounds map[int64]*RoundState
+	// 资源上限，只读
+	limits ProposalLimits
+	// 全部轮次已占用的字节数，原子读写
+	bytes atomic.Int64
+}
+
+// makeProposalStore 初始化轮次注册表
+func makeProposalStore(limits ProposalLimits) *ProposalStore {
 	out := ProposalStore{
-		Data:      make(map[int64]map[[32]byte]ProposalBody),
-		Sig:       make(map[int64]map[[32]byte]map[[32]byte]Attestation),
-		Guarantee: make(map[int64]map[[32]byte]map[[32]byte]map[[32]byte]Guarantee),
-		Score:     make(map[int64]map[[32]byte]Score),
-		Update:    make(map[int64]chan [32]byte),
+		rounds: make(map[int64]*RoundState),
+		limits: limits,
 	}
 
 	return &out
 }
+
+// OpenRound 创建并注册轮次，轮次已存在时返回已有的轮次
+func (s *ProposalStore) OpenRound(round int64) *RoundState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if r, ok := s.rounds[round]; ok {
+		return r
+	}
+	r := makeRoundState(s, round)
+	s.rounds[round] = r
+
+	return r
+}
+
+// CloseRound 注销轮次并释放占用，仍持有该轮次的调用方之后的写入返回 ErrRoundInactive
+func (s *ProposalStore) CloseRound(round int64) {
+	s.lock.Lock()
+	r, ok := s.rounds[round]
+	delete(s.rounds, round)
+	s.lock.Unlock()
+
+	if ok {
+		r.close()
+	}
+}
+
+// Round 活跃轮次
+func (s *ProposalStore) Round(round int64) (*RoundState, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	r, ok := s.rounds[round]
+	return r, ok
+}
+
+// Rounds 全部活跃轮次，按轮次升序
+func (s *ProposalStore) Rounds() []*RoundState {
+	s.lock.RLock()
+	out := make([]*RoundState, 0, len(s.rounds))
+	for _, r := range s.rounds {
+		out = append(out, r)
+	}
+	s.lock.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Round < out[j].Round })
+	return out
+}
+
+// Find 在活跃轮次中查找已收到本体的提案
+func (s *ProposalStore) Find(pHash [32]byte) (*RoundState, bool) {
+	for _, r := range s.Rounds() {
+		if r.HasProposal(pHash) {
+			return r, true
+		}
+	}
+
+	return nil, false
+}
+
+// Bytes 已占用的字节数
+func (s *ProposalStore) Bytes() int {
+	return int(s.bytes.Load())
+}
@@ -1,16 +1,66 @@
 package models
 
+import (
+	"TrustMesh-PoC-1/internal/clock"
+	"TrustMesh-PoC-1/internal/config"
+	"TrustMesh-PoC-1/internal/constants"
+	"TrustMesh-PoC-1/internal/keys"
+	"TrustMesh-PoC-1/internal/ratelimit"
+	"TrustMesh-PoC-1/internal/trace"
+
+	"gorm.io/gorm"
+)
+
 // MainStore 主状态结构体
 // 仅在创建时初始化，其余禁止更改顶层变量
 type MainStore struct {
+	// 程序配置，只读
+	Config          *config.Config
 	ConnectionTable *ConnectionTable
 	ProposalSate    *ProposalStore
+	AddressBook     *AddressBook
+	Bans            *BanList
+	// 按配置地址拨号连接到的引导节点
+	Bootstraps *BootstrapSet
+	// 时间来源，节点运行时为系统时钟，模拟器使用虚拟时钟
+	Clock clock.Clock
+	// 节点表所在的数据库，启动时由 main 注入
+	DB *gorm.DB
+	// 连接管理器，启动时由 main 注入
+	ConnManager ConnManager
+	// DHT 路由表，启动时由 main 注入
+	RoutingTable *RoutingTable
+	// 提案广播，启动时由 main 注入
+	Sender ProposalSender
+	// 签名服务，启动时由 main 注入
+	Signer keys.Signer
+	// 提案传播追踪，启动时由 main 注入，未开启时为 nil
+	Tracer *trace.Recorder
+	// 轮次结果的接收方，由模拟器注入，为 nil 时不通知
+	Observer RoundObserver
+	// 按邻居限制接受的双重签名证据数
+	EvidenceLimit *ratelimit.Keyed
+	// 提案与打分签名的校验缓存，由模拟器注入，为 nil 时每次都校验
+	Verified *keys.VerifyCache
 }
 
-// Init 初始化
-func (m *MainStore) Init() {
+// Init 初始化，c 为节点的时间来源
+func (m *MainStore) Init(cfg *config.Config, c clock.Clock) {
+	limits := ProposalLimits{
+		MaxProposals: cfg.Consensus.MaxProposals,
+		MaxPayload:   cfg.Consensus.MaxPayload,
+		MaxBytes:     cfg.Consensus.MaxStoreMB << 20,
+		MaxSigners:   constants.MaxSigners,
+	}
+
 	*m = MainStore{
+		Config:          cfg,
+		Clock:           c,
 		ConnectionTable: makeConnectionTable(),
-		ProposalSate:    makeProposalStore(),
+		ProposalSate:    makeProposalStore(limits),
+		AddressBook:     makeAddressBook(),
+		Bootstraps:      makeBootstrapSet(),
+		Bans:            makeBanList(c),
+		EvidenceLimit:   ratelimit.NewKeyed(c, float64(cfg.Limits.EvidenceRate)/60, float64(cfg.Limits.EvidenceBurst)),
 	}
 }
@@ -0,0 +1,482 @@
+package models
+
+import (
+	"bytes"
+	"sync"
+)
+
+// RoundState 一个轮次的提案、打分签名、担保与本地分数，全部数据由同一把锁保护
+// 轮次结束后数据被释放，所有写入返回 ErrRoundInactive
+type RoundState struct {
+	// 轮次，只读
+	Round int64
+	lock  sync.RWMutex
+	store *ProposalStore
+	// 是否已结束
+	closed bool
+	// 提案哈希 | 提案数据，尚未收到本体的提案只有签名集
+	proposals map[[32]byte]*roundProposal
+	// 提案者 NodeId | 首个提案，提案被淘汰后仍保留，用于发现双重提案并构建证据
+	proposers map[[32]byte]proposerEntry
+	// 已收到本体的提案数
+	bodies int
+	// 本节点的提案，不淘汰
+	pinned [32]byte
+	// 本轮次计入的字节数
+	bytes int
+	// 通知通道，收到提案或签名后写入提案哈希，不关闭
+	update chan [32]byte
+}
+
+// roundProposal 一个提案哈希的全部数据
+type roundProposal struct {
+	body    ProposalBody
+	hasBody bool
+	// 签名者 NodeId | 签名信息
+	sigs map[[32]byte]Attestation
+	// 担保者 | 被担保者 | 签名信息
+	guarantees map[[32]byte]map[[32]byte]Guarantee
+	// 本地分数，scored 为 false 时尚未打分
+	score  Score
+	scored bool
+	// 计入的字节数
+	bytes int
+	// 签名写入序号，每写入一个签名加一
+	seq uint64
+	// 签名者 NodeId | 其当前签名写入时的序号
+	seqs map[[32]byte]uint64
+	// 邻居 NodeId | 已发给该邻居的签名序号，有记录的邻居已持有提案本体
+	sent map[[32]byte]uint64
+}
+
+// ProposalSummary 提案概况
+type ProposalSummary struct {
+	PHash          [32]byte
+	ProposerPubKey [32]byte
+	Timestamp      uint64
+	PayloadSize    int
+	Signers        int
+	Score          Score
+}
+
+// makeRoundState 初始化轮次
+func makeRoundState(store *ProposalStore, round int64) *RoundState {
+	out := RoundState{
+		Round:     round,
+		store:     store,
+		proposals: make(map[[32]byte]*roundProposal),
+		proposers: make(map[[32]byte]proposerEntry),
+		update:    make(chan [32]byte, 128),
+	}
+
+	return &out
+}
+
+// newRoundProposal 初始化提案数据
+func newRoundProposal() *roundProposal {
+	return &roundProposal{
+		sigs:       make(map[[32]byte]Attestation),
+		guarantees: make(map[[32]byte]map[[32]byte]Guarantee),
+		seqs:       make(map[[32]byte]uint64),
+		sent:       make(map[[32]byte]uint64),
+	}
+}
+
+// close 结束轮次并释放占用
+func (r *RoundState) close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.closed = true
+	r.release(r.bytes)
+	r.proposals = nil
+	r.proposers = nil
+	r.bodies = 0
+}
+
+// charge 计入占用，调用方持有锁
+func (r *RoundState) charge(n int) {
+	r.bytes += n
+	r.store.bytes.Add(int64(n))
+}
+
+// release 释放占用，调用方持有锁
+func (r *RoundState) release(n int) {
+	r.bytes -= n
+	r.store.bytes.Add(-int64(n))
+}
+
+// overBudget 再计入 n 字节是否超过全部轮次的上限
+func (r *RoundState) overBudget(n int) bool {
+	return int(r.store.bytes.Load())+n > r.store.limits.MaxBytes
+}
+
+// AddProposal 写入提案本体，返回是否为新提案
+// 每个提案者每轮只接受一个提案，空间不足时淘汰本轮分数最低的条目，pin 为 true 的提案不会被淘汰
+func (r *RoundState) AddProposal(pHash [32]byte, proposerId [32]byte, p ProposalBody, pin bool) (bool, error) {
+	limits := r.store.limits
+	if len(p.Payload) > limits.MaxPayload {
+		return false, ErrPayloadTooLarge
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return false, ErrRoundInactive
+	}
+
+	// 一个提案者一个提案
+	known, proposed := r.proposers[proposerId]
+	if proposed && known.pHash != pHash {
+		return false, ErrEquivocation
+	}
+
+	e, exists := r.proposals[pHash]
+	if exists && e.hasBody {
+		return false, nil
+	}
+
+	// 提案者记录在轮次结束前不释放，单独计入
+	size := proposalOverhead + len(p.Payload)
+	total := size
+	if !proposed {
+		total += proposerSize
+	}
+	if !pin {
+		if r.bodies >= limits.MaxProposals && !r.evict(pHash, true) {
+			return false, ErrStoreFull
+		}
+		for r.overBudget(total) {
+			if !r.evict(pHash, false) {
+				return false, ErrStoreFull
+			}
+		}
+	}
+
+	if !exists {
+		e = newRoundProposal()
+		r.proposals[pHash] = e
+	}
+	e.body = p
+	e.hasBody = true
+	e.bytes += size
+	r.bodies++
+	r.proposers[proposerId] = proposerEntry{pHash: pHash, sig: p.ProposerSig}
+	r.charge(total)
+	if pin {
+		r.pinned = pHash
+	}
+
+	return true, nil
+}
+
+// AddAttestation 写入打分签名，同一签名者只保留分数更高的签名，返回是否写入
+// 与已有签名矛盾时不写入并返回 ErrConflictingAttestation，尚未收到本体的提案最多保留 MaxProposals 个签名集
+func (r *RoundState) AddAttestation(pHash [32]byte, signerId [32]byte, att Attestation) (bool, error) {
+	limits := r.store.limits
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return false, ErrRoundInactive
+	}
+
+	e, exists := r.proposals[pHash]
+	var old Attestation
+	signed := false
+	if exists {
+		old, signed = e.sigs[signerId]
+	}
+	if signed && old.Conflicts(att) {
+		return false, ErrConflictingAttestation
+	}
+	if signed && old.Score >= att.Score {
+		return false, nil
+	}
+
+	if !signed {
+		if exists && len(e.sigs) >= limits.MaxSigners {
+			return false, ErrStoreFull
+		}
+		if !exists && len(r.proposals)-r.bodies >= limits.MaxProposals {
+			return false, ErrStoreFull
+		}
+		for r.overBudget(attestationSize) {
+			if !r.evict(pHash, false) {
+				return false, ErrStoreFull
+			}
+		}
+
+		if !exists {
+			e = newRoundProposal()
+			r.proposals[pHash] = e
+		}
+		e.bytes += attestationSize
+		r.charge(attestationSize)
+	}
+	e.sigs[signerId] = att
+	e.seq++
+	e.seqs[signerId] = e.seq
+
+	return true, nil
+}
+
+// evict 淘汰本轮中的一个条目，优先淘汰尚未收到本体的签名集，其次是分数最低的提案
+// bodiesOnly 时只淘汰提案，不淘汰 keep 与本节点的提案
+// 没有可淘汰的条目时返回 false，调用方持有锁
+func (r *RoundState) evict(keep [32]byte, bodiesOnly bool) bool {
+	var victim [32]byte
+	found := false
+	var lowest uint32
+
+	for pHash, e := range r.proposals {
+		if pHash == keep || pHash == r.pinned || (bodiesOnly && !e.hasBody) {
+			continue
+		}
+		if !e.hasBody {
+			victim, found = pHash, true
+			break
+		}
+		if !found || e.score.Score < lowest {
+			victim, found, lowest = pHash, true, e.score.Score
+		}
+	}
+
+	if !found {
+		return false
+	}
+
+	e := r.proposals[victim]
+	r.release(e.bytes)
+	if e.hasBody {
+		r.bodies--
+	}
+	delete(r.proposals, victim)
+
+	return true
+}
+
+// Proposer 提案者在本轮提交的首个提案哈希及其签名
+func (r *RoundState) Proposer(proposerId [32]byte) ([32]byte, [64]byte, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	e, ok := r.proposers[proposerId]
+	return e.pHash, e.sig, ok
+}
+
+// Attestation 签名者对提案的打分签名
+func (r *RoundState) Attestation(pHash [32]byte, signerId [32]byte) (Attestation, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	e, ok := r.proposals[pHash]
+	if !ok {
+		return Attestation{}, false
+	}
+	att, ok := e.sigs[signerId]
+	return att, ok
+}
+
+// HasProposal 是否已收到提案本体
+func (r *RoundState) HasProposal(pHash [32]byte) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	e, ok := r.proposals[pHash]
+	return ok && e.hasBody
+}
+
+// Attestations 提案签名集的副本，未收到本体时返回 false
+func (r *RoundState) Attestations(pHash [32]byte) (map[[32]byte]Attestation, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	e, ok := r.proposals[pHash]
+	if !ok || !e.hasBody {
+		return nil, false
+	}
+	return cloneAttestationMap(e.sigs), true
+}
+
+// Unsent 提案本体与尚未发给 peer 的签名集，seq 为当前签名序号，发送后交给 Delivered
+// held 为 true 时 peer 已持有提案本体，未收到本体时 ok 为 false
+func (r *RoundState) Unsent(pHash [32]byte, peer [32]byte) (p ProposalBody, sigs map[[32]byte]Attestation, gua map[[32]byte]map[[32]byte]Guarantee, seq uint64, held bool, ok bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	e, exists := r.proposals[pHash]
+	if !exists || !e.hasBody {
+		return ProposalBody{}, nil, nil, 0, false, false
+	}
+
+	sent, held := e.sent[peer]
+	sigs = make(map[[32]byte]Attestation)
+	for signerId, att := range e.sigs {
+		if e.seqs[signerId] > sent {
+			sigs[signerId] = att
+		}
+	}
+
+	return cloneProposalBody(e.body), sigs, cloneGuaranteeMapMap(e.guarantees), e.seq, held, true
+}
+
+// Delivered 记录 peer 已持有提案本体以及序号不大于 seq 的签名
+func (r *RoundState) Delivered(pHash [32]byte, peer [32]byte, seq uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	e, ok := r.proposals[pHash]
+	if !ok {
+		return
+	}
+	if sent, held := e.sent[peer]; !held || seq > sent {
+		e.sent[peer] = seq
+	}
+}
+
+// Snapshot 提案本体、签名集与担保的副本，未收到本体时返回 false
+func (r *RoundState) Snapshot(pHash [32]byte) (ProposalBody, map[[32]byte]Attestation, map[[32]byte]map[[32]byte]Guarantee, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	e, ok := r.proposals[pHash]
+	if !ok || !e.hasBody {
+		return ProposalBody{}, nil, nil, false
+	}
+	return cloneProposalBody(e.body), cloneAttestationMap(e.sigs), cloneGuaranteeMapMap(e.guarantees), true
+}
+
+// UpdateScore 在锁内修改提案的本地分数并标记为已打分，未收到本体时返回 false
+func (r *RoundState) UpdateScore(pHash [32]byte, f func(Score) Score) (Score, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	e, ok := r.proposals[pHash]
+	if !ok || !e.hasBody {
+		return Score{}, false
+	}
+	e.score = f(e.score)
+	e.scored = true
+
+	return e.score, true
+}
+
+// Leading 已打分的提案中分数第一的提案，同时返回其分数
+// 与 consensus.Machine.Leader 一致：分数高者胜出，分数相同时提案哈希较小者胜出
+func (r *RoundState) Leading() ([32]byte, ProposalBody, uint32) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	var winner [32]byte
+	var wp ProposalBody
+	var no1 uint32 = 0
+	found := false
+
+	for pHash, e := range r.proposals {
+		if !e.hasBody || !e.scored {
+			continue
+		}
+		if !found || e.score.Score > no1 || (e.score.Score == no1 && bytes.Compare(pHash[:], winner[:]) < 0) {
+			winner, wp, no1, found = pHash, e.body, e.score.Score, true
+		}
+	}
+
+	return winner, cloneProposalBody(wp), no1
+}
+
+// Count 已收到本体的提案数
+func (r *RoundState) Count() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.bodies
+}
+
+// Summaries 已收到本体的提案概况
+func (r *RoundState) Summaries() []ProposalSummary {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	out := make([]ProposalSummary, 0, r.bodies)
+	for pHash, e := range r.proposals {
+		if !e.hasBody {
+			continue
+		}
+		out = append(out, ProposalSummary{
+			PHash:          pHash,
+			ProposerPubKey: e.body.ProposerPubKey,
+			Timestamp:      e.body.Timestamp,
+			PayloadSize:    len(e.body.Payload),
+			Signers:        len(e.sigs),
+			Score:          e.score,
+		})
+	}
+
+	return out
+}
+
+// Updates 通知通道
+func (r *RoundState) Updates() <-chan [32]byte {
+	return r.update
+}
+
+// Notify 通知轮次处理提案，通道已满或轮次已结束时丢弃
+func (r *RoundState) Notify(pHash [32]byte) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if r.closed {
+		return
+	}
+	select {
+	case r.update <- pHash:
+	default:
+	}
+}
+
+func cloneAttestationMap(src map[[32]byte]Attestation) map[[32]byte]Attestation {
+	dst := make(map[[32]byte]Attestation, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+func cloneGuaranteeMapMap(src map[[32]byte]map[[32]byte]Guarantee) map[[32]byte]map[[32]byte]Guarantee {
+	dst := make(map[[32]byte]map[[32]byte]Guarantee, len(src))
+
+	for outerKey, innerMap := range src {
+		if innerMap == nil {
+			dst[outerKey] = nil
+			continue
+		}
+
+		copiedInner := make(map[[32]byte]Guarantee, len(innerMap))
+		for innerKey, guarantee := range innerMap {
+			copiedInner[innerKey] = guarantee
+		}
+
+		dst[outerKey] = copiedInner
+	}
+
+	return dst
+}
+
+func cloneProposalBody(src ProposalBody) ProposalBody {
+	dst := ProposalBody{
+		ProposerPubKey: src.ProposerPubKey,
+		Timestamp:      src.Timestamp,
+		ProposerSig:    src.ProposerSig,
+	}
+
+	// 对 Payload 做深拷贝
+	if src.Payload != nil {
+		dst.Payload = make([]byte, len(src.Payload))
+		copy(dst.Payload, src.Payload)
+	}
+
+	return dst
+}
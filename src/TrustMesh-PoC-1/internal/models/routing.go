@@ -0,0 +1,156 @@
+package models
+
+import (
+	"bytes"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// BucketSize 每个 k-bucket 的容量（Kademlia 中的 k）
+	BucketSize = 16
+	// BucketCount k-bucket 数量，对应 256 位 NodeId
+	BucketCount = 256
+	// contactStaleAfter 超过该时间未见的联系人可以被替换
+	contactStaleAfter = 10 * time.Minute
+)
+
+// Contact 路由表联系人
+type Contact struct {
+	NodeId   [32]byte
+	Address  string
+	LastSeen time.Time
+}
+
+// RoutingTable Kademlia 路由表
+type RoutingTable struct {
+	Lock    sync.RWMutex
+	Self    [32]byte
+	Buckets [BucketCount][]Contact
+}
+
+// NewRoutingTable 以本地 NodeId 初始化路由表
+func NewRoutingTable(self [32]byte) *RoutingTable {
+	return &RoutingTable{Self: self}
+}
+
+// Distance XOR 距离
+func Distance(a [32]byte, b [32]byte) [32]byte {
+	var out [32]byte
+	for i := range out {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
+
+// BucketIndex 返回 id 相对于 self 所在的 bucket，公共前缀越长下标越大
+// id 与 self 相同时返回 -1
+func BucketIndex(self [32]byte, id [32]byte) int {
+	d := Distance(self, id)
+	for i, b := range d {
+		if b != 0 {
+			return i*8 + bits.LeadingZeros8(b)
+		}
+	}
+	return -1
+}
+
+// Add 添加或刷新联系人
+// bucket 已满时仅替换已过期的最久未见联系人，返回是否写入
+func (rt *RoutingTable) Add(c Contact) bool {
+	idx := BucketIndex(rt.Self, c.NodeId)
+	if idx < 0 || c.Address == "" {
+		return false
+	}
+	if c.LastSeen.IsZero() {
+		c.LastSeen = time.Now()
+	}
+
+	rt.Lock.Lock()
+	defer rt.Lock.Unlock()
+
+	bucket := rt.Buckets[idx]
+
+	// 已存在 → 移到队尾（最近见过）
+	for i, v := range bucket {
+		if v.NodeId == c.NodeId {
+			bucket = append(bucket[:i], bucket[i+1:]...)
+			rt.Buckets[idx] = append(bucket, c)
+			return true
+		}
+	}
+
+	// 未满 → 追加
+	if len(bucket) < BucketSize {
+		rt.Buckets[idx] = append(bucket, c)
+		return true
+	}
+
+	// 已满 → 替换过期的队首
+	if time.Since(bucket[0].LastSeen) > contactStaleAfter {
+		bucket = append(bucket[1:], c)
+		rt.Buckets[idx] = bucket
+		return true
+	}
+
+	return false
+}
+
+// Remove 删除联系人
+func (rt *RoutingTable) Remove(id [32]byte) {
+	idx := BucketIndex(rt.Self, id)
+	if idx < 0 {
+		return
+	}
+
+	rt.Lock.Lock()
+	defer rt.Lock.Unlock()
+
+	bucket := rt.Buckets[idx]
+	for i, v := range bucket {
+		if v.NodeId == id {
+			rt.Buckets[idx] = append(bucket[:i], bucket[i+1:]...)
+			return
+		}
+	}
+}
+
+// Closest 返回距离 target 最近的 n 个联系人
+func (rt *RoutingTable) Closest(target [32]byte, n int) []Contact {
+	rt.Lock.RLock()
+	out := make([]Contact, 0, n)
+	for _, bucket := range rt.Buckets {
+		out = append(out, bucket...)
+	}
+	rt.Lock.RUnlock()
+
+	SortByDistance(out, target)
+	if len(out) > n {
+		out = out[:n]
+	}
+
+	return out
+}
+
+// Size 联系人总数
+func (rt *RoutingTable) Size() int {
+	rt.Lock.RLock()
+	defer rt.Lock.RUnlock()
+
+	n := 0
+	for _, bucket := range rt.Buckets {
+		n += len(bucket)
+	}
+	return n
+}
+
+// SortByDistance 按与 target 的 XOR 距离升序排序
+func SortByDistance(contacts []Contact, target [32]byte) {
+	sort.Slice(contacts, func(i, j int) bool {
+		di := Distance(contacts[i].NodeId, target)
+		dj := Distance(contacts[j].NodeId, target)
+		return bytes.Compare(di[:], dj[:]) < 0
+	})
+}
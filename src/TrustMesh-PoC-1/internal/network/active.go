@@ -1,109 +1,146 @@
 package network
 
 import (
+	"TrustMesh-PoC-1/internal/clock"
 	"TrustMesh-PoC-1/internal/consensus"
 	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/maddr"
 	"TrustMesh-PoC-1/internal/models"
 	"TrustMesh-PoC-1/internal/p2p"
-	"TrustMesh-PoC-1/internal/tools"
-	"encoding/binary"
+	"context"
+	"errors"
 	"fmt"
 	"net"
-	"os"
-	"strconv"
+	"sync"
 	"time"
 )
 
-// StartRequestList 向引导节点请求节点列表
-func StartRequestList(mainState *models.MainStore) error {
-	ct := mainState.ConnectionTable
+// reportInterval 向引导节点汇报的间隔
+const reportInterval = 60 * time.Second
+
+// StartRequestList 定期向引导节点汇报并请求节点列表
+// 可以配置多个引导节点，失败时依次切换
+func StartRequestList(ctx context.Context, mainState *models.MainStore) error {
+	cfg := mainState.Config
+	localAddr := cfg.Node.Host
+	bootstraps := cfg.Bootstrap.Addrs
+	if len(bootstraps) == 0 {
+		return fmt.Errorf("bootstrap is empty")
+	}
+
+	// 从上次成功的引导节点开始尝试
+	current := 0
+	ticker := time.NewTicker(reportInterval)
+	defer ticker.Stop()
+
+	for {
+		for i := 0; i < len(bootstraps); i++ {
+			idx := (current + i) % len(bootstraps)
+			if err := reportBootstrap(ctx, mainState, bootstraps[idx], localAddr); err != nil {
+				logger.Warning("Report to bootstrap %v failed: %v", bootstraps[idx], err)
+				continue
+			}
+			current = idx
+			break
+		}
 
-	var localAddr []byte
-	if host, isExist := os.LookupEnv("HOST"); !isExist {
-		return fmt.Errorf("NODE_PORT is missing")
-	} else {
-		localAddr = []byte(host)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
 	}
+}
 
-	bootstrap, isExist := os.LookupEnv("BOOTSTRAP")
-	if !isExist {
-		return fmt.Errorf("BOOTSTRAP is missing")
+// reportBootstrap 向单个引导节点发送自签名的地址记录
+func reportBootstrap(ctx context.Context, mainState *models.MainStore, bootstrap string, localAddr string) error {
+	record, err := p2p.NewAddressRecord(mainState.Signer, advertisedAddress(mainState.AddressBook, localAddr))
+	if err != nil {
+		return err
 	}
+	message := p2p.BuildBootstrapReport(record)
 
-	rawConn, err := net.Dial("tcp", bootstrap)
+	bootstrapId, err := mainState.ConnManager.Connect(ctx, bootstrap, [32]byte{})
 	if err != nil {
-		return fmt.Errorf(err.Error())
+		return fmt.Errorf("connect bootstrap failed: %w", err)
 	}
+	mainState.Bootstraps.Add(bootstrapId)
 
-	// 创建 [4]byte 格式的 header
-	var header [4]byte
-	binary.BigEndian.PutUint32(header[:], p2p.MsgBootstrapReport)
-	var length [4]byte
-	// !!! 截断风险 !!!
-	binary.BigEndian.PutUint32(length[:], uint32(len(localAddr)))
+	if err := mainState.ConnManager.Send(bootstrapId, message); err != nil {
+		return fmt.Errorf("failed to send: %w", err)
+	}
 
-	var message []byte
-	message = append(message, header[:]...)
-	message = append(message, length[:]...)
-	message = append(message, localAddr...)
+	return nil
+}
 
-	ready := make(chan [32]byte, 1)
-	done := make(chan struct{})
+// advertisedAddress 结合自报地址与观测地址选出对外公布的地址
+// 自报地址未被判定不可达时优先使用，否则使用观测者最多的 IP 加自报端口
+func advertisedAddress(book *models.AddressBook, host string) string {
+	if ok, known := book.IsReachable(host); !known || ok {
+		return host
+	}
 
-	go p2p.HandleConnection(rawConn, mainState, ready, true)
+	ip, votes := book.BestObserved()
+	if votes == 0 {
+		return host
+	}
 
-	select {
-	case realId := <-ready:
-		close(done)
+	a, err := maddr.Parse(host)
+	if err != nil || a.Network() != "tcp" {
+		return host
+	}
 
-		ct.Lock.RLock()
-		newConn, ok := ct.Connection[realId]
-		ct.Lock.RUnlock()
+	candidate := net.JoinHostPort(ip, a.Port)
+	if ok, known := book.IsReachable(candidate); known && !ok {
+		return host
+	}
 
-		if !ok {
-			return fmt.Errorf("connection not found")
-		}
+	logger.Info("Address %v is not reachable, advertise observed address %v", host, candidate)
 
-		select {
-		case newConn.WriteQueue <- message:
-			return nil
-		default:
-			return fmt.Errorf("failed to send")
-		}
-	case <-tools.WaitTimeout(done, 5*time.Second):
-		return fmt.Errorf("send timeout")
-	}
+	return candidate
 }
 
 // StartNodeClient 启动节点主动服务
-func StartNodeClient(mainState *models.MainStore) error {
+// ctx 取消后不再开始新轮次，进行中的轮次最多再运行 drain，超时后保存检查点退出
+func StartNodeClient(ctx context.Context, mainState *models.MainStore, drain time.Duration) error {
 	var round int64 = 0
-	var interval time.Duration
+	interval := mainState.Config.Interval()
 
-	// 提取环境变量里的轮次间隔
-	if val, exists := os.LookupEnv("INTERVAL"); exists {
-		num, err := strconv.Atoi(val)
-		if err != nil {
-			return fmt.Errorf("WAIT_TIME is not a number")
-		} else if num <= 0 {
-			return fmt.Errorf("WAIT_TIME must > 0")
-		}
-		interval = time.Duration(num) * time.Second
-	} else {
-		return fmt.Errorf("INTERVAL is missing")
-	}
+	// 轮次不随 ctx 立即取消，而是在 drain 之后取消
+	roundCtx, cancelRounds := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelRounds()
+
+	var wg sync.WaitGroup
+
+	timer := consensus.NewRoundTimer(mainState.Clock, interval)
+	defer timer.Stop()
 
 	// 轮次循环
 	for {
-		select {
-		case round = <-consensus.TimeRoundEngine(interval, round):
-			go func(r int64) {
-				logger.Info("New round: %v", r)
-				if err := consensus.ExecuteRound(mainState, r, interval); err != nil {
-					logger.Error("ExecuteRound error: %v", err)
-				}
-			}(round)
-			round++
+		var err error
+		round, err = timer.TimeRoundEngine(ctx, round)
+		if err != nil {
+			logger.Info("Stop starting new rounds, waiting for running rounds")
+
+			drainCtx, stop := clock.WithTimeout(roundCtx, mainState.Clock, drain)
+			defer stop()
+			context.AfterFunc(drainCtx, cancelRounds)
+
+			wg.Wait()
+			return nil
 		}
+
+		wg.Add(1)
+		go func(r int64) {
+			defer wg.Done()
+			logger.Info("New round: %v", r)
+			err := consensus.ExecuteRound(roundCtx, mainState, r, interval)
+			if errors.Is(err, context.Canceled) {
+				logger.Info("Round %v stopped by shutdown", r)
+			} else if err != nil {
+				logger.Error("ExecuteRound error: %v", err)
+			}
+		}(round)
+		round++
 	}
 }
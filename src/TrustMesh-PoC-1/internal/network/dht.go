@@ -0,0 +1,14 @@
+package network
+
+import (
+	"TrustMesh-PoC-1/internal/dht"
+	"TrustMesh-PoC-1/internal/models"
+	"context"
+)
+
+// StartDht 启动 DHT 节点发现，种子地址可选
+func StartDht(ctx context.Context, mainState *models.MainStore) error {
+	dht.Run(ctx, mainState, mainState.Config.Node.DhtSeeds)
+
+	return nil
+}
@@ -1,62 +1,125 @@
 package network
 
 import (
-	"TrustMesh-PoC-1/internal/db"
+	"TrustMesh-PoC-1/internal/config"
 	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/maddr"
+	"TrustMesh-PoC-1/internal/metrics"
 	"TrustMesh-PoC-1/internal/models"
 	"TrustMesh-PoC-1/internal/p2p"
-	"bytes"
-	"encoding/binary"
+	"TrustMesh-PoC-1/internal/ratelimit"
+	"TrustMesh-PoC-1/internal/topology"
+	"context"
+	"encoding/hex"
 	"fmt"
-	"math"
-	"math/rand"
 	"net"
-	"os"
+	"path/filepath"
 	"strconv"
-	"sync"
 	"time"
 )
 
 // StartNodeServer 启动节点监听服务
-func StartNodeServer(mainState *models.MainStore) error {
-	// NODE_PORT 是否合法
-	nodePort, isExist := os.LookupEnv("NODE_PORT")
-	if isExist == false {
-		return fmt.Errorf("NODE_PORT is missing")
-	} else if err := parsePort(nodePort); err != nil {
-		return fmt.Errorf("invalid NODE_PORT: %w", err)
-	}
+func StartNodeServer(ctx context.Context, mainState *models.MainStore) error {
+	cfg := mainState.Config.Node
 
-	addr := ":" + nodePort
+	// 双栈监听，同时接受 IPv4 与 IPv6
+	addr := ":" + strconv.Itoa(cfg.Port)
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return err
 	}
-
 	logger.Info("node is listening on %s", addr)
 
+	// 握手前检查封禁与连接频率
+	accept := newAcceptor(mainState)
+
+	// 额外的监听地址，例如 IPv6 或本地测试用的 Unix 套接字
+	for _, a := range cfg.ListenAddrs {
+		l, err := maddr.Listen(a)
+		if err != nil {
+			closeListener(listener)
+			return fmt.Errorf("failed to listen on %s: %w", a, err)
+		}
+		logger.Info("node is listening on %s", a)
+		go serveListener(ctx, l, accept)
+	}
+
+	serveListener(ctx, listener, accept)
+	return nil
+}
+
+// ServeNode 在已有的监听上接受节点连接，与 StartNodeServer 一样在握手前检查封禁与连接频率
+// ctx 取消时关闭监听，模拟器在内存网络的监听上使用
+func ServeNode(ctx context.Context, mainState *models.MainStore, listener net.Listener) {
+	serveListener(ctx, listener, newAcceptor(mainState))
+}
+
+// newAcceptor 在握手前拒绝被封禁或连接过于频繁的 IP
+func newAcceptor(mainState *models.MainStore) func(net.Conn) {
+	limits := mainState.Config.Limits
+	perIP := ratelimit.NewKeyed(mainState.Clock, float64(limits.AcceptRate)/60, float64(limits.AcceptBurst))
+
+	return func(conn net.Conn) {
+		if ip, ok := p2p.RemoteIP(conn); ok {
+			reason := ""
+			if mainState.Bans.IsIPBanned(ip) {
+				reason = "banned"
+			} else if !perIP.Allow(ip.String()) {
+				reason = "rate_limited"
+			}
+
+			if reason != "" {
+				metrics.Rejected(reason)
+				logger.Debug("Reject connection from %v: %s", conn.RemoteAddr(), reason)
+				if err := conn.Close(); err != nil {
+					logger.Debug("Close rejected connection error: %v", err)
+				}
+				return
+			}
+		}
+
+		mainState.ConnManager.Accept(conn)
+	}
+}
+
+// serveListener 接受连接并移交给处理函数，ctx 取消时关闭监听
+func serveListener(ctx context.Context, listener net.Listener, handle func(net.Conn)) {
+	stop := context.AfterFunc(ctx, func() { closeListener(listener) })
+	defer stop()
+
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			logger.Warning("Connection Error: %v", err)
 			continue
 		}
-		ready := make(chan [32]byte)
-		go p2p.HandleConnection(conn, mainState, ready, false)
+		go handle(conn)
 	}
 }
 
-// StartBootstrapServer 启动引导节点服务
-func StartBootstrapServer(mainState *models.MainStore) error {
-	// NODE_PORT 是否合法
-	nodePort, isExist := os.LookupEnv("NODE_PORT")
-	if isExist == false {
-		return fmt.Errorf("NODE_PORT is missing")
-	} else if err := parsePort(nodePort); err != nil {
-		return fmt.Errorf("invalid NODE_PORT: %w", err)
+// closeListener 关闭监听
+func closeListener(listener net.Listener) {
+	if err := listener.Close(); err != nil {
+		logger.Warning("Close listener error: %v", err)
 	}
+}
 
-	addr := ":" + nodePort
+// StartBootstrapServer 启动引导节点服务，持续运行并即时回复汇报
+func StartBootstrapServer(ctx context.Context, mainState *models.MainStore) error {
+	cfg := mainState.Config.Server
+	n := cfg.Density
+	ttl := mainState.Config.NodeTTL()
+
+	// 拓扑生成器
+	generator, err := parseTopology(cfg)
+	if err != nil {
+		return err
+	}
+
+	addr := ":" + strconv.Itoa(mainState.Config.Node.Port)
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return err
@@ -64,184 +127,60 @@ func StartBootstrapServer(mainState *models.MainStore) error {
 
 	logger.Info("Bootstrap is listening on %s", addr)
 
+	// 输出公钥，供节点通过 BOOTSTRAP_KEYS 固定
+	logger.Info("Bootstrap public key: %s", hex.EncodeToString(mainState.Signer.PublicKey()))
+
 	// 初始化节点列表
 	nl := p2p.NodeList{
-		Node: make(map[[32]byte]string),
+		Node:     make(map[[32]byte]p2p.NodeEntry),
+		Density:  n,
+		TTL:      ttl,
+		Topology: generator,
 	}
-
-	// 获取等待时间
-	var waitTime time.Duration
-	if val, exists := os.LookupEnv("WAIT_TIME"); exists {
-		i, err := strconv.Atoi(val)
-		if err != nil {
-			return fmt.Errorf("WAIT_TIME is not a number")
-		} else if i < 0 {
-			return fmt.Errorf("WAIT_TIME must >= 0")
-		}
-		waitTime = time.Duration(i) * time.Second
-	} else {
-		return fmt.Errorf("WAIT_TIME is missing")
+	if generator != nil {
+		nl.SnapshotPath = filepath.Join(mainState.Config.DataDir, "topology.json")
 	}
 
-	timer := time.NewTimer(waitTime)
-	stop := make(chan struct{})
+	// 定期清理过期节点
 	go func() {
+		ticker := time.NewTicker(ttl / 2)
+		defer ticker.Stop()
+
 		for {
-			conn, err := listener.Accept()
-			if err != nil {
-				select {
-				case <-stop:
-					return
-				default:
-					logger.Warning("Accept error: %v", err)
-					continue
-				}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
 			}
-			go p2p.BootstrapHandleConnection(conn, &nl, mainState)
-		}
-	}()
 
-	// 主控方
-	select {
-	case <-timer.C:
-		close(stop)
-		if err := listener.Close(); err != nil {
-			return err
-		}
-	}
-
-	var n int
-	if val, exists := os.LookupEnv("DENSITY"); exists {
-		i, err := strconv.Atoi(val)
-		if err != nil {
-			return fmt.Errorf("DENSITY is not a number")
-		} else if i <= 0 {
-			return fmt.Errorf("DENSITY must > 0")
+			if count := nl.Expire(); count > 0 {
+				logger.Debug("Bootstrap expired %v nodes", count)
+			}
 		}
-		n = i
-	} else {
-		return fmt.Errorf("DENSITY is missing")
-	}
-
-	nl.Mu.Lock()
-	nodeList := nl.Node
+	}()
 
-	replyAddr := make(map[[32]byte][]byte, len(nodeList))
-	queue := make([][32]byte, 0, len(nodeList)*n)
+	serveListener(ctx, listener, func(conn net.Conn) {
+		p2p.BootstrapHandleConnection(ctx, conn, &nl, mainState)
+	})
+	return nil
+}
 
-	o := 0
-	for k := range nodeList {
-		for i := 0; i < n; i++ {
-			queue = append(queue, k)
-			o++
-		}
+// parseTopology 根据配置创建拓扑生成器，random 时返回 nil（随机抽样）
+func parseTopology(cfg config.ServerConfig) (topology.Generator, error) {
+	if cfg.Topology == "" || cfg.Topology == "random" {
+		return nil, nil
 	}
 
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	r.Shuffle(len(queue), func(i, j int) { queue[i], queue[j] = queue[j], queue[i] })
-
-	// 分配地址
-	idx := 0
-	for k := range nodeList {
-		var v [][]byte
-		var data []byte
-		retry := 0
-		for j := 0; j < n && idx < len(queue); {
-			msg := make([]byte, 0, 32)
-
-			msg = append(msg, queue[idx][:]...)
-			msg = append(msg, '+')
-			msg = append(msg, []byte(nodeList[queue[idx]])...)
-			msg = append(msg, ';')
-			flag := true
-
-			// 检查冲突
-			for _, vV := range v {
-				if bytes.Equal(msg, vV) || queue[idx] == k {
-					flag = false
-					break
-				}
-			}
-
-			// 如果不冲突执行下一个，冲突就将当前项移到末尾并重试
-			if flag {
-				v = append(v, msg)
-				j++
-				idx++
-				retry = 0
-			} else {
-				moveToEnd(queue, idx)
-				retry++
-			}
-
-			// 如果重试次数过多就强制退出
-			if retry >= 100 {
-				break
-			}
-		}
-		for _, kV := range v {
-			data = append(data, kV...)
-		}
-		replyAddr[k] = append(replyAddr[k], data...)
+	opt := topology.Options{
+		Beta:     cfg.TopologyBeta,
+		Clusters: cfg.TopologyClusters,
+		Bridges:  cfg.TopologyBridges,
 	}
 
-	// 互认
-	for k, data := range replyAddr {
-		for i := 0; i < len(data); {
-			var peerID [32]byte
-			copy(peerID[:], data[i:i+32])
-
-			// 检查 peerID 是否已包含 k
-			if !containsPeer(replyAddr[peerID], k) {
-				addr := nodeList[k]
-				peerMsg := make([]byte, 0, 32)
-
-				peerMsg = append(peerMsg, k[:]...)
-				peerMsg = append(peerMsg, '+')
-				peerMsg = append(peerMsg, addr...)
-				peerMsg = append(peerMsg, ';')
-				replyAddr[peerID] = append(replyAddr[peerID], peerMsg...)
-			}
-
-			i += 32
-			// 找到 ';'
-			for i < len(data) && data[i] != ';' {
-				i++
-			}
-			i++ // 跳过 ';'
-		}
-	}
-	nl.Mu.Unlock()
-
-	var wg sync.WaitGroup
-	for k, data := range replyAddr {
-		var message []byte
-		// 创建 [4]byte 格式的 header
-		var header [4]byte
-		binary.BigEndian.PutUint32(header[:], p2p.MsgBootstrapReply)
-		// 创建 [4]byte 格式的 length
-		if len(data) > math.MaxInt32 {
-			logger.Warning("Message too large (%d bytes)", len(data))
-			continue
-		}
-		var length [4]byte
-		binary.BigEndian.PutUint32(length[:], uint32(len(data)))
-		message = append(message, header[:]...)
-		message = append(message, length[:]...)
-		message = append(message, data...)
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			if ok := p2p.SendNodeIdMessage(k, message, db.GetDB(), mainState); !ok {
-				logger.Warning("Failed to send to: %v message: %v", k, message)
-			}
-		}()
+	generator, err := topology.New(cfg.Topology, cfg.Density, opt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid topology: %w", err)
 	}
 
-	wg.Wait()
-
-	logger.Info("All work is done")
-
-	return nil
+	return generator, nil
 }
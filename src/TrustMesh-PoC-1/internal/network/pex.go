@@ -0,0 +1,210 @@
+package network
+
+import (
+	"TrustMesh-PoC-1/internal/clock"
+	"TrustMesh-PoC-1/internal/db"
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/maddr"
+	"TrustMesh-PoC-1/internal/models"
+	"TrustMesh-PoC-1/internal/p2p"
+	"TrustMesh-PoC-1/internal/ratelimit"
+	"TrustMesh-PoC-1/internal/table"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+const (
+	// pexInterval 节点交换间隔
+	pexInterval = 30 * time.Second
+	// pexFanout 每次向多少个邻居请求
+	pexFanout = 3
+	// pexTimeout 等待回复的超时
+	pexTimeout = 10 * time.Second
+	// pexProbes 每个邻居在一个交换间隔内最多触发的回拨验证次数
+	pexProbes = 8
+)
+
+// StartPex 定期向邻居请求节点列表，使网络不依赖引导节点
+func StartPex(ctx context.Context, mainState *models.MainStore) error {
+	// 按回复方限制回拨验证的频率
+	probes := ratelimit.NewKeyed(mainState.Clock, pexProbes/pexInterval.Seconds(), pexProbes)
+
+	for {
+		select {
+		case <-mainState.Clock.After(pexInterval):
+		case <-ctx.Done():
+			return nil
+		}
+
+		targets := pexTargets(mainState, pexFanout)
+		if len(targets) == 0 {
+			logger.Test("Pex no neighbour available")
+			continue
+		}
+
+		for _, nodeId := range targets {
+			go func(id [32]byte) {
+				if err := requestPex(ctx, mainState, id, probes); err != nil {
+					logger.Debug("Pex request to %v failed: %v", id, err)
+				}
+			}(nodeId)
+		}
+	}
+}
+
+// requestPex 向邻居请求节点列表并等待回复
+// 新地址必须回拨验证，且握手得到的 NodeId 与记录一致才会写入节点表，验证连接随即关闭
+func requestPex(ctx context.Context, mainState *models.MainStore, nodeId [32]byte, probes *ratelimit.Keyed) error {
+	ctx, cancel := clock.WithTimeout(ctx, mainState.Clock, pexTimeout)
+	defer cancel()
+
+	ioc, err := mainState.ConnManager.Acquire(ctx, nodeId)
+	if err != nil {
+		return err
+	}
+
+	// 生成事务 ID
+	var transaction [32]byte
+	if _, err := crand.Read(transaction[:]); err != nil {
+		return fmt.Errorf("get nonce failed: %w", err)
+	}
+
+	// 写入返回通道
+	reply := make(chan []byte, 1)
+	ioc.ChannelsLock.Lock()
+	ioc.Channels[transaction] = reply
+	ioc.ChannelsLock.Unlock()
+
+	// 注册清理逻辑
+	defer func() {
+		ioc.ChannelsLock.Lock()
+		delete(ioc.Channels, transaction)
+		ioc.ChannelsLock.Unlock()
+	}()
+
+	// 发送请求
+	select {
+	case ioc.WriteQueue <- p2p.BuildPexRequest(p2p.MaxPexRecords, transaction):
+	case <-ioc.Ctx.Done():
+		return errors.New("connection is closed")
+	case <-ctx.Done():
+		return fmt.Errorf("send pex request: %w", ctx.Err())
+	}
+
+	// 等待回复
+	var b []byte
+	select {
+	case b = <-reply:
+	case <-ioc.Ctx.Done():
+		return errors.New("connection is closed")
+	case <-ctx.Done():
+		return fmt.Errorf("wait pex response: %w", ctx.Err())
+	}
+
+	database := mainState.DB
+
+	// 回复方在线
+	err = database.Model(&table.Peer{}).
+		Where("node_id = ?", nodeId[:]).
+		Updates(map[string]interface{}{"last_seen": uint64(mainState.Clock.Now().UnixMilli()), "status": "Active"}).Error
+	if err != nil {
+		logger.Error("Failed to update peer: %v", err)
+	}
+
+	myNodeId := blake3.Sum256(mainState.Signer.PublicKey())
+	key := hex.EncodeToString(nodeId[:])
+
+	for _, r := range p2p.ParsePexResponse(b) {
+		if r.NodeId == myNodeId {
+			continue
+		}
+
+		// 已知且地址一致则跳过
+		var known int64
+		err := database.Model(&table.PeerAddress{}).
+			Where("node_id = ? AND address = ?", r.NodeId[:], maddr.Normalize(r.Address)).
+			Count(&known).Error
+		if err != nil {
+			logger.Error("Failed to query peer: %v", err)
+			continue
+		}
+		if known > 0 {
+			continue
+		}
+
+		// 回拨验证
+		if !probes.Allow(key) {
+			logger.Debug("Pex probes from %v exhausted, skip the rest", nodeId)
+			break
+		}
+		realId, err := mainState.ConnManager.Probe(ctx, r.Address)
+		if err != nil {
+			logger.Test("Pex verify %v failed: %v", r.Address, err)
+			continue
+		}
+		if realId != r.NodeId {
+			logger.Debug("Pex record %v mismatch, real NodeId: %v", r.Address, realId)
+			continue
+		}
+
+		err = db.SavePeer(database, r.NodeId, r.Address, "FROM Pex")
+		if err != nil {
+			logger.Error("Failed to save peer: %v", err)
+			continue
+		}
+
+		logger.Debug("Pex new peer: %v %v", r.NodeId, r.Address)
+	}
+
+	return nil
+}
+
+// pexTargets 优先从已连接的邻居中随机选择，不足时从节点表补充
+func pexTargets(mainState *models.MainStore, n int) [][32]byte {
+	ct := mainState.ConnectionTable
+
+	ct.Lock.RLock()
+	out := make([][32]byte, 0, len(ct.Connection))
+	for k := range ct.Connection {
+		out = append(out, k)
+	}
+	ct.Lock.RUnlock()
+
+	rand.Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+	if len(out) >= n {
+		return out[:n]
+	}
+
+	peers := make([]table.Peer, 0, n)
+	err := mainState.DB.
+		Select("node_id").
+		Order("RANDOM()").
+		Limit(n - len(out)).
+		Find(&peers).Error
+	if err != nil {
+		logger.Error("Failed to find peers: %v", err)
+		return out
+	}
+
+	for _, peer := range peers {
+		if len(peer.NodeID) != 32 {
+			continue
+		}
+		var nodeId [32]byte
+		copy(nodeId[:], peer.NodeID)
+		if slices.Contains(out, nodeId) {
+			continue
+		}
+		out = append(out, nodeId)
+	}
+
+	return out
+}
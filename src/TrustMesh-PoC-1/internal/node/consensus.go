@@ -3,11 +3,12 @@ package node
 import (
 	"TrustMesh-PoC-1/internal/consensus"
 	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/metrics"
 	"TrustMesh-PoC-1/internal/models"
 	"TrustMesh-PoC-1/internal/p2p"
-	"TrustMesh-PoC-1/internal/tools"
-	"crypto/ed25519"
+	"TrustMesh-PoC-1/internal/trace"
 	"encoding/binary"
+	"errors"
 	"time"
 
 	"github.com/zeebo/blake3"
@@ -18,8 +19,6 @@ type Node struct{}
 
 // ProcessingInquiry 处理问询信息
 func (Node) ProcessingInquiry(b [72]byte, mainState *models.MainStore, ioc *models.IOChannel) {
-	proposalState := mainState.ProposalSate
-
 	// 轮次
 	var round int64
 	round = int64(binary.BigEndian.Uint64(b[0:8]))
@@ -30,9 +29,7 @@ func (Node) ProcessingInquiry(b [72]byte, mainState *models.MainStore, ioc *mode
 	var transactionId [32]byte
 	copy(transactionId[:], b[40:72])
 
-	proposalState.UpdateLock.RLock()
-	_, exists := proposalState.Update[round]
-	proposalState.UpdateLock.RUnlock()
+	rs, exists := mainState.ProposalSate.Round(round)
 
 	message := make([]byte, 0, 4+32+4)
 
@@ -45,10 +42,7 @@ func (Node) ProcessingInquiry(b [72]byte, mainState *models.MainStore, ioc *mode
 
 	var payload [4]byte
 	if exists {
-		proposalState.DataLock.RLock()
-		_, exists = proposalState.Data[round][pHash]
-		proposalState.DataLock.RUnlock()
-		if exists {
+		if rs.HasProposal(pHash) {
 			binary.BigEndian.PutUint32(payload[:], p2p.TrueOrYes)
 		} else {
 			binary.BigEndian.PutUint32(payload[:], p2p.FalseOrNo)
@@ -60,18 +54,7 @@ func (Node) ProcessingInquiry(b [72]byte, mainState *models.MainStore, ioc *mode
 	// payload
 	message = append(message, payload[:]...)
 
-	select {
-	case <-ioc.Done:
-		return
-	default:
-		ok := make(chan struct{})
-		select {
-		case ioc.WriteQueue <- message:
-			return
-		case <-tools.WaitTimeout(ok, 3*time.Second):
-			return
-		}
-	}
+	p2p.Enqueue(ioc.Ctx, ioc, message, 3*time.Second)
 }
 
 // ProcessingInquiryReply 处理问询回复
@@ -95,11 +78,21 @@ func (Node) ProcessingInquiryReply(b [36]byte, ioc *models.IOChannel) {
 	ioc.ChannelsLock.RUnlock()
 }
 
-// ProcessingProposalBody 处理提案本体
-func (Node) ProcessingProposalBody(b []byte, mainState *models.MainStore) {
+// ProcessingProposalBody 处理提案本体，格式或签名无效时返回违规
+func (Node) ProcessingProposalBody(b []byte, mainState *models.MainStore) error {
+	tc, b, err := trace.SplitContext(b)
+	if err != nil {
+		logger.Debug("Proposal body trace context failed: %v", err)
+		return p2p.ErrMalformed
+	}
 	if len(b) <= 8+32+8+64 {
 		logger.Debug("Proposal body length failed")
-		return
+		return p2p.ErrMalformed
+	}
+	// 载荷超过本节点上限时不校验直接丢弃
+	if len(b)-112 > mainState.Config.Consensus.MaxPayload {
+		logger.Debug("Proposal payload too large: %d", len(b)-112)
+		return nil
 	}
 
 	var proposal models.ProposalBody
@@ -140,27 +133,50 @@ func (Node) ProcessingProposalBody(b []byte, mainState *models.MainStore) {
 	sigData = append(sigData, pHash[:]...)
 	sigDataHash := blake3.Sum256(sigData)
 
-	if !ed25519.Verify(pk[:], sigDataHash[:], sig[:]) {
+	if !mainState.Verified.Verify(pk[:], sigDataHash[:], sig[:]) {
+		metrics.SignatureFailure("proposal")
 		logger.Debug("Proposal Body %v Sig verification failed, pk: %v, sigData: %v", pHash, pk, sigData)
-		return
+		return p2p.ErrInvalidSignature
+	}
+
+	rs, ok := mainState.ProposalSate.Round(round)
+	if !ok {
+		return nil
+	}
+
+	added, err := rs.AddProposal(pHash, nodeId, proposal, false)
+	switch {
+	case errors.Is(err, models.ErrRoundInactive):
+		return nil
+	case errors.Is(err, models.ErrEquivocation):
+		// 提案者本轮已签名过另一个提案，两个签名构成证据
+		if first, firstSig, ok := rs.Proposer(nodeId); ok {
+			submitEvidence(mainState, consensus.NewProposalEvidence(round, pk, first, firstSig, pHash, sig))
+		}
+		return nil
+	case err != nil:
+		logger.With(logger.Round(round), logger.PHash(pHash), logger.NodeId(nodeId)).Debug("Proposal rejected: %v", err)
+		return nil
 	}
 
-	proposalState := mainState.ProposalSate
-	proposalState.DataLock.Lock()
-	_, ok := proposalState.Data[round]
-	_, e := proposalState.Data[round][pHash]
-	if !ok || e {
-		proposalState.DataLock.Unlock()
-		return
+	mainState.Tracer.Receive(round, pHash, trace.MessageBody, tc)
+	if !added {
+		return nil
 	}
-	proposalState.Data[round][pHash] = proposal
-	proposalState.DataLock.Unlock()
+
+	metrics.ProposalReceived()
+	return nil
 }
 
-// ProcessProposalSig 处理提案签名集
-func (Node) ProcessProposalSig(b []byte, mainState *models.MainStore) {
+// ProcessProposalSig 处理提案签名集，格式或任一签名无效时返回违规
+func (Node) ProcessProposalSig(b []byte, mainState *models.MainStore) error {
+	tc, b, err := trace.SplitContext(b)
+	if err != nil {
+		logger.Debug("Proposal sig trace context failed: %v", err)
+		return p2p.ErrMalformed
+	}
 	if len(b) <= 8+32+2 {
-		return
+		return p2p.ErrMalformed
 	}
 
 	var round int64
@@ -172,12 +188,20 @@ func (Node) ProcessProposalSig(b []byte, mainState *models.MainStore) {
 	var signerCount int
 	signerCount = int(binary.BigEndian.Uint16(b[40:42]))
 
+	rs, ok := mainState.ProposalSate.Round(round)
+	if !ok {
+		return nil
+	}
+
+	// 签名无效的发送方在处理完其余签名后计入违规
+	var misbehaviour error
+
 	// TODO: 剪枝
 	idx := 42
 	for i := 0; i < signerCount; i++ {
 		if len(b) < idx+32+4+8+64+2 {
 			logger.Debug("ProcessProposalSig too short")
-			continue
+			return p2p.ErrMalformed
 		}
 
 		var sig models.Attestation
@@ -215,38 +239,39 @@ func (Node) ProcessProposalSig(b []byte, mainState *models.MainStore) {
 		sigData = append(sigData, timestampByte[:]...)
 		sigDataHash := blake3.Sum256(sigData)
 
-		if !ed25519.Verify(sig.SignerPubKey[:], sigDataHash[:], sig.Signature[:]) {
+		if !mainState.Verified.Verify(sig.SignerPubKey[:], sigDataHash[:], sig.Signature[:]) {
+			metrics.SignatureFailure("attestation")
 			logger.Debug("ProcessProposalSig %v Sig verification failed", sig)
+			misbehaviour = p2p.ErrInvalidSignature
+			idx += guaranteeCount * (32 + 64)
 			continue
 		}
 
 		// 将分数写入提案
-		mainState.ProposalSate.SigLock.Lock()
-		_, ok := mainState.ProposalSate.Sig[round]
-		_, existsP := mainState.ProposalSate.Sig[round][pHash]
-
-		if !ok {
-			mainState.ProposalSate.SigLock.Unlock()
-			return
+		added, err := rs.AddAttestation(pHash, nodeId, sig)
+		if errors.Is(err, models.ErrRoundInactive) {
+			return misbehaviour
 		}
-
-		if !existsP {
-			mainState.ProposalSate.Sig[round][pHash] = make(map[[32]byte]models.Attestation)
-		} else {
-			val, existsS := mainState.ProposalSate.Sig[round][pHash][nodeId]
-			if existsS {
-				if val.Score >= sig.Score {
-					mainState.ProposalSate.SigLock.Unlock()
-					continue
-				} else {
-					logger.Test("Score [%v] to [%v] & pHash: %v, nodeId: %v", val.Score, sig.Score, pHash, nodeId)
-				}
+		if errors.Is(err, models.ErrConflictingAttestation) {
+			// 打分者对同一提案签名过矛盾的分数，两个签名构成证据
+			if old, ok := rs.Attestation(pHash, nodeId); ok && old.Conflicts(sig) {
+				submitEvidence(mainState, consensus.NewRatingEvidence(round, pHash, old, sig))
 			}
+			idx += guaranteeCount * (32 + 64)
+			continue
+		}
+		if err != nil {
+			logger.Debug("ProcessProposalSig %v rejected: %v", pHash, err)
+		}
+		if !added {
+			idx += guaranteeCount * (32 + 64)
+			continue
 		}
 
-		mainState.ProposalSate.Sig[round][pHash][nodeId] = sig
-		mainState.ProposalSate.SigLock.Unlock()
-
+		if len(b) < idx+guaranteeCount*(32+64) {
+			logger.Debug("ProcessProposalSig guarantee too short")
+			return p2p.ErrMalformed
+		}
 		for j := 0; j < guaranteeCount; j++ {
 			var guaranteeNodeId [32]byte
 			copy(guaranteeNodeId[:], b[idx:idx+32])
@@ -261,15 +286,39 @@ func (Node) ProcessProposalSig(b []byte, mainState *models.MainStore) {
 	}
 
 	// 通知处理
-	mainState.ProposalSate.UpdateLock.RLock()
-	ch, exists := mainState.ProposalSate.Update[round]
-	if exists {
-		select {
-		case ch <- pHash:
-			//logger.Debug("ProcessProposalSig channel ok")
-		default:
-			//logger.Debug("ProcessProposalSig channel send failed")
-		}
+	mainState.Tracer.Receive(round, pHash, trace.MessageSig, tc)
+	rs.Notify(pHash)
+
+	return misbehaviour
+}
+
+// ProcessingEvidence 处理邻居转发的双重签名证据，格式错误或签名无效时返回违规
+func (Node) ProcessingEvidence(b []byte, mainState *models.MainStore, ioc *models.IOChannel) error {
+	e, err := consensus.DecodeEvidence(b)
+	if err != nil {
+		return p2p.ErrMalformed
+	}
+
+	_, err = consensus.SubmitEvidence(mainState, e, ioc.NodeId)
+	switch {
+	case errors.Is(err, consensus.ErrEvidenceSignature):
+		metrics.SignatureFailure("evidence")
+		return p2p.ErrInvalidSignature
+	case errors.Is(err, consensus.ErrEvidenceMalformed), errors.Is(err, consensus.ErrEvidenceNoConflict):
+		return p2p.ErrMalformed
+	case errors.Is(err, consensus.ErrEvidenceRateLimited), errors.Is(err, consensus.ErrEvidenceRound), errors.Is(err, consensus.ErrEvidenceUnknown):
+		// 超出限速、过旧的轮次或未知的违规者不是发送方的过错，直接丢弃
+		logger.Debug("Drop evidence: %v", err)
+	case err != nil:
+		logger.Warning("Process evidence failed: %v", err)
+	}
+
+	return nil
+}
+
+// submitEvidence 提交本节点发现的证据
+func submitEvidence(mainState *models.MainStore, e consensus.Evidence) {
+	if _, err := consensus.SubmitEvidence(mainState, e, [32]byte{}); err != nil {
+		logger.With(logger.NodeId(e.Offender()), logger.Round(e.Round)).Warning("Submit evidence failed: %v", err)
 	}
-	mainState.ProposalSate.UpdateLock.RUnlock()
 }
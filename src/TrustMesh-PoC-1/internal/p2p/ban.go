@@ -0,0 +1,83 @@
+package p2p
+
+import (
+	"TrustMesh-PoC-1/internal/db"
+	"TrustMesh-PoC-1/internal/models"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// BanNode 封禁节点并写入封禁表，until 为零值时永久封禁
+func BanNode(mainState *models.MainStore, nodeId [32]byte, until time.Time, reason string) error {
+	mainState.Bans.Ban(nodeId, until, reason)
+	return db.SaveBan(mainState.DB, db.BanNode, nodeId[:], until, reason)
+}
+
+// UnbanNode 解除节点封禁并删除记录
+func UnbanNode(mainState *models.MainStore, nodeId [32]byte) error {
+	mainState.Bans.Unban(nodeId)
+	return db.DeleteBan(mainState.DB, db.BanNode, nodeId[:])
+}
+
+// BanIP 封禁 IP 并写入封禁表，until 为零值时永久封禁
+func BanIP(mainState *models.MainStore, ip netip.Addr, until time.Time, reason string) error {
+	ip = ip.Unmap()
+	mainState.Bans.BanIP(ip, until, reason)
+
+	target := ip.As16()
+	return db.SaveBan(mainState.DB, db.BanIP, target[:], until, reason)
+}
+
+// UnbanIP 解除 IP 封禁并删除记录
+func UnbanIP(mainState *models.MainStore, ip netip.Addr) error {
+	ip = ip.Unmap()
+	mainState.Bans.UnbanIP(ip)
+
+	target := ip.As16()
+	return db.DeleteBan(mainState.DB, db.BanIP, target[:])
+}
+
+// LoadBans 从封禁表读取仍在封禁期内的记录，启动时调用一次
+func LoadBans(mainState *models.MainStore) (int, error) {
+	bans, err := db.ActiveBans(mainState.DB)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load bans: %w", err)
+	}
+
+	for _, b := range bans {
+		var until time.Time
+		if b.Until != 0 {
+			until = time.UnixMilli(int64(b.Until))
+		}
+
+		switch b.Kind {
+		case db.BanNode:
+			if len(b.Target) != 32 {
+				continue
+			}
+			var nodeId [32]byte
+			copy(nodeId[:], b.Target)
+			mainState.Bans.Ban(nodeId, until, b.Reason)
+		case db.BanIP:
+			if len(b.Target) != 16 {
+				continue
+			}
+			mainState.Bans.BanIP(netip.AddrFrom16([16]byte(b.Target)), until, b.Reason)
+		}
+	}
+
+	return len(bans), nil
+}
+
+// RemoteIP 连接对端的 IP，非 IP 连接（例如 Unix 套接字）返回 false
+func RemoteIP(conn net.Conn) (netip.Addr, bool) {
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return netip.Addr{}, false
+	}
+
+	ip, ok := netip.AddrFromSlice(addr.IP)
+	return ip.Unmap(), ok
+}
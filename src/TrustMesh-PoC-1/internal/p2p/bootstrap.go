@@ -1,115 +1,434 @@
 package p2p
 
 import (
+	"TrustMesh-PoC-1/internal/clock"
 	"TrustMesh-PoC-1/internal/db"
+	"TrustMesh-PoC-1/internal/keys"
 	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/metrics"
 	"TrustMesh-PoC-1/internal/models"
-	"TrustMesh-PoC-1/internal/table"
+	"TrustMesh-PoC-1/internal/topology"
 	"bytes"
+	"context"
+	"crypto/ed25519"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
-	"math"
+	"math/rand"
 	"net"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/zeebo/blake3"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
+const (
+	// maxBootstrapRecords 单次回复最多携带的记录数
+	maxBootstrapRecords = 256
+	// maxBootstrapReplySize 引导节点回复的最大长度
+	maxBootstrapReplySize = 32 + 8 + 2 + maxBootstrapRecords*maxAddressRecordSize + 64
+	// bootstrapReplyMaxAge 回复时间戳允许的最大误差
+	bootstrapReplyMaxAge = 5 * time.Minute
+	// probeTimeout 回拨检查超时
+	probeTimeout = 3 * time.Second
+)
+
+// isTrustedBootstrap 判断回复签名者是否可信，调用方已确认连接是本节点拨号到配置的引导节点
+// 未配置可信公钥时只接受当前直连引导节点自身签名的回复
+func isTrustedBootstrap(signer [32]byte, remote [32]byte, trusted [][32]byte) bool {
+	if len(trusted) == 0 {
+		return signer == remote
+	}
+
+	return slices.Contains(trusted, signer)
+}
+
+// NodeEntry 汇报的节点信息
+type NodeEntry struct {
+	Record   AddressRecord
+	LastSeen time.Time
+}
+
 // NodeList 汇报的节点列表
 type NodeList struct {
 	Mu   sync.Mutex
-	Node map[[32]byte]string
+	Node map[[32]byte]NodeEntry
+	// 每次回复的邻居数量
+	Density int
+	// 节点未再次汇报时的过期时间
+	TTL time.Duration
+	// 拓扑生成器，为空时随机抽样
+	Topology topology.Generator
+	// 拓扑快照输出路径，为空时不输出
+	SnapshotPath string
+
+	// 当前拓扑，成员变化后重新生成
+	graph map[[32]byte][][32]byte
+	dirty bool
+}
+
+// Sample 随机抽取未过期的节点，排除 exclude
+func (n *NodeList) Sample(exclude [32]byte) []AddressRecord {
+	n.Mu.Lock()
+	defer n.Mu.Unlock()
+
+	live := n.live()
+	for i, k := range live {
+		if k == exclude {
+			live = append(live[:i], live[i+1:]...)
+			break
+		}
+	}
+
+	rand.Shuffle(len(live), func(i, j int) { live[i], live[j] = live[j], live[i] })
+	if len(live) > min(n.Density, maxBootstrapRecords) {
+		live = live[:min(n.Density, maxBootstrapRecords)]
+	}
+
+	out := make([]AddressRecord, 0, len(live))
+	for _, k := range live {
+		out = append(out, n.Node[k].Record)
+	}
+
+	return out
+}
+
+// Neighbours 返回节点在当前拓扑中的邻居，未配置拓扑时随机抽样
+func (n *NodeList) Neighbours(nodeId [32]byte) []AddressRecord {
+	if n.Topology == nil {
+		return n.Sample(nodeId)
+	}
+
+	n.Mu.Lock()
+	defer n.Mu.Unlock()
+
+	if _, ok := n.graph[nodeId]; n.dirty || !ok {
+		n.regenerate()
+	}
+
+	out := make([]AddressRecord, 0, len(n.graph[nodeId]))
+	for _, k := range n.graph[nodeId] {
+		if v, ok := n.Node[k]; ok && time.Since(v.LastSeen) <= n.TTL {
+			out = append(out, v.Record)
+		}
+		if len(out) == maxBootstrapRecords {
+			break
+		}
+	}
+
+	return out
+}
+
+// live 未过期节点，按 NodeId 排序，调用方持有锁
+func (n *NodeList) live() [][32]byte {
+	out := make([][32]byte, 0, len(n.Node))
+	for k, v := range n.Node {
+		if time.Since(v.LastSeen) <= n.TTL {
+			out = append(out, k)
+		}
+	}
+	slices.SortFunc(out, func(a, b [32]byte) int { return bytes.Compare(a[:], b[:]) })
+
+	return out
+}
+
+// regenerate 在存活节点上重新生成拓扑，调用方持有锁
+func (n *NodeList) regenerate() {
+	ids := n.live()
+	g := n.Topology.Generate(len(ids), rand.New(rand.NewSource(time.Now().UnixNano())))
+
+	n.graph = make(map[[32]byte][][32]byte, len(ids))
+	for i, id := range ids {
+		neighbours := g.Neighbours(i)
+		list := make([][32]byte, 0, len(neighbours))
+		for _, j := range neighbours {
+			list = append(list, ids[j])
+		}
+		n.graph[id] = list
+	}
+	n.dirty = false
+
+	stats := topology.Analyze(g)
+	logger.Info("Topology %s regenerated: %v", n.Topology.Name(), stats)
+
+	if n.SnapshotPath != "" {
+		go func(path string, name string) {
+			if err := topology.WriteSnapshot(path, name, ids, g, stats); err != nil {
+				logger.Error("Write topology snapshot failed: %v", err)
+			}
+		}(n.SnapshotPath, n.Topology.Name())
+	}
+}
+
+// Expire 删除过期节点，返回删除数量
+func (n *NodeList) Expire() int {
+	n.Mu.Lock()
+	defer n.Mu.Unlock()
+
+	count := 0
+	for k, v := range n.Node {
+		if time.Since(v.LastSeen) > n.TTL {
+			delete(n.Node, k)
+			count++
+			n.dirty = true
+		}
+	}
+
+	return count
 }
 
 // BootstrapConnection 引导节点用连接结构体
 type BootstrapConnection struct {
 	Conn            net.Conn
-	Done            chan struct{}
-	Once            sync.Once
+	Ctx             context.Context
+	Cancel          context.CancelFunc
 	SessionState    int32
 	Ready           chan struct{}
 	Node            *NodeList
+	Signer          keys.Signer
+	DB              *gorm.DB
 	LocalHandshake  HandshakeMetadata
 	RemoteHandshake HandshakeMetadata
 }
 
-func processingBootstrapReport(message []byte, node *NodeList, nodeId [32]byte, db *gorm.DB) {
-	peer := table.Peer{
-		NodeID:     nodeId[:],
-		Address:    string(message),
-		Reputation: 0,
-		LastSeen:   uint64(time.Now().UnixMilli()),
-		Status:     "FROM Report",
+// BuildBootstrapReport 构建向引导节点的汇报消息
+func BuildBootstrapReport(r AddressRecord) []byte {
+	payload := appendAddressRecord(make([]byte, 0, maxAddressRecordSize), r)
+
+	message := make([]byte, 0, 4+4+len(payload))
+	// 创建 [4]byte 格式的 header
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], MsgBootstrapReport)
+	message = append(message, header[:]...)
+	// 创建 [4]byte 格式的 length
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(payload)))
+	message = append(message, length[:]...)
+	message = append(message, payload...)
+
+	return message
+}
+
+// bootstrapReplyHash 计算引导节点回复的签名数据哈希
+// 签名覆盖请求者 NodeId，防止回复被转发给其他节点重放
+func bootstrapReplyHash(signer [32]byte, requester [32]byte, timestamp []byte, records []byte) [32]byte {
+	// 创建 [4]byte 格式的 Tag
+	var TMBSV1DomainTag [4]byte
+	binary.BigEndian.PutUint32(TMBSV1DomainTag[:], TMBSV1Domain)
+
+	data := make([]byte, 0, 4+32+32+8+len(records))
+	data = append(data, TMBSV1DomainTag[:]...)
+	data = append(data, signer[:]...)
+	data = append(data, requester[:]...)
+	data = append(data, timestamp...)
+	data = append(data, records...)
+
+	return blake3.Sum256(data)
+}
+
+// buildBootstrapReply 构建引导节点回复
+// 格式：[32]引导节点公钥 + [8]时间戳 + [2]数量 + 地址记录* + [64]签名
+func buildBootstrapReply(s keys.Signer, requester [32]byte, records []AddressRecord) ([]byte, error) {
+	var signer [32]byte
+	copy(signer[:], s.PublicKey())
+
+	// 时间戳
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], uint64(time.Now().UnixMilli()))
+
+	// 记录集
+	recordSet := make([]byte, 0, 2+len(records)*maxAddressRecordSize)
+	var count [2]byte
+	binary.BigEndian.PutUint16(count[:], uint16(len(records)))
+	recordSet = append(recordSet, count[:]...)
+	for _, r := range records {
+		recordSet = appendAddressRecord(recordSet, r)
 	}
 
-	db.Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "node_id"}},
-		UpdateAll: true,
-	}).Create(&peer)
+	// 签名
+	h := bootstrapReplyHash(signer, requester, timestamp[:], recordSet)
+	signature, err := s.Sign(h[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign bootstrap reply: %w", err)
+	}
 
-	node.Mu.Lock()
-	node.Node[nodeId] = string(message)
-	node.Mu.Unlock()
+	payload := make([]byte, 0, 32+8+len(recordSet)+64)
+	payload = append(payload, signer[:]...)
+	payload = append(payload, timestamp[:]...)
+	payload = append(payload, recordSet...)
+	payload = append(payload, signature...)
+
+	message := make([]byte, 0, 4+4+len(payload))
+	// 创建 [4]byte 格式的 header
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], MsgBootstrapReply)
+	message = append(message, header[:]...)
+	// 创建 [4]byte 格式的 length
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(payload)))
+	message = append(message, length[:]...)
+	message = append(message, payload...)
+
+	return message, nil
 }
 
-func processingBootstrapReply(payload []byte, db *gorm.DB) {
-	for i := 0; i < len(payload); {
-		// 检查是否够解析 32B nodeId
-		if i+32 > len(payload) {
-			return
-		}
+// processingBootstrapReport 校验汇报节点，回拨检查可达后记录，返回地址观测消息与回复消息
+func processingBootstrapReport(s keys.Signer, message []byte, node *NodeList, remotePK [32]byte, observed string, database *gorm.DB) ([]byte, error) {
+	record, n, err := parseAddressRecord(message)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(message) {
+		return nil, errors.New("trailing data after address record")
+	}
 
-		// 取 nodeId（值拷贝）
-		var nodeId [32]byte
-		copy(nodeId[:], payload[i:i+32])
-		i += 32
+	// 只能汇报自己的地址
+	if record.PK != remotePK {
+		return nil, errors.New("address record is not signed by the reporter")
+	}
+	if !record.Verify() {
+		return nil, errors.New("address record signature verification failed")
+	}
 
-		// 检查分隔符 '+'
-		if i >= len(payload) || payload[i] != '+' {
-			return
+	nodeId := record.NodeId()
+
+	// 回拨自报地址，不可达的地址不记录也不转发
+	status := TrueOrYes
+	if realId, err := Probe(s, record.Address, probeTimeout); err != nil || realId != nodeId {
+		logger.Debug("Reported address %v is not reachable: %v", record.Address, err)
+		status = FalseOrNo
+	}
+
+	if status == TrueOrYes {
+		err = db.SavePeer(database, nodeId, record.Address, "FROM Report")
+		if err != nil {
+			logger.Error("Failed to save peer: %v", err)
+		}
+
+		node.Mu.Lock()
+		if old, ok := node.Node[nodeId]; !ok || old.Record.Address != record.Address {
+			node.dirty = true
 		}
-		i++ // 跳过 '+'
+		node.Node[nodeId] = NodeEntry{Record: record, LastSeen: time.Now()}
+		node.Mu.Unlock()
+	}
+
+	var neighbours []AddressRecord
+	if status == TrueOrYes {
+		neighbours = node.Neighbours(nodeId)
+	} else {
+		neighbours = node.Sample(nodeId)
+	}
+
+	reply, err := buildBootstrapReply(s, nodeId, neighbours)
+	if err != nil {
+		return nil, err
+	}
+
+	out := buildObservedAddress(observed, record.Address, status)
+	out = append(out, reply...)
+
+	return out, nil
+}
+
+// processingBootstrapReply 校验引导节点签名与每条地址记录的签名后写入节点表
+func processingBootstrapReply(s keys.Signer, payload []byte, remotePK [32]byte, trusted [][32]byte, database *gorm.DB) {
+	if len(payload) < 32+8+2+64 {
+		logger.Debug("Bootstrap reply too short")
+		return
+	}
+
+	// 引导节点签名
+	var signer [32]byte
+	copy(signer[:], payload[0:32])
+	timestamp := payload[32:40]
+	recordSet := payload[40 : len(payload)-64]
+	signature := payload[len(payload)-64:]
+
+	if !isTrustedBootstrap(signer, remotePK, trusted) {
+		logger.Warning("Bootstrap reply signed by untrusted key: %x", signer)
+		return
+	}
 
-		// 查找记录结束符 ';'
-		semi := bytes.IndexByte(payload[i:], ';')
-		if semi == -1 {
+	myNodeId := blake3.Sum256(s.PublicKey())
+
+	h := bootstrapReplyHash(signer, myNodeId, timestamp, recordSet)
+	if !ed25519.Verify(signer[:], h[:], signature) {
+		metrics.SignatureFailure("bootstrap_reply")
+		logger.Warning("Bootstrap reply signature verification failed")
+		return
+	}
+
+	// 时间戳误差
+	sent := time.UnixMilli(int64(binary.BigEndian.Uint64(timestamp)))
+	if diff := time.Since(sent); diff > bootstrapReplyMaxAge || diff < -bootstrapReplyMaxAge {
+		logger.Warning("Bootstrap reply is expired: %v", sent)
+		return
+	}
+
+	// 地址记录
+	count := int(binary.BigEndian.Uint16(recordSet[0:2]))
+	if count > maxBootstrapRecords {
+		logger.Debug("Bootstrap reply has too many records: %v", count)
+		return
+	}
+
+	records := make([]AddressRecord, 0, count)
+	idx := 2
+	for i := 0; i < count; i++ {
+		record, n, err := parseAddressRecord(recordSet[idx:])
+		if err != nil {
+			logger.Debug("Bootstrap reply parse failed: %v", err)
 			return
 		}
+		idx += n
 
-		// 拷贝 addr（深拷贝，防止 aliasing）
-		addr := make([]byte, 0, semi)
-		addr = append(addr, payload[i:i+semi]...)
-		i += semi + 1 // 跳过 addr 和 ';'
-
-		peer := table.Peer{
-			NodeID:     nodeId[:],
-			Address:    string(addr),
-			Reputation: 0,
-			LastSeen:   uint64(time.Now().UnixMilli()),
-			Status:     "FROM Bootstrap",
+		if !record.Verify() {
+			logger.Debug("Address record of %x signature verification failed", record.PK)
+			continue
+		}
+		if record.NodeId() == myNodeId {
+			continue
 		}
+		records = append(records, record)
+	}
 
-		db.Clauses(clause.OnConflict{
-			Columns:   []clause.Column{{Name: "node_id"}},
-			UpdateAll: true,
-		}).Create(&peer)
+	// 回拨检查后写入
+	var wg sync.WaitGroup
+	for _, record := range records {
+		wg.Add(1)
+		go func(record AddressRecord) {
+			defer wg.Done()
+
+			nodeId := record.NodeId()
+			if realId, err := Probe(s, record.Address, probeTimeout); err != nil || realId != nodeId {
+				logger.Debug("Address %v of %v is not reachable: %v", record.Address, nodeId, err)
+				return
+			}
 
-		logger.Info("Bootstrap reply received, you can close this node")
+			err := db.SavePeer(database, nodeId, record.Address, "FROM Bootstrap")
+			if err != nil {
+				logger.Error("Failed to save peer: %v", err)
+			}
+		}(record)
 	}
+	wg.Wait()
+
+	logger.Info("Bootstrap reply received")
 }
 
 // bootstrapReadLoop 读通道协程
 func (c *BootstrapConnection) bootstrapReadLoop() {
-	defer c.Once.Do(func() { close(c.Done) })
+	defer c.Cancel()
 
 	// 读循环
 	for {
 		select {
-		case <-c.Done:
+		case <-c.Ctx.Done():
 			return
 		default:
 			// 读取包头
@@ -140,7 +459,7 @@ func (c *BootstrapConnection) bootstrapReadLoop() {
 					}
 
 					// 处理消息
-					writeBuf, remote, local, isPass := processingHandshakeHello(bodyBuf)
+					writeBuf, remote, local, isPass := processingHandshakeHello(c.Signer, bodyBuf, time.Now())
 					c.RemoteHandshake = remote
 					c.LocalHandshake = local
 
@@ -182,7 +501,8 @@ func (c *BootstrapConnection) bootstrapReadLoop() {
 						// 通知握手完成
 						close(c.Ready)
 
-						logger.Debug("Handshake done: %v", nodeId)
+						metrics.Handshake(true)
+						logger.With(logger.NodeId(nodeId), logger.Peer(c.Conn.RemoteAddr().String())).Debug("Handshake done")
 
 						continue
 					} else {
@@ -204,11 +524,23 @@ func (c *BootstrapConnection) bootstrapReadLoop() {
 					return
 				}
 			case MsgBootstrapReport:
-				bodyBuf, err := lenReadUnit32(c.Conn, math.MaxInt32, 10*time.Second)
+				bodyBuf, err := lenReadUnit32(c.Conn, maxAddressRecordSize, clock.System, 10*time.Second)
 				if err != nil {
 					return
 				}
-				go processingBootstrapReport(bodyBuf, c.Node, blake3.Sum256(c.RemoteHandshake.PK[:]), db.GetDB())
+				reply, err := processingBootstrapReport(c.Signer, bodyBuf, c.Node, c.RemoteHandshake.PK, c.Conn.RemoteAddr().String(), c.DB)
+				if err != nil {
+					logger.Debug("Bootstrap report rejected: %v", err)
+					return
+				}
+
+				// 立即回复
+				if err := c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+					return
+				}
+				if _, err := c.Conn.Write(reply); err != nil {
+					return
+				}
 				return
 			default:
 				return
@@ -218,9 +550,7 @@ func (c *BootstrapConnection) bootstrapReadLoop() {
 }
 
 // BootstrapHandleConnection 连接管理函数
-func BootstrapHandleConnection(conn net.Conn, resp *NodeList, mainState *models.MainStore) {
-	ct := mainState.ConnectionTable
-
+func BootstrapHandleConnection(ctx context.Context, conn net.Conn, resp *NodeList, mainState *models.MainStore) {
 	// 退出时关闭连接
 	defer func(conn net.Conn) {
 		err := conn.Close()
@@ -231,23 +561,29 @@ func BootstrapHandleConnection(conn net.Conn, resp *NodeList, mainState *models.
 	}(conn)
 
 	// 连接信息
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	c := BootstrapConnection{
 		Conn:         conn,
-		Done:         make(chan struct{}),
+		Ctx:          ctx,
+		Cancel:       cancel,
 		SessionState: int32(StateWaitingInitial),
 		Ready:        make(chan struct{}),
 		Node:         resp,
+		Signer:       mainState.Signer,
+		DB:           mainState.DB,
 	}
 
 	go c.bootstrapReadLoop()
 
 	logger.Debug("Bootstrap Connection opened: %v", conn.RemoteAddr())
 
-	<-c.Done
+	<-c.Ctx.Done()
 
-	ct.Lock.Lock()
-	delete(ct.Connection, blake3.Sum256(c.RemoteHandshake.PK[:]))
-	ct.Lock.Unlock()
+	if atomic.LoadInt32(&c.SessionState) != int32(StateCompleted) {
+		metrics.Handshake(false)
+	}
 
 	return
 }
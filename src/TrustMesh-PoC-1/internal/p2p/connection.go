@@ -2,16 +2,18 @@ package p2p
 
 import (
 	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/metrics"
 	"TrustMesh-PoC-1/internal/models"
+	"TrustMesh-PoC-1/internal/ratelimit"
+	"context"
 	"net"
-
-	"github.com/zeebo/blake3"
+	"sync/atomic"
+	"time"
 )
 
 // HandleConnection 连接处理函数
-func HandleConnection(conn net.Conn, mainState *models.MainStore, nodeId chan [32]byte, isInitiator bool) {
-	ct := mainState.ConnectionTable
-
+// ctx 取消时连接随之关闭
+func HandleConnection(ctx context.Context, conn net.Conn, mainState *models.MainStore, nodeId chan [32]byte, isInitiator bool) {
 	// 退出时关闭连接
 	defer func(conn net.Conn) {
 		err := conn.Close()
@@ -21,11 +23,15 @@ func HandleConnection(conn net.Conn, mainState *models.MainStore, nodeId chan [3
 		logger.Debug("Close Connection: %v", conn.RemoteAddr())
 	}(conn)
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	// 连接信息
 	c := Connection{
 		Conn:         conn,
 		WriteQueue:   make(chan []byte, 256),
-		Done:         make(chan struct{}),
+		Ctx:          ctx,
+		Cancel:       cancel,
 		Channels:     make(map[[32]byte]chan []byte),
 		SessionState: int32(StateWaitingInitial),
 		IsInitiator:  isInitiator,
@@ -38,26 +44,51 @@ func HandleConnection(conn net.Conn, mainState *models.MainStore, nodeId chan [3
 		WriteQueue:   c.WriteQueue,
 		Channels:     c.Channels,
 		ChannelsLock: &c.ChannelsLock,
-		Done:         c.Done,
-		OnceDone:     &c.OnceDone,
+		Ctx:          c.Ctx,
+		Cancel:       c.Cancel,
 		Ready:        c.Ready,
+		Addr:         conn.RemoteAddr().String(),
+		IsInitiator:  isInitiator,
 	}
 
 	c.IOC = &ioc
 	c.MainState = mainState
 	c.h = handler
 
+	// 限速
+	limits := mainState.Config.Limits
+	c.msgBucket = ratelimit.NewBucket(mainState.Clock, float64(limits.MsgRate), float64(limits.MsgBurst))
+	c.byteBucket = ratelimit.NewBucket(mainState.Clock, float64(limits.ByteRate), float64(limits.ByteBurst))
+
 	go c.readLoop()
 	go c.writeLoop()
 	go c.KeepHeartbeat()
 
 	logger.Debug("Connection opened: %v", conn.RemoteAddr())
 
-	<-c.Done
+	<-c.Ctx.Done()
 
-	ct.Lock.Lock()
-	delete(ct.Connection, blake3.Sum256(c.RemoteHandshake.PK[:]))
-	ct.Lock.Unlock()
+	if atomic.LoadInt32(&c.SessionState) != int32(StateCompleted) {
+		metrics.Handshake(false)
+	}
+
+	// 仅删除本连接自己的表项，避免误删同一节点的新连接
+	c.unregisterConnection()
 
 	return
 }
+
+// Enqueue 在 timeout 内将消息写入连接写队列，ctx 取消或连接关闭时放弃
+func Enqueue(ctx context.Context, ioc *models.IOChannel, message []byte, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	select {
+	case ioc.WriteQueue <- message:
+		return true
+	case <-ioc.Ctx.Done():
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,99 @@
+package p2p
+
+import (
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/models"
+	"encoding/binary"
+)
+
+// maxFindNodeReplySize 查找节点回复的最大长度
+const maxFindNodeReplySize = 32 + 2 + models.BucketSize*(32+2+maxRecordAddrLen)
+
+// BuildFindNode 构建查找节点请求
+func BuildFindNode(target [32]byte, transactionId [32]byte) []byte {
+	message := make([]byte, 0, 4+32+32)
+
+	// header
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], MsgFindNode)
+	message = append(message, header[:]...)
+	// 查找目标
+	message = append(message, target[:]...)
+	// 事务 ID
+	message = append(message, transactionId[:]...)
+
+	return message
+}
+
+// ParseFindNodeReply 解析查找节点回复的记录部分
+func ParseFindNodeReply(b []byte) []PeerRecord {
+	return parsePeerRecords(b, models.BucketSize)
+}
+
+// processingFindNode 处理查找节点请求，回复路由表中距离目标最近的 k 个联系人
+func (c *Connection) processingFindNode(body [64]byte) {
+	rt := c.MainState.RoutingTable
+	if rt == nil {
+		return
+	}
+
+	var target [32]byte
+	copy(target[:], body[0:32])
+	var transactionId [32]byte
+	copy(transactionId[:], body[32:64])
+
+	requester := c.IOC.NodeId
+	records := make([]PeerRecord, 0, models.BucketSize)
+	for _, v := range rt.Closest(target, models.BucketSize+1) {
+		if v.NodeId == requester || len(v.Address) > maxRecordAddrLen {
+			continue
+		}
+		records = append(records, PeerRecord{NodeId: v.NodeId, Address: v.Address})
+		if len(records) == models.BucketSize {
+			break
+		}
+	}
+
+	payload := make([]byte, 0, 32+2+len(records)*(32+2+32))
+	payload = append(payload, transactionId[:]...)
+	payload = appendPeerRecords(payload, records)
+
+	message := make([]byte, 0, 4+4+len(payload))
+	// header
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], MsgFindNodeReply)
+	message = append(message, header[:]...)
+	// 长度
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(payload)))
+	message = append(message, length[:]...)
+	// 内容
+	message = append(message, payload...)
+
+	select {
+	case c.WriteQueue <- message:
+	case <-c.Ctx.Done():
+	}
+}
+
+// processingFindNodeReply 将查找节点回复投递到对应事务通道
+func processingFindNodeReply(b []byte, ioc *models.IOChannel) {
+	if len(b) < 32+2 {
+		return
+	}
+
+	var transactionId [32]byte
+	copy(transactionId[:], b[0:32])
+
+	ioc.ChannelsLock.RLock()
+	ch, exists := ioc.Channels[transactionId]
+	if exists {
+		select {
+		case ch <- b[32:]:
+		default:
+		}
+	} else {
+		logger.Test("Failed to find channel")
+	}
+	ioc.ChannelsLock.RUnlock()
+}
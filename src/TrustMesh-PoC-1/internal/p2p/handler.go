@@ -17,9 +17,11 @@ type Handler interface {
 }
 
 // Consensus 共识处理接口
+// 返回 *Misbehaviour（或包装它的错误）时计入发送方的违规分数
 type Consensus interface {
 	ProcessingInquiry(b [72]byte, mainState *models.MainStore, ioc *models.IOChannel)
 	ProcessingInquiryReply(b [36]byte, ioc *models.IOChannel)
-	ProcessingProposalBody(b []byte, mainState *models.MainStore)
-	ProcessProposalSig(b []byte, mainState *models.MainStore)
+	ProcessingProposalBody(b []byte, mainState *models.MainStore) error
+	ProcessProposalSig(b []byte, mainState *models.MainStore) error
+	ProcessingEvidence(b []byte, mainState *models.MainStore, ioc *models.IOChannel) error
 }
@@ -3,6 +3,7 @@ package p2p
 import (
 	"TrustMesh-PoC-1/internal/keys"
 	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/metrics"
 	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/binary"
@@ -13,9 +14,9 @@ import (
 
 const maxDiff uint64 = 3600
 
-// timeDiff 检验于当前时间的时间差
-func timeDiff(remote uint64) bool {
-	local := uint64(time.Now().UnixMilli())
+// timeDiff 检验于当前时间 now 的时间差
+func timeDiff(remote uint64, now time.Time) bool {
+	local := uint64(now.UnixMilli())
 	var diff uint64
 	if remote > local {
 		diff = remote - local
@@ -30,14 +31,10 @@ func timeDiff(remote uint64) bool {
 	}
 }
 
-// newHandshakeHello 生成Hello消息
-func newHandshakeHello() ([76]byte, HandshakeMetadata, bool) {
-	// 获取密钥
-	_, publicKey, err := keys.LoadOrCreateKey()
-	if err != nil {
-		logger.Debug("Failed to load or create key: %v", err)
-		return [76]byte{}, HandshakeMetadata{}, false
-	}
+// newHandshakeHello 生成Hello消息，now 为当前时间
+func newHandshakeHello(signer keys.Signer, now time.Time) ([76]byte, HandshakeMetadata, bool) {
+	// 获取公钥
+	publicKey := signer.PublicKey()
 
 	// 定义 Hello 结构体
 	var payloadHello HandshakeMetadata
@@ -50,7 +47,7 @@ func newHandshakeHello() ([76]byte, HandshakeMetadata, bool) {
 		return [76]byte{}, HandshakeMetadata{}, false
 	}
 	// 写入日期
-	payloadHello.Time = uint64(time.Now().UnixMilli())
+	payloadHello.Time = uint64(now.UnixMilli())
 
 	// 创建 [8]byte 格式的日期
 	var HelloTime [8]byte
@@ -68,15 +65,11 @@ func newHandshakeHello() ([76]byte, HandshakeMetadata, bool) {
 	return message, payloadHello, true
 }
 
-// processingHandshakeHello 处理Hello消息
+// processingHandshakeHello 处理Hello消息，now 为当前时间
 // 返回值：发送信息，对方握手信息，本地握手信息，是否处理成功
-func processingHandshakeHello(body [72]byte) ([140]byte, HandshakeMetadata, HandshakeMetadata, bool) {
-	// 获取密钥
-	privateKey, publicKey, err := keys.LoadOrCreateKey()
-	if err != nil {
-		logger.Debug("Failed to load or create key: %v", err)
-		return [140]byte{}, HandshakeMetadata{}, HandshakeMetadata{}, false
-	}
+func processingHandshakeHello(signer keys.Signer, body [72]byte, now time.Time) ([140]byte, HandshakeMetadata, HandshakeMetadata, bool) {
+	// 获取公钥
+	publicKey := signer.PublicKey()
 
 	// 定义 Hello 结构体
 	var payloadHello HandshakeMetadata
@@ -88,7 +81,7 @@ func processingHandshakeHello(body [72]byte) ([140]byte, HandshakeMetadata, Hand
 	// 拆分日期
 	payloadHello.Time = binary.BigEndian.Uint64(body[64:72])
 	// 判断日期误差
-	if !timeDiff(payloadHello.Time) {
+	if !timeDiff(payloadHello.Time, now) {
 		return [140]byte{}, HandshakeMetadata{}, HandshakeMetadata{}, false
 	}
 
@@ -103,7 +96,7 @@ func processingHandshakeHello(body [72]byte) ([140]byte, HandshakeMetadata, Hand
 		return [140]byte{}, HandshakeMetadata{}, HandshakeMetadata{}, false
 	}
 	// 写入日期
-	payloadResponse.Time = uint64(time.Now().UnixMilli())
+	payloadResponse.Time = uint64(now.UnixMilli())
 
 	// 创建 [8]byte 格式的日期
 	var responseTime [8]byte
@@ -125,7 +118,11 @@ func processingHandshakeHello(body [72]byte) ([140]byte, HandshakeMetadata, Hand
 
 	// 组合发送消息
 	challengeHash := blake3.Sum256(challenge[:])
-	challengeSign := ed25519.Sign(privateKey, challengeHash[:])
+	challengeSign, err := signer.Sign(challengeHash[:])
+	if err != nil {
+		logger.Error("Failed to sign challenge: %v", err)
+		return [140]byte{}, HandshakeMetadata{}, HandshakeMetadata{}, false
+	}
 
 	var message [4 + 64 + 32 + 32 + 8]byte
 	copy(message[0:4], header[:])
@@ -134,20 +131,11 @@ func processingHandshakeHello(body [72]byte) ([140]byte, HandshakeMetadata, Hand
 	copy(message[100:132], payloadResponse.Nonce[:])
 	copy(message[132:140], responseTime[:])
 
-	keys.Zeroize(privateKey)
-
 	return message, payloadHello, payloadResponse, true
 }
 
-// processingHandshakeResponse 处理Response消息
-func processingHandshakeResponse(body [136]byte, payloadHello HandshakeMetadata) ([68]byte, HandshakeMetadata, bool) {
-	// 获取密钥
-	privateKey, _, err := keys.LoadOrCreateKey()
-	if err != nil {
-		logger.Debug("Failed to load or create key: %v", err)
-		return [68]byte{}, HandshakeMetadata{}, false
-	}
-
+// processingHandshakeResponse 处理Response消息，now 为当前时间
+func processingHandshakeResponse(signer keys.Signer, body [136]byte, payloadHello HandshakeMetadata, now time.Time) ([68]byte, HandshakeMetadata, bool) {
 	// 定义 Response 结构体
 	var payloadResponse HandshakeMetadata
 	var challengeSignResponse [64]byte
@@ -161,7 +149,7 @@ func processingHandshakeResponse(body [136]byte, payloadHello HandshakeMetadata)
 	// 拆分日期
 	payloadResponse.Time = binary.BigEndian.Uint64(body[128:136])
 	// 判断日期误差
-	if !timeDiff(payloadResponse.Time) {
+	if !timeDiff(payloadResponse.Time, now) {
 		logger.Debug("Received time is too far away")
 		return [68]byte{}, HandshakeMetadata{}, false
 	}
@@ -191,16 +179,19 @@ func processingHandshakeResponse(body [136]byte, payloadHello HandshakeMetadata)
 	challengeHash := blake3.Sum256(challenge[:])
 
 	if !ed25519.Verify(payloadResponse.PK[:], challengeHash[:], challengeSignResponse[:]) {
+		metrics.SignatureFailure("handshake")
 		return [68]byte{}, HandshakeMetadata{}, false
 	}
 
-	challengeSign := ed25519.Sign(privateKey, challengeHash[:])
+	challengeSign, err := signer.Sign(challengeHash[:])
+	if err != nil {
+		logger.Error("Failed to sign challenge: %v", err)
+		return [68]byte{}, HandshakeMetadata{}, false
+	}
 	var message [4 + 64]byte
 	copy(message[0:4], header[:])
 	copy(message[4:68], challengeSign)
 
-	keys.Zeroize(privateKey)
-
 	return message, payloadResponse, true
 }
 
@@ -229,5 +220,9 @@ func processingHandshakeConfirm(body [64]byte, payloadHello HandshakeMetadata, p
 
 	challengeHash := blake3.Sum256(challenge[:])
 
-	return ed25519.Verify(payloadHello.PK[:], challengeHash[:], body[:])
+	if !ed25519.Verify(payloadHello.PK[:], challengeHash[:], body[:]) {
+		metrics.SignatureFailure("handshake")
+		return false
+	}
+	return true
 }
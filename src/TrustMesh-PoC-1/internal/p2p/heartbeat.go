@@ -1,20 +1,12 @@
 package p2p
 
 import (
-	"TrustMesh-PoC-1/internal/keys"
-	"TrustMesh-PoC-1/internal/logger"
-	"TrustMesh-PoC-1/internal/tools"
 	"encoding/binary"
 	"time"
 )
 
 // sendHeartbeat 发送心跳包
 func (c *Connection) sendHeartbeat() bool {
-	privateKey, _, err := keys.LoadOrCreateKey()
-	if err != nil {
-		logger.Error("Failed to load or create key: %v", err)
-		return false
-	}
 	var message []byte
 
 	// 创建 [4]byte 格式的 header
@@ -30,10 +22,8 @@ func (c *Connection) sendHeartbeat() bool {
 	// 发送到写入队列
 	select {
 	case c.WriteQueue <- message:
-		keys.Zeroize(privateKey)
 		return true
 	default:
-		keys.Zeroize(privateKey)
 		return false
 	}
 }
@@ -42,18 +32,15 @@ func (c *Connection) sendHeartbeat() bool {
 func (c *Connection) KeepHeartbeat() {
 	for {
 		select {
-		case <-c.Done:
+		case <-c.Ctx.Done():
 			return
-		case <-time.After(5 * time.Second):
-			ok := make(chan struct{})
-			select {
-			case <-c.Ready:
-				close(ok)
-				c.sendHeartbeat()
-			case <-tools.WaitTimeout(ok, 5*time.Second):
-				c.OnceDone.Do(func() { close(c.Done) })
+		case <-c.MainState.Clock.After(5 * time.Second):
+			// 握手迟迟未完成则关闭连接
+			if !c.waitReady(5 * time.Second) {
+				c.Cancel()
 				return
 			}
+			c.sendHeartbeat()
 		}
 	}
 }
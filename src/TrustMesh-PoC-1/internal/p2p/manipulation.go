@@ -3,11 +3,125 @@ package p2p
 import (
 	"TrustMesh-PoC-1/internal/logger"
 	"TrustMesh-PoC-1/internal/models"
+	"bytes"
+
+	"github.com/zeebo/blake3"
 )
 
-// ConnectionAlreadyExists 冗余连接处理函数
-func ConnectionAlreadyExists(nodeId [32]byte, c *models.IOChannel) {
-	logger.Debug("node %v already connected", nodeId)
-	//c.OnceDone.Do(func() { close(c.Done) })
-	return
+// initiatorInfo 返回本连接发起方的 NodeId 与 Hello 随机数
+func (c *Connection) initiatorInfo() ([32]byte, [32]byte) {
+	// 发起方发送 Hello，因此 Hello 信息即发起方信息
+	hello := c.RemoteHandshake
+	if c.IsInitiator {
+		hello = c.LocalHandshake
+	}
+
+	return blake3.Sum256(hello.PK[:]), hello.Nonce
+}
+
+// preferConnection 判断连接 a 是否应当优先于连接 b 保留
+// 规则：发起方 NodeId 较小者胜出，相同时 Hello 随机数较小者胜出
+// 双方对同一对连接得出的结论一致
+func preferConnection(a *models.IOChannel, b *models.IOChannel) bool {
+	if cmp := bytes.Compare(a.Initiator[:], b.Initiator[:]); cmp != 0 {
+		return cmp < 0
+	}
+
+	return bytes.Compare(a.Nonce[:], b.Nonce[:]) < 0
+}
+
+// migrateConnection 将落败连接中尚未发送的消息与等待中的事务通道迁移到保留连接
+func migrateConnection(from *models.IOChannel, to *models.IOChannel) {
+	// 迁移事务通道
+	from.ChannelsLock.Lock()
+	moved := make(map[[32]byte]chan []byte, len(from.Channels))
+	for k, v := range from.Channels {
+		moved[k] = v
+	}
+	from.ChannelsLock.Unlock()
+
+	to.ChannelsLock.Lock()
+	for k, v := range moved {
+		if _, exists := to.Channels[k]; !exists {
+			to.Channels[k] = v
+		}
+	}
+	to.ChannelsLock.Unlock()
+
+	// 迁移写队列
+	for {
+		select {
+		case msg := <-from.WriteQueue:
+			select {
+			case to.WriteQueue <- msg:
+			default:
+				logger.Debug("Migrate message dropped, write queue is full")
+			}
+		default:
+			return
+		}
+	}
+}
+
+// registerConnection 将握手完成的连接写入连接表，并处理同一节点的重复连接
+// 返回 false 表示对方被封禁或当前连接在竞争中落败，调用方应当关闭它
+func (c *Connection) registerConnection(nodeId [32]byte) bool {
+	if c.MainState.Bans.IsBanned(nodeId) {
+		logger.Debug("node %v is banned, drop connection", nodeId)
+		return false
+	}
+
+	ct := c.MainState.ConnectionTable
+	initiator, nonce := c.initiatorInfo()
+
+	ct.Lock.Lock()
+	c.IOC.NodeId = nodeId
+	c.IOC.Initiator = initiator
+	c.IOC.Nonce = nonce
+
+	old, isExist := ct.Connection[nodeId]
+	if isExist {
+		select {
+		case <-old.Ctx.Done():
+			// 旧连接已关闭，只是尚未从表中删除
+			isExist = false
+		default:
+		}
+	}
+
+	// 没有冲突
+	if !isExist || old == c.IOC {
+		ct.Connection[nodeId] = c.IOC
+		ct.Lock.Unlock()
+		return true
+	}
+
+	// 旧连接胜出
+	if preferConnection(old, c.IOC) {
+		ct.Lock.Unlock()
+		logger.Debug("node %v already connected, drop new connection", nodeId)
+		migrateConnection(c.IOC, old)
+		return false
+	}
+
+	// 新连接胜出
+	ct.Connection[nodeId] = c.IOC
+	ct.Lock.Unlock()
+
+	logger.Debug("node %v already connected, replace old connection", nodeId)
+	old.Cancel()
+	migrateConnection(old, c.IOC)
+
+	return true
+}
+
+// unregisterConnection 从连接表中删除当前连接，不会删除同一节点的其他连接
+func (c *Connection) unregisterConnection() {
+	ct := c.MainState.ConnectionTable
+
+	ct.Lock.Lock()
+	if v, ok := ct.Connection[c.IOC.NodeId]; ok && v == c.IOC {
+		delete(ct.Connection, c.IOC.NodeId)
+	}
+	ct.Lock.Unlock()
 }
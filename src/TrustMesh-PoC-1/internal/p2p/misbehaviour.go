@@ -0,0 +1,102 @@
+package p2p
+
+import (
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/metrics"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+// Misbehaviour 对端的违规行为，分数累计到连接上，达到 limits.ban_score 时封禁对端
+type Misbehaviour struct {
+	Reason string
+	Score  int32
+}
+
+func (m *Misbehaviour) Error() string {
+	return m.Reason
+}
+
+// 违规行为，处理函数返回（或包装）这些错误时计入对端的违规分数
+var (
+	ErrOversize         = &Misbehaviour{Reason: "oversize", Score: 100}
+	ErrUnknownProtocol  = &Misbehaviour{Reason: "unknown_protocol", Score: 50}
+	ErrMalformed        = &Misbehaviour{Reason: "malformed", Score: 25}
+	ErrInvalidSignature = &Misbehaviour{Reason: "invalid_signature", Score: 25}
+)
+
+// errMessageTooLarge 消息长度超过该类型的上限
+var errMessageTooLarge = errors.New("length size too big")
+
+// report 处理函数的结果，违规时计分，其余错误只记录日志
+func (c *Connection) report(err error) {
+	if err == nil {
+		return
+	}
+
+	var m *Misbehaviour
+	if errors.As(err, &m) {
+		c.misbehave(m)
+		return
+	}
+	logger.Debug("Handle message failed: %v", err)
+}
+
+// admit 按令牌桶限速，超出时暂停读取直到令牌补足，不计入违规分数
+// 暂停期间对端的写入被 TCP 反压，连接关闭时返回 false
+func (c *Connection) admit(size int) bool {
+	wait := max(c.msgBucket.Reserve(1), c.byteBucket.Reserve(float64(size)))
+	if wait <= 0 {
+		return true
+	}
+
+	metrics.RateLimited()
+	select {
+	case <-c.MainState.Clock.After(wait):
+		return true
+	case <-c.Ctx.Done():
+		return false
+	}
+}
+
+// misbehave 累计违规分数，达到上限时封禁对端的 NodeId 与 IP 并关闭连接
+func (c *Connection) misbehave(m *Misbehaviour) {
+	metrics.Misbehaviour(m.Reason)
+
+	limit := int32(c.MainState.Config.Limits.BanScore)
+	score := atomic.AddInt32(&c.Score, m.Score)
+
+	log := logger.With(logger.Peer(c.Conn.RemoteAddr().String()))
+	log.Debug("Peer misbehaved: %s, score %d/%d", m.Reason, score, limit)
+
+	if score < limit {
+		return
+	}
+	defer c.Cancel()
+
+	// 只在首次越过上限时封禁
+	if score-m.Score >= limit {
+		return
+	}
+
+	until := c.MainState.Clock.Now().Add(time.Duration(c.MainState.Config.Limits.BanDuration) * time.Second)
+	if atomic.LoadInt32(&c.SessionState) == int32(StateCompleted) {
+		nodeId := blake3.Sum256(c.RemoteHandshake.PK[:])
+		if err := BanNode(c.MainState, nodeId, until, m.Reason); err != nil {
+			log.Warning("Save ban failed: %v", err)
+		}
+		log = log.With(logger.NodeId(nodeId))
+	}
+	// 本机多节点共用回环地址，不自动封禁
+	if ip, ok := RemoteIP(c.Conn); ok && !ip.IsLoopback() {
+		if err := BanIP(c.MainState, ip, until, m.Reason); err != nil {
+			log.Warning("Save ban failed: %v", err)
+		}
+	}
+
+	metrics.Banned()
+	log.Warning("Peer banned until %s: %s", until.Format(time.DateTime), m.Reason)
+}
@@ -0,0 +1,99 @@
+package p2p
+
+import (
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/models"
+	"encoding/binary"
+	"net"
+)
+
+// maxObservedAddressSize 地址观测消息的最大长度
+const maxObservedAddressSize = 4 + 2 + maxRecordAddrLen + 2 + maxRecordAddrLen
+
+// buildObservedAddress 构建地址观测消息
+// 格式：[4]回拨结果 + [2]观测地址长度 + 观测地址 + [2]被检查地址长度 + 被检查地址
+// 回拨结果为 TrueOrYes / FalseOrNo，未检查时为 RefuseOrNoNeed
+func buildObservedAddress(observed string, checked string, status uint32) []byte {
+	if len(observed) > maxRecordAddrLen {
+		observed = ""
+	}
+	if len(checked) > maxRecordAddrLen {
+		checked = ""
+	}
+
+	payload := make([]byte, 0, 4+2+len(observed)+2+len(checked))
+	var statusBuf [4]byte
+	binary.BigEndian.PutUint32(statusBuf[:], status)
+	payload = append(payload, statusBuf[:]...)
+	var observedLen [2]byte
+	binary.BigEndian.PutUint16(observedLen[:], uint16(len(observed)))
+	payload = append(payload, observedLen[:]...)
+	payload = append(payload, observed...)
+	var checkedLen [2]byte
+	binary.BigEndian.PutUint16(checkedLen[:], uint16(len(checked)))
+	payload = append(payload, checkedLen[:]...)
+	payload = append(payload, checked...)
+
+	message := make([]byte, 0, 4+4+len(payload))
+	// header
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], MsgObservedAddress)
+	message = append(message, header[:]...)
+	// 长度
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(payload)))
+	message = append(message, length[:]...)
+	// 内容
+	message = append(message, payload...)
+
+	return message
+}
+
+// sendObservedAddress 作为被连接方，告知发起方其被观测到的地址
+func (c *Connection) sendObservedAddress() {
+	message := buildObservedAddress(c.Conn.RemoteAddr().String(), "", RefuseOrNoNeed)
+
+	select {
+	case c.WriteQueue <- message:
+	default:
+	}
+}
+
+// processingObservedAddress 记录对方观测到的本节点地址与回拨结果
+func processingObservedAddress(b []byte, observer [32]byte, book *models.AddressBook) {
+	if len(b) < 4+2 {
+		return
+	}
+
+	status := binary.BigEndian.Uint32(b[0:4])
+	idx := 4
+
+	observedLen := int(binary.BigEndian.Uint16(b[idx : idx+2]))
+	idx += 2
+	if len(b) < idx+observedLen+2 {
+		return
+	}
+	observed := string(b[idx : idx+observedLen])
+	idx += observedLen
+
+	checkedLen := int(binary.BigEndian.Uint16(b[idx : idx+2]))
+	idx += 2
+	if len(b) < idx+checkedLen {
+		return
+	}
+	checked := string(b[idx : idx+checkedLen])
+
+	// 只记录 IP，端口为对方看到的临时端口
+	if host, _, err := net.SplitHostPort(observed); err == nil && net.ParseIP(host) != nil {
+		book.AddObservation(observer, host)
+		logger.Test("Observed address %v by %v", host, observer)
+	}
+
+	// 回拨结果
+	if checked != "" && (status == TrueOrYes || status == FalseOrNo) {
+		book.SetReachable(checked, status == TrueOrYes)
+		if status == FalseOrNo {
+			logger.Warning("Address %v is not reachable from %v", checked, observer)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package p2p
+
+import (
+	"TrustMesh-PoC-1/internal/db"
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/models"
+	"TrustMesh-PoC-1/internal/table"
+	"encoding/binary"
+)
+
+const (
+	// MaxPexRecords 单次节点交换最多携带的记录数
+	MaxPexRecords = 32
+	// maxPexSize 节点交换回复的最大长度
+	maxPexSize = 32 + 2 + MaxPexRecords*(32+2+maxRecordAddrLen)
+)
+
+// BuildPexRequest 构建节点交换请求，回复携带相同的事务 ID
+func BuildPexRequest(count uint16, transaction [32]byte) []byte {
+	message := make([]byte, 0, 4+2+32)
+
+	// header
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], MsgPexRequest)
+	message = append(message, header[:]...)
+	// 期望数量
+	var want [2]byte
+	binary.BigEndian.PutUint16(want[:], count)
+	message = append(message, want[:]...)
+	// 事务 ID
+	message = append(message, transaction[:]...)
+
+	return message
+}
+
+// buildPexResponse 构建节点交换回复
+func buildPexResponse(transaction [32]byte, records []PeerRecord) []byte {
+	payload := make([]byte, 0, 32+2+len(records)*(32+2+32))
+	payload = append(payload, transaction[:]...)
+	payload = appendPeerRecords(payload, records)
+
+	message := make([]byte, 0, 4+4+len(payload))
+	// header
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], MsgPexResponse)
+	message = append(message, header[:]...)
+	// 长度
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(payload)))
+	message = append(message, length[:]...)
+	// 内容
+	message = append(message, payload...)
+
+	return message
+}
+
+// ParsePexResponse 解析节点交换回复中的记录
+func ParsePexResponse(b []byte) []PeerRecord {
+	return parsePeerRecords(b, MaxPexRecords)
+}
+
+// processingPexRequest 处理节点交换请求，随机回复部分已知节点
+func (c *Connection) processingPexRequest(body [34]byte) {
+	want := int(binary.BigEndian.Uint16(body[0:2]))
+	if want <= 0 {
+		return
+	}
+	if want > MaxPexRecords {
+		want = MaxPexRecords
+	}
+	transaction := [32]byte(body[2:34])
+
+	requester := c.IOC.NodeId
+
+	peers := make([]table.Peer, 0, want)
+	err := c.MainState.DB.
+		Select("node_id").
+		Where("node_id <> ?", requester[:]).
+		Order("RANDOM()").
+		Limit(want).
+		Find(&peers).Error
+	if err != nil {
+		logger.Error("Failed to find peers: %v", err)
+		return
+	}
+
+	records := make([]PeerRecord, 0, len(peers))
+	for _, peer := range peers {
+		if len(peer.NodeID) != 32 {
+			continue
+		}
+		var r PeerRecord
+		copy(r.NodeId[:], peer.NodeID)
+		addr, err := db.BestAddress(c.MainState.DB, r.NodeId)
+		if err != nil || len(addr) > maxRecordAddrLen {
+			continue
+		}
+		r.Address = addr
+		records = append(records, r)
+	}
+
+	select {
+	case c.WriteQueue <- buildPexResponse(transaction, records):
+	case <-c.Ctx.Done():
+	}
+}
+
+// processingPexResponse 将节点交换回复投递到对应事务通道，没有发出过的请求的回复直接丢弃
+func processingPexResponse(b []byte, ioc *models.IOChannel) {
+	if len(b) < 32+2 {
+		return
+	}
+
+	var transactionId [32]byte
+	copy(transactionId[:], b[0:32])
+
+	ioc.ChannelsLock.RLock()
+	ch, exists := ioc.Channels[transactionId]
+	if exists {
+		select {
+		case ch <- b[32:]:
+		default:
+		}
+	} else {
+		logger.Test("Drop unsolicited pex response")
+	}
+	ioc.ChannelsLock.RUnlock()
+}
@@ -0,0 +1,76 @@
+package p2p
+
+import (
+	"TrustMesh-PoC-1/internal/clock"
+	"TrustMesh-PoC-1/internal/keys"
+	"TrustMesh-PoC-1/internal/maddr"
+	"TrustMesh-PoC-1/internal/tools"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+// Probe 回拨指定地址完成一次握手后立即断开，返回对方 NodeId
+// 仅用于可达性检查，不写入连接表
+func Probe(signer keys.Signer, addr string, timeout time.Duration) ([32]byte, error) {
+	// 检查地址是否有效
+	if !tools.IsValidForDial(addr) {
+		return [32]byte{}, fmt.Errorf("the address [%v] is not valid for dial", addr)
+	}
+
+	conn, err := maddr.Dial(addr, timeout)
+	if err != nil {
+		return [32]byte{}, err
+	}
+
+	return ProbeConn(conn, signer, clock.System, timeout)
+}
+
+// ProbeConn 在已建立的连接上完成一次握手后关闭连接，返回对方 NodeId，超时按 c 计时
+func ProbeConn(conn net.Conn, signer keys.Signer, c clock.Clock, timeout time.Duration) ([32]byte, error) {
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	if err := conn.SetDeadline(c.Now().Add(timeout)); err != nil {
+		return [32]byte{}, err
+	}
+
+	// Hello
+	hello, local, isPass := newHandshakeHello(signer, c.Now())
+	if !isPass {
+		return [32]byte{}, errors.New("build hello failed")
+	}
+	if _, err := conn.Write(hello[:]); err != nil {
+		return [32]byte{}, err
+	}
+
+	// Response
+	var headerBuf [4]byte
+	if _, err := io.ReadFull(conn, headerBuf[:]); err != nil {
+		return [32]byte{}, err
+	}
+	if binary.BigEndian.Uint32(headerBuf[:]) != MsgHandshakeResponse {
+		return [32]byte{}, errors.New("unexpected handshake reply")
+	}
+	var bodyBuf [136]byte
+	if _, err := io.ReadFull(conn, bodyBuf[:]); err != nil {
+		return [32]byte{}, err
+	}
+
+	// Confirm
+	confirm, remote, isPass := processingHandshakeResponse(signer, bodyBuf, local, c.Now())
+	if !isPass {
+		return [32]byte{}, errors.New("handshake verification failed")
+	}
+	if _, err := conn.Write(confirm[:]); err != nil {
+		return [32]byte{}, err
+	}
+
+	return blake3.Sum256(remote.PK[:]), nil
+}
@@ -1,7 +1,11 @@
 package p2p
 
 import (
+	"TrustMesh-PoC-1/internal/constants"
 	"TrustMesh-PoC-1/internal/models"
+	"TrustMesh-PoC-1/internal/ratelimit"
+	"TrustMesh-PoC-1/internal/trace"
+	"context"
 	"net"
 	"sync"
 )
@@ -22,6 +26,10 @@ const (
 	TMHSV1Domain uint32 = 0x7D4B2507
 	// TMHBDomain 心跳包
 	TMHBDomain uint32 = 0xB02F55D8
+	// TMADDRV1Domain 节点地址记录签名 Tag
+	TMADDRV1Domain uint32 = 0x5C1E93A7
+	// TMBSV1Domain 引导节点回复签名 Tag
+	TMBSV1Domain uint32 = 0x2E84D16B
 )
 
 // 表示字段
@@ -60,8 +68,62 @@ const (
 	MsgInquiryHaveProposal uint32 = 0x0000000B
 	// MsgInquiryReply 回复询问
 	MsgInquiryReply uint32 = 0x0000000C
+	// MsgPexRequest 节点交换请求
+	MsgPexRequest uint32 = 0x0000000D
+	// MsgPexResponse 节点交换回复
+	MsgPexResponse uint32 = 0x0000000E
+	// MsgFindNode DHT 查找节点
+	MsgFindNode uint32 = 0x0000000F
+	// MsgFindNodeReply DHT 查找节点回复
+	MsgFindNodeReply uint32 = 0x00000010
+	// MsgObservedAddress 告知对方其被观测到的地址
+	MsgObservedAddress uint32 = 0x00000011
+	// MsgKeyRotation 密钥轮换声明
+	MsgKeyRotation uint32 = 0x00000012
+	// MsgEvidence 双重签名证据
+	MsgEvidence uint32 = 0x00000013
 )
 
+// protocolNames 协议 ID 名称，用于指标标签
+var protocolNames = map[uint32]string{
+	MsgHandshakeHello:      "handshake_hello",
+	MsgHandshakeResponse:   "handshake_response",
+	MsgHandshakeConfirm:    "handshake_confirm",
+	MsgHeartbeat:           "heartbeat",
+	MsgBootstrapReport:     "bootstrap_report",
+	MsgBootstrapReply:      "bootstrap_reply",
+	MsgProposalBody:        "proposal_body",
+	MsgProposalSig:         "proposal_sig",
+	MsgInquiryHaveProposal: "inquiry_have_proposal",
+	MsgInquiryReply:        "inquiry_reply",
+	MsgPexRequest:          "pex_request",
+	MsgPexResponse:         "pex_response",
+	MsgFindNode:            "find_node",
+	MsgFindNodeReply:       "find_node_reply",
+	MsgObservedAddress:     "observed_address",
+	MsgKeyRotation:         "key_rotation",
+	MsgEvidence:            "evidence",
+}
+
+// 提案消息的上限，担保不计入
+const (
+	// maxProposalBodySize 追踪上下文 + 轮次 + 公钥 + 时间戳 + 签名 + 载荷
+	maxProposalBodySize = 1 + trace.ContextSize + 8 + 32 + 8 + 64 + constants.MaxPayloadSize
+	// maxProposalSigSize 追踪上下文 + 轮次 + 提案哈希 + 签名者数量 + 签名者
+	maxProposalSigSize = 1 + trace.ContextSize + 8 + 32 + 2 + constants.MaxSigners*(32+4+8+64+2)
+)
+
+// EvidenceSize 双重签名证据的长度：[1]类型 + [32]公钥 + [8]轮次 + 2 × ([32]提案哈希 + [4]分数 + [8]时间戳 + [64]签名)
+const EvidenceSize = 1 + 32 + 8 + 2*(32+4+8+64)
+
+// ProtocolName 协议 ID 名称，未知 ID 返回 "unknown"
+func ProtocolName(protocolId uint32) string {
+	if name, ok := protocolNames[protocolId]; ok {
+		return name
+	}
+	return "unknown"
+}
+
 // Connection 内部接口
 type Connection struct {
 	// 连接对象
@@ -72,10 +134,10 @@ type Connection struct {
 	Channels map[[32]byte]chan []byte
 	// 回拨通道互斥锁
 	ChannelsLock sync.RWMutex
-	// 结束信号
-	Done chan struct{}
-	// 结束信号 Once 对象
-	OnceDone sync.Once
+	// 连接上下文，取消即关闭连接
+	Ctx context.Context
+	// 关闭连接
+	Cancel context.CancelFunc
 	// 握手状态
 	SessionState int32
 	// 是否为发起者
@@ -94,4 +156,9 @@ type Connection struct {
 	LocalHandshake HandshakeMetadata
 	// 对方握手信息
 	RemoteHandshake HandshakeMetadata
+	// 违规分数，原子读写
+	Score int32
+	// 消息数与字节数令牌桶，只由读协程使用
+	msgBucket  *ratelimit.Bucket
+	byteBucket *ratelimit.Bucket
 }
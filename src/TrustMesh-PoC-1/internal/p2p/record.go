@@ -0,0 +1,190 @@
+package p2p
+
+import (
+	"TrustMesh-PoC-1/internal/keys"
+	"TrustMesh-PoC-1/internal/metrics"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+// maxRecordAddrLen 单条地址最大长度
+const maxRecordAddrLen = 255
+
+// PeerRecord 节点地址记录
+type PeerRecord struct {
+	NodeId  [32]byte
+	Address string
+}
+
+// appendPeerRecords 以 [2]数量 + ([32]NodeId + [2]地址长度 + 地址)* 的格式写入记录
+func appendPeerRecords(dst []byte, records []PeerRecord) []byte {
+	// 记录数量
+	var count [2]byte
+	binary.BigEndian.PutUint16(count[:], uint16(len(records)))
+	dst = append(dst, count[:]...)
+
+	for _, r := range records {
+		// NodeId
+		dst = append(dst, r.NodeId[:]...)
+		// 地址长度
+		var addrLen [2]byte
+		binary.BigEndian.PutUint16(addrLen[:], uint16(len(r.Address)))
+		dst = append(dst, addrLen[:]...)
+		// 地址
+		dst = append(dst, r.Address...)
+	}
+
+	return dst
+}
+
+// parsePeerRecords 解析记录，最多解析 max 条，遇到格式错误时返回已解析部分
+func parsePeerRecords(payload []byte, max int) []PeerRecord {
+	if len(payload) < 2 {
+		return nil
+	}
+
+	count := int(binary.BigEndian.Uint16(payload[0:2]))
+	if count > max {
+		count = max
+	}
+
+	records := make([]PeerRecord, 0, count)
+	idx := 2
+	for i := 0; i < count; i++ {
+		if len(payload) < idx+32+2 {
+			return records
+		}
+
+		var r PeerRecord
+		copy(r.NodeId[:], payload[idx:idx+32])
+		idx += 32
+
+		addrLen := int(binary.BigEndian.Uint16(payload[idx : idx+2]))
+		idx += 2
+		if addrLen == 0 || addrLen > maxRecordAddrLen || len(payload) < idx+addrLen {
+			return records
+		}
+		r.Address = string(payload[idx : idx+addrLen])
+		idx += addrLen
+
+		records = append(records, r)
+	}
+
+	return records
+}
+
+// AddressRecord 由所描述节点自签名的地址记录
+type AddressRecord struct {
+	PK        [32]byte
+	Timestamp uint64
+	Address   string
+	Signature [64]byte
+}
+
+// maxAddressRecordSize 单条地址记录最大长度
+const maxAddressRecordSize = 32 + 8 + 2 + maxRecordAddrLen + 64
+
+// NodeId 记录所描述节点的 NodeId
+func (r AddressRecord) NodeId() [32]byte {
+	return blake3.Sum256(r.PK[:])
+}
+
+// hash 计算地址记录的签名数据哈希
+func (r AddressRecord) hash() [32]byte {
+	// 创建 [4]byte 格式的 Tag
+	var TMADDRV1DomainTag [4]byte
+	binary.BigEndian.PutUint32(TMADDRV1DomainTag[:], TMADDRV1Domain)
+	// 创建 [8]byte 格式的日期
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], r.Timestamp)
+
+	data := make([]byte, 0, 4+32+8+len(r.Address))
+	data = append(data, TMADDRV1DomainTag[:]...)
+	data = append(data, r.PK[:]...)
+	data = append(data, timestamp[:]...)
+	data = append(data, r.Address...)
+
+	return blake3.Sum256(data)
+}
+
+// Verify 校验地址记录签名
+func (r AddressRecord) Verify() bool {
+	if len(r.Address) == 0 || len(r.Address) > maxRecordAddrLen {
+		return false
+	}
+
+	h := r.hash()
+	if !ed25519.Verify(r.PK[:], h[:], r.Signature[:]) {
+		metrics.SignatureFailure("address_record")
+		return false
+	}
+	return true
+}
+
+// NewAddressRecord 使用本地私钥为地址签名
+func NewAddressRecord(signer keys.Signer, addr string) (AddressRecord, error) {
+	if len(addr) == 0 || len(addr) > maxRecordAddrLen {
+		return AddressRecord{}, fmt.Errorf("invalid address length %d", len(addr))
+	}
+
+	r := AddressRecord{
+		Timestamp: uint64(time.Now().UnixMilli()),
+		Address:   addr,
+	}
+	copy(r.PK[:], signer.PublicKey())
+
+	h := r.hash()
+	signature, err := signer.Sign(h[:])
+	if err != nil {
+		return AddressRecord{}, fmt.Errorf("failed to sign address record: %w", err)
+	}
+	copy(r.Signature[:], signature)
+
+	return r, nil
+}
+
+// appendAddressRecord 以 [32]公钥 + [8]时间戳 + [2]地址长度 + 地址 + [64]签名 的格式写入记录
+func appendAddressRecord(dst []byte, r AddressRecord) []byte {
+	dst = append(dst, r.PK[:]...)
+
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], r.Timestamp)
+	dst = append(dst, timestamp[:]...)
+
+	var addrLen [2]byte
+	binary.BigEndian.PutUint16(addrLen[:], uint16(len(r.Address)))
+	dst = append(dst, addrLen[:]...)
+	dst = append(dst, r.Address...)
+
+	dst = append(dst, r.Signature[:]...)
+
+	return dst
+}
+
+// parseAddressRecord 解析单条地址记录，返回记录与消耗的字节数
+func parseAddressRecord(b []byte) (AddressRecord, int, error) {
+	var r AddressRecord
+
+	if len(b) < 32+8+2 {
+		return r, 0, errors.New("address record too short")
+	}
+	copy(r.PK[:], b[0:32])
+	r.Timestamp = binary.BigEndian.Uint64(b[32:40])
+
+	addrLen := int(binary.BigEndian.Uint16(b[40:42]))
+	if addrLen == 0 || addrLen > maxRecordAddrLen {
+		return r, 0, fmt.Errorf("invalid address length %d", addrLen)
+	}
+	if len(b) < 42+addrLen+64 {
+		return r, 0, errors.New("address record too short")
+	}
+	r.Address = string(b[42 : 42+addrLen])
+	copy(r.Signature[:], b[42+addrLen:42+addrLen+64])
+
+	return r, 42 + addrLen + 64, nil
+}
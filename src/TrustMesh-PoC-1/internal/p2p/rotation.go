@@ -0,0 +1,73 @@
+package p2p
+
+import (
+	"TrustMesh-PoC-1/internal/db"
+	"TrustMesh-PoC-1/internal/keys"
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/metrics"
+	"TrustMesh-PoC-1/internal/models"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+// buildKeyRotation 构建密钥轮换消息
+// 格式：[4]header + [136]轮换声明
+func buildKeyRotation(r keys.Rotation) []byte {
+	body := r.Encode()
+
+	message := make([]byte, 0, 4+keys.RotationSize)
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], MsgKeyRotation)
+	message = append(message, header[:]...)
+	message = append(message, body[:]...)
+
+	return message
+}
+
+// sendKeyRotation 本节点轮换过密钥时，握手后告知对方
+func (c *Connection) sendKeyRotation() {
+	r, ok := keys.CurrentRotation(c.MainState.Signer.PublicKey())
+	if !ok {
+		return
+	}
+
+	select {
+	case c.WriteQueue <- buildKeyRotation(r):
+	default:
+	}
+}
+
+// processingKeyRotation 校验轮换声明，并将旧 NodeId 的节点记录迁移到新 NodeId
+// 只接受由新密钥持有者在握手后发送的声明，签名无效或不属于发送方时返回违规
+func processingKeyRotation(b [keys.RotationSize]byte, remotePK [32]byte, mainState *models.MainStore) error {
+	r := keys.DecodeRotation(b)
+	if r.New != remotePK {
+		logger.Debug("Key rotation is not for the sender")
+		return ErrMalformed
+	}
+	if err := r.Verify(time.Now()); err != nil {
+		logger.Debug("Key rotation rejected: %v", err)
+		if errors.Is(err, keys.ErrRotationSignature) {
+			metrics.SignatureFailure("rotation")
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+
+	oldId := blake3.Sum256(r.Old[:])
+	newId := blake3.Sum256(r.New[:])
+
+	if err := db.RotatePeer(mainState.DB, oldId, newId); err != nil {
+		logger.Warning("Rotate peer %v failed: %v", oldId, err)
+		return nil
+	}
+	if mainState.RoutingTable != nil {
+		mainState.RoutingTable.Remove(oldId)
+	}
+
+	logger.Debug("Peer %v rotated key to %v", oldId, newId)
+	return nil
+}
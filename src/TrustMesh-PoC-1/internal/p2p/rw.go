@@ -1,9 +1,10 @@
 package p2p
 
 import (
-	"TrustMesh-PoC-1/internal/db"
+	"TrustMesh-PoC-1/internal/clock"
+	"TrustMesh-PoC-1/internal/keys"
 	"TrustMesh-PoC-1/internal/logger"
-	"TrustMesh-PoC-1/internal/tools"
+	"TrustMesh-PoC-1/internal/metrics"
 	"encoding/binary"
 	"errors"
 	"io"
@@ -15,10 +16,11 @@ import (
 	"github.com/zeebo/blake3"
 )
 
-func lenReadUnit32(conn net.Conn, maxLength uint32, deadline time.Duration) ([]byte, error) {
+// lenReadUnit32 读取带长度前缀的消息体，每次读取的截止时间按 clk 计算
+func lenReadUnit32(conn net.Conn, maxLength uint32, clk clock.Clock, deadline time.Duration) ([]byte, error) {
 	// 读取长度字段
 	var lenBuf [4]byte
-	if err := conn.SetReadDeadline(time.Now().Add(deadline)); err != nil {
+	if err := conn.SetReadDeadline(clk.Now().Add(deadline)); err != nil {
 		return nil, err
 	}
 	if _, err := io.ReadFull(conn, lenBuf[:]); err != nil {
@@ -28,12 +30,12 @@ func lenReadUnit32(conn net.Conn, maxLength uint32, deadline time.Duration) ([]b
 	// 确认 Body 长度
 	size := binary.BigEndian.Uint32(lenBuf[:])
 	if size > math.MaxInt32 || size > maxLength {
-		return nil, errors.New("length size too big")
+		return nil, errMessageTooLarge
 	}
 
 	// 读取 Body
 	bodyBuf := make([]byte, int(size))
-	if err := conn.SetReadDeadline(time.Now().Add(deadline)); err != nil {
+	if err := conn.SetReadDeadline(clk.Now().Add(deadline)); err != nil {
 		return nil, err
 	}
 	if _, err := io.ReadFull(conn, bodyBuf); err != nil {
@@ -43,34 +45,52 @@ func lenReadUnit32(conn net.Conn, maxLength uint32, deadline time.Duration) ([]b
 	return bodyBuf, nil
 }
 
+// readBody 读取带长度前缀的消息体，超过该类型的上限时计为违规
+func (c *Connection) readBody(maxLength uint32) ([]byte, error) {
+	bodyBuf, err := lenReadUnit32(c.Conn, maxLength, c.MainState.Clock, 10*time.Second)
+	if errors.Is(err, errMessageTooLarge) {
+		c.misbehave(ErrOversize)
+	}
+
+	return bodyBuf, err
+}
+
+// deadline 按节点时钟计算 d 之后的读写截止时间
+func (c *Connection) deadline(d time.Duration) time.Time {
+	return c.MainState.Clock.Now().Add(d)
+}
+
+// waitReady 等待握手完成，超时或连接关闭时返回 false
+func (c *Connection) waitReady(timeout time.Duration) bool {
+	ctx, cancel := clock.WithTimeout(c.Ctx, c.MainState.Clock, timeout)
+	defer cancel()
+
+	select {
+	case <-c.Ready:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
 // readLoop 读通道协程
 func (c *Connection) readLoop() {
-	defer c.OnceDone.Do(func() { close(c.Done) })
-
-	ct := c.MainState.ConnectionTable
+	defer c.Cancel()
 
 	// 握手阻塞
-	if c.IsInitiator {
-		ok := make(chan struct{})
-		select {
-		case <-c.Ready:
-			close(ok)
-		case <-tools.WaitTimeout(ok, 3*time.Second):
-			return
-		case <-c.Done:
-			return
-		}
+	if c.IsInitiator && !c.waitReady(3*time.Second) {
+		return
 	}
 
 	// 读循环
 	for {
 		select {
-		case <-c.Done:
+		case <-c.Ctx.Done():
 			return
 		default:
 			// 读取包头
 			var headerBuf [4]byte
-			if err := c.Conn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+			if err := c.Conn.SetReadDeadline(c.deadline(10 * time.Second)); err != nil {
 				return
 			}
 			if _, err := io.ReadFull(c.Conn, headerBuf[:]); err != nil {
@@ -88,7 +108,7 @@ func (c *Connection) readLoop() {
 				if state == int32(StateWaitingInitial) && protocolId == MsgHandshakeHello {
 					var bodyBuf [72]byte
 					// 读取 Hello 消息
-					if err := c.Conn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+					if err := c.Conn.SetReadDeadline(c.deadline(10 * time.Second)); err != nil {
 						return
 					}
 					if _, err := io.ReadFull(c.Conn, bodyBuf[:]); err != nil {
@@ -96,13 +116,13 @@ func (c *Connection) readLoop() {
 					}
 
 					// 处理消息
-					writeBuf, remote, local, isPass := processingHandshakeHello(bodyBuf)
+					writeBuf, remote, local, isPass := processingHandshakeHello(c.MainState.Signer, bodyBuf, c.MainState.Clock.Now())
 					c.RemoteHandshake = remote
 					c.LocalHandshake = local
 
 					// 变更状态
 					if isPass {
-						if err := c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+						if err := c.Conn.SetWriteDeadline(c.deadline(10 * time.Second)); err != nil {
 							return
 						}
 						if _, err := c.Conn.Write(writeBuf[:]); err != nil {
@@ -118,7 +138,7 @@ func (c *Connection) readLoop() {
 				} else if state == int32(StateWaitingReply) && protocolId == MsgHandshakeConfirm {
 					var bodyBuf [64]byte
 					// 读取 Confirm 消息
-					if err := c.Conn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+					if err := c.Conn.SetReadDeadline(c.deadline(10 * time.Second)); err != nil {
 						return
 					}
 					if _, err := io.ReadFull(c.Conn, bodyBuf[:]); err != nil {
@@ -135,19 +155,25 @@ func (c *Connection) readLoop() {
 						}
 						nodeId := blake3.Sum256(c.RemoteHandshake.PK[:])
 
-						// 注册连接
-						ct.Lock.Lock()
-						v, isExist := ct.Connection[nodeId]
-						if isExist {
-							go ConnectionAlreadyExists(nodeId, v)
+						// 注册连接，重复连接中落败则关闭
+						if !c.registerConnection(nodeId) {
+							select {
+							case c.NodeId <- nodeId:
+							default:
+							}
+							return
 						}
-						ct.Connection[nodeId] = c.IOC
-						ct.Lock.Unlock()
 
 						// 通知握手完成
 						close(c.Ready)
 
-						logger.Debug("Handshake done: %v", nodeId)
+						// 告知发起方其被观测到的地址
+						c.sendObservedAddress()
+						// 告知对方本节点的密钥轮换
+						c.sendKeyRotation()
+
+						metrics.Handshake(true)
+						logger.With(logger.NodeId(nodeId), logger.Peer(c.Conn.RemoteAddr().String())).Debug("Handshake done")
 
 						// 通知连接完成
 						select {
@@ -165,57 +191,161 @@ func (c *Connection) readLoop() {
 				}
 			}
 
+			metrics.Message(metrics.DirectionIn, ProtocolName(protocolId))
+
 			// 业务路由
 			switch protocolId {
 			case MsgHeartbeat:
 				var bodyBuf [4]byte
-				if err := c.Conn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+				if err := c.Conn.SetReadDeadline(c.deadline(10 * time.Second)); err != nil {
 					return
 				}
 				if _, err := io.ReadFull(c.Conn, bodyBuf[:]); err != nil {
 					return
 				}
+				if !c.admit(len(bodyBuf)) {
+					continue
+				}
 				if !processingHeartbeat(bodyBuf) {
 					return
 				}
 			case MsgBootstrapReply:
-				bodyBuf, err := lenReadUnit32(c.Conn, math.MaxInt32, 10*time.Second)
+				bodyBuf, err := c.readBody(maxBootstrapReplySize)
 				if err != nil {
 					return
 				}
-				go processingBootstrapReply(bodyBuf, db.GetDB())
+				if !c.admit(len(bodyBuf)) {
+					continue
+				}
+				// 只接受本节点按配置地址拨号的引导节点连接上的回复
+				remoteId := blake3.Sum256(c.RemoteHandshake.PK[:])
+				if !c.IsInitiator || !c.MainState.Bootstraps.Contains(remoteId) {
+					logger.With(logger.NodeId(remoteId)).Debug("Drop bootstrap reply from a peer that is not a dialled bootstrap")
+					continue
+				}
+				trusted, err := c.MainState.Config.TrustedBootstrapKeys()
+				if err != nil {
+					logger.Error("%v", err)
+					return
+				}
+				go processingBootstrapReply(c.MainState.Signer, bodyBuf, c.RemoteHandshake.PK, trusted, c.MainState.DB)
 			case MsgInquiryHaveProposal:
 				var bodyBuf [72]byte
-				if err := c.Conn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+				if err := c.Conn.SetReadDeadline(c.deadline(10 * time.Second)); err != nil {
 					return
 				}
 				if _, err := io.ReadFull(c.Conn, bodyBuf[:]); err != nil {
 					return
 				}
+				if !c.admit(len(bodyBuf)) {
+					continue
+				}
 				go c.h.ProcessingInquiry(bodyBuf, c.MainState, c.IOC)
 			case MsgProposalBody:
-				bodyBuf, err := lenReadUnit32(c.Conn, math.MaxInt32, 10*time.Second)
+				bodyBuf, err := c.readBody(maxProposalBodySize)
 				if err != nil {
 					return
 				}
-				go c.h.ProcessingProposalBody(bodyBuf, c.MainState)
+				if !c.admit(len(bodyBuf)) {
+					continue
+				}
+				go func() { c.report(c.h.ProcessingProposalBody(bodyBuf, c.MainState)) }()
 			case MsgInquiryReply:
 				var bodyBuf [36]byte
-				if err := c.Conn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+				if err := c.Conn.SetReadDeadline(c.deadline(10 * time.Second)); err != nil {
 					return
 				}
 				if _, err := io.ReadFull(c.Conn, bodyBuf[:]); err != nil {
 					return
 				}
+				if !c.admit(len(bodyBuf)) {
+					continue
+				}
 				go c.h.ProcessingInquiryReply(bodyBuf, c.IOC)
 			case MsgProposalSig:
-				bodyBuf, err := lenReadUnit32(c.Conn, math.MaxInt32, 10*time.Second)
+				bodyBuf, err := c.readBody(maxProposalSigSize)
 				if err != nil {
 					return
 				}
-				go c.h.ProcessProposalSig(bodyBuf, c.MainState)
+				if !c.admit(len(bodyBuf)) {
+					continue
+				}
+				go func() { c.report(c.h.ProcessProposalSig(bodyBuf, c.MainState)) }()
+			case MsgPexRequest:
+				var bodyBuf [34]byte
+				if err := c.Conn.SetReadDeadline(c.deadline(10 * time.Second)); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(c.Conn, bodyBuf[:]); err != nil {
+					return
+				}
+				if !c.admit(len(bodyBuf)) {
+					continue
+				}
+				go c.processingPexRequest(bodyBuf)
+			case MsgPexResponse:
+				bodyBuf, err := c.readBody(maxPexSize)
+				if err != nil {
+					return
+				}
+				if !c.admit(len(bodyBuf)) {
+					continue
+				}
+				go processingPexResponse(bodyBuf, c.IOC)
+			case MsgFindNode:
+				var bodyBuf [64]byte
+				if err := c.Conn.SetReadDeadline(c.deadline(10 * time.Second)); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(c.Conn, bodyBuf[:]); err != nil {
+					return
+				}
+				if !c.admit(len(bodyBuf)) {
+					continue
+				}
+				go c.processingFindNode(bodyBuf)
+			case MsgFindNodeReply:
+				bodyBuf, err := c.readBody(maxFindNodeReplySize)
+				if err != nil {
+					return
+				}
+				if !c.admit(len(bodyBuf)) {
+					continue
+				}
+				go processingFindNodeReply(bodyBuf, c.IOC)
+			case MsgObservedAddress:
+				bodyBuf, err := c.readBody(maxObservedAddressSize)
+				if err != nil {
+					return
+				}
+				if !c.admit(len(bodyBuf)) {
+					continue
+				}
+				go processingObservedAddress(bodyBuf, c.IOC.NodeId, c.MainState.AddressBook)
+			case MsgKeyRotation:
+				var bodyBuf [keys.RotationSize]byte
+				if err := c.Conn.SetReadDeadline(c.deadline(10 * time.Second)); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(c.Conn, bodyBuf[:]); err != nil {
+					return
+				}
+				if !c.admit(len(bodyBuf)) {
+					continue
+				}
+				go func() { c.report(processingKeyRotation(bodyBuf, c.RemoteHandshake.PK, c.MainState)) }()
+			case MsgEvidence:
+				bodyBuf, err := c.readBody(EvidenceSize)
+				if err != nil {
+					return
+				}
+				if !c.admit(len(bodyBuf)) {
+					continue
+				}
+				go func() { c.report(c.h.ProcessingEvidence(bodyBuf, c.MainState, c.IOC)) }()
 			default:
 				logger.Debug("Unknow protocolId: %v", protocolId)
+				c.misbehave(ErrUnknownProtocol)
 				return
 			}
 		}
@@ -224,27 +354,21 @@ func (c *Connection) readLoop() {
 
 // writeLoop 写通道协程
 func (c *Connection) writeLoop() {
-	defer c.OnceDone.Do(func() { close(c.Done) })
-
-	ct := c.MainState.ConnectionTable
+	defer c.Cancel()
 
 	// 握手阻塞
-	if !c.IsInitiator {
-		ok := make(chan struct{})
-		select {
-		case <-c.Ready:
-			close(ok)
-		case <-tools.WaitTimeout(ok, 3*time.Second):
-			return
-		case <-c.Done:
-			return
-		}
+	if !c.IsInitiator && !c.waitReady(3*time.Second) {
+		return
 	}
 
+	// 空闲超时，每条消息后重新计时
+	idle := c.MainState.Clock.NewTimer(30 * time.Second)
+	defer idle.Stop()
+
 	// 写循环
 	for {
 		select {
-		case <-c.Done:
+		case <-c.Ctx.Done():
 			return
 		default:
 			// 握手状态
@@ -254,12 +378,12 @@ func (c *Connection) writeLoop() {
 			if state != int32(StateCompleted) {
 				if state == int32(StateWaitingInitial) {
 					// 准备 Hello 消息
-					writeBuf, local, isPass := newHandshakeHello()
+					writeBuf, local, isPass := newHandshakeHello(c.MainState.Signer, c.MainState.Clock.Now())
 					c.LocalHandshake = local
 
 					// 变更状态并发送消息
 					if isPass {
-						if err := c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+						if err := c.Conn.SetWriteDeadline(c.deadline(10 * time.Second)); err != nil {
 							return
 						}
 						if _, err := c.Conn.Write(writeBuf[:]); err != nil {
@@ -274,7 +398,7 @@ func (c *Connection) writeLoop() {
 					}
 				} else if state == int32(StateWaitingReply) {
 					var headerBuf [4]byte
-					if err := c.Conn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+					if err := c.Conn.SetReadDeadline(c.deadline(10 * time.Second)); err != nil {
 						return
 					}
 					if _, err := io.ReadFull(c.Conn, headerBuf[:]); err != nil {
@@ -289,7 +413,7 @@ func (c *Connection) writeLoop() {
 
 					// 读取内容
 					var bodyBuf [136]byte
-					if err := c.Conn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+					if err := c.Conn.SetReadDeadline(c.deadline(10 * time.Second)); err != nil {
 						return
 					}
 					if _, err := io.ReadFull(c.Conn, bodyBuf[:]); err != nil {
@@ -297,12 +421,12 @@ func (c *Connection) writeLoop() {
 					}
 
 					// 处理消息
-					writeBuf, remote, isPass := processingHandshakeResponse(bodyBuf, c.LocalHandshake)
+					writeBuf, remote, isPass := processingHandshakeResponse(c.MainState.Signer, bodyBuf, c.LocalHandshake, c.MainState.Clock.Now())
 					c.RemoteHandshake = remote
 
 					if isPass {
 						// 发送消息
-						if err := c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+						if err := c.Conn.SetWriteDeadline(c.deadline(10 * time.Second)); err != nil {
 							return
 						}
 						if _, err := c.Conn.Write(writeBuf[:]); err != nil {
@@ -313,19 +437,23 @@ func (c *Connection) writeLoop() {
 						}
 						nodeId := blake3.Sum256(c.RemoteHandshake.PK[:])
 
-						// 注册连接
-						ct.Lock.Lock()
-						v, isExist := ct.Connection[nodeId]
-						if isExist {
-							go ConnectionAlreadyExists(nodeId, v)
+						// 注册连接，重复连接中落败则关闭
+						if !c.registerConnection(nodeId) {
+							select {
+							case c.NodeId <- nodeId:
+							default:
+							}
+							return
 						}
-						ct.Connection[nodeId] = c.IOC
-						ct.Lock.Unlock()
 
 						// 通知握手完成
 						close(c.Ready)
 
-						logger.Debug("Handshake done: %v", nodeId)
+						// 告知对方本节点的密钥轮换
+						c.sendKeyRotation()
+
+						metrics.Handshake(true)
+						logger.With(logger.NodeId(nodeId), logger.Peer(c.Conn.RemoteAddr().String())).Debug("Handshake done")
 
 						// 通知连接完成
 						select {
@@ -344,27 +472,29 @@ func (c *Connection) writeLoop() {
 
 			// 取消息
 			var msg []byte
-			ok := make(chan struct{})
 			select {
 			case msg = <-c.WriteQueue:
-				close(ok)
-			case <-tools.WaitTimeout(ok, 30*time.Second):
+				idle.Reset(30 * time.Second)
+			case <-idle.C():
 				return
-			case <-c.Done:
+			case <-c.Ctx.Done():
 				return
 			}
 
 			// 写消息
 			select {
-			case <-c.Done:
+			case <-c.Ctx.Done():
 				return
 			default:
-				if err := c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+				if err := c.Conn.SetWriteDeadline(c.deadline(10 * time.Second)); err != nil {
 					return
 				}
 				if _, err := c.Conn.Write(msg); err != nil {
 					return
 				}
+				if len(msg) >= 4 {
+					metrics.Message(metrics.DirectionOut, ProtocolName(binary.BigEndian.Uint32(msg)))
+				}
 				logger.Test("Write message: %v", msg)
 			}
 		}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"TrustMesh-PoC-1/internal/clock"
+	"sync"
+	"time"
+)
+
+// Bucket 令牌桶，以 rate 个每秒的速度补充，最多存放 burst 个
+type Bucket struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	clock  clock.Clock
+}
+
+// NewBucket 创建装满的令牌桶，按 c 计时
+func NewBucket(c clock.Clock, rate float64, burst float64) *Bucket {
+	return &Bucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   c.Now(),
+		clock:  c,
+	}
+}
+
+// Allow 取出 n 个令牌，不足时不取出并返回 false
+func (b *Bucket) Allow(n float64) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill(b.clock.Now())
+	if b.tokens < n {
+		return false
+	}
+	b.tokens -= n
+
+	return true
+}
+
+// Reserve 取出 n 个令牌，不足时预支并返回补足欠额需要等待的时长
+// 调用方等待返回的时长之后再继续，欠额不会超过一次预支的量
+func (b *Bucket) Reserve(n float64) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill(b.clock.Now())
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// full 令牌桶是否已装满
+func (b *Bucket) full(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// refill 按经过的时间补充令牌，调用方持有 lock
+func (b *Bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed*b.rate)
+	}
+	b.last = now
+}
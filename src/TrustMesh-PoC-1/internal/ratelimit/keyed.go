@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"TrustMesh-PoC-1/internal/clock"
+	"sync"
+	"time"
+)
+
+// pruneEvery 清理已装满令牌桶的间隔
+const pruneEvery = time.Minute
+
+// Keyed 按键区分的令牌桶，例如每个远端 IP 一个
+type Keyed struct {
+	lock      sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*Bucket
+	lastPrune time.Time
+	clock     clock.Clock
+}
+
+// NewKeyed 创建按键区分的令牌桶，按 c 计时
+func NewKeyed(c clock.Clock, rate float64, burst float64) *Keyed {
+	return &Keyed{
+		rate:      rate,
+		burst:     burst,
+		buckets:   make(map[string]*Bucket),
+		lastPrune: c.Now(),
+		clock:     c,
+	}
+}
+
+// Allow 从 key 的令牌桶中取出一个令牌
+func (k *Keyed) Allow(key string) bool {
+	now := k.clock.Now()
+
+	k.lock.Lock()
+	// 装满的令牌桶与新建的等价，定期删除以免键无限增长
+	if now.Sub(k.lastPrune) >= pruneEvery {
+		for id, b := range k.buckets {
+			if b.full(now) {
+				delete(k.buckets, id)
+			}
+		}
+		k.lastPrune = now
+	}
+
+	b, ok := k.buckets[key]
+	if !ok {
+		b = NewBucket(k.clock, k.rate, k.burst)
+		k.buckets[key] = b
+	}
+	k.lock.Unlock()
+
+	return b.Allow(1)
+}
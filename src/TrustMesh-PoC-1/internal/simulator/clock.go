@@ -0,0 +1,208 @@
+package simulator
+
+import (
+	"TrustMesh-PoC-1/internal/clock"
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Clock 虚拟时钟，实现 clock.Clock
+// 节点在各自的协程中运行，Run 在全部协程阻塞之后才执行下一批定时事件并推进时间，
+// 因此节点看到的时序与真实运行时相同，但不需要等待真实时间
+type Clock struct {
+	lock   sync.Mutex
+	now    time.Time
+	seq    uint64
+	events eventQueue
+	// 判断协程是否全部阻塞
+	idle *idleProbe
+}
+
+var _ clock.Clock = (*Clock)(nil)
+
+// event 一个定时事件，同一时间的事件按加入顺序执行
+type event struct {
+	at  time.Time
+	seq uint64
+	fn  func()
+}
+
+// NewClock 创建从 start 开始的虚拟时钟，运行时不提供判断协程阻塞所需的调度指标时返回错误
+func NewClock(start time.Time) (*Clock, error) {
+	idle, err := newIdleProbe()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Clock{now: start, idle: idle}, nil
+}
+
+// Now 当前虚拟时间
+func (c *Clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+// At 在虚拟时间 t 执行 fn，t 早于当前时间时在当前时间执行
+// fn 在调用 Run 的协程中执行，不能阻塞
+func (c *Clock) At(t time.Time, fn func()) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if t.Before(c.now) {
+		t = c.now
+	}
+	c.seq++
+	heap.Push(&c.events, event{at: t, seq: c.seq, fn: fn})
+}
+
+// After 经过 d 虚拟时间之后向返回的通道发送当时的时间
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.At(c.Now().Add(d), func() { ch <- c.Now() })
+	return ch
+}
+
+// NewTimer 经过 d 虚拟时间之后向 C 发送当时的时间
+func (c *Clock) NewTimer(d time.Duration) clock.Timer {
+	t := &timer{clock: c, ch: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// timer 虚拟定时器
+// 推迟到期时间时不新增事件，事件执行时发现未到期再按新的到期时间加入队列，
+// 因此每条消息后都重新计时的空闲超时只占用一个事件
+type timer struct {
+	clock *Clock
+	ch    chan time.Time
+	lock  sync.Mutex
+	// 到期时间，active 为 false 时已停止或已到期
+	deadline time.Time
+	active   bool
+	// 有效事件的代数与执行时间，提前到期时代数加一，之前的事件随之失效
+	gen  uint64
+	at   time.Time
+	live bool
+}
+
+func (t *timer) C() <-chan time.Time { return t.ch }
+
+func (t *timer) Reset(d time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.drain()
+	t.deadline = t.clock.Now().Add(d)
+	t.active = true
+	if t.live && !t.at.After(t.deadline) {
+		return
+	}
+	t.gen++
+	t.schedule()
+}
+
+func (t *timer) Stop() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.drain()
+	t.active = false
+}
+
+// drain 丢弃尚未接收的到期时间，调用方持有 lock
+func (t *timer) drain() {
+	select {
+	case <-t.ch:
+	default:
+	}
+}
+
+// schedule 在到期时间加入当前代数的事件，调用方持有 lock
+func (t *timer) schedule() {
+	gen := t.gen
+	t.at = t.deadline
+	t.live = true
+	t.clock.At(t.deadline, func() { t.fire(gen) })
+}
+
+// fire 事件执行，未到期时按到期时间重新加入队列
+func (t *timer) fire(gen uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if gen != t.gen {
+		return
+	}
+	t.live = false
+	if !t.active {
+		return
+	}
+	now := t.clock.Now()
+	if now.Before(t.deadline) {
+		t.schedule()
+		return
+	}
+
+	t.active = false
+	select {
+	case t.ch <- now:
+	default:
+	}
+}
+
+// Run 执行 until 之前（含）的事件，返回执行的事件数
+// 每批同一时间的事件执行前等待其余协程全部阻塞，返回前同样等待
+func (c *Clock) Run(until time.Time) int {
+	n := 0
+	for {
+		c.idle.wait()
+
+		c.lock.Lock()
+		if len(c.events) == 0 || c.events[0].at.After(until) {
+			if c.now.Before(until) {
+				c.now = until
+			}
+			c.lock.Unlock()
+			return n
+		}
+		at := c.events[0].at
+		c.now = at
+		var batch []func()
+		for len(c.events) > 0 && c.events[0].at.Equal(at) {
+			batch = append(batch, heap.Pop(&c.events).(event).fn)
+		}
+		c.lock.Unlock()
+
+		for _, fn := range batch {
+			fn()
+		}
+		n += len(batch)
+	}
+}
+
+// eventQueue 按时间与加入顺序排列的小顶堆
+type eventQueue []event
+
+func (q eventQueue) Len() int { return len(q) }
+
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at.Before(q[j].at)
+}
+
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *eventQueue) Push(x any) { *q = append(*q, x.(event)) }
+
+func (q *eventQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,249 @@
+package simulator
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Addr 模拟节点的地址
+type Addr struct {
+	Node int
+}
+
+// Network 地址类型
+func (Addr) Network() string { return "sim" }
+
+func (a Addr) String() string { return fmt.Sprintf("node-%d", a.Node+1) }
+
+// Conn 内存网络上的一端连接，实现 net.Conn
+// 与 TCP 一样是按序到达的字节流，写入不会阻塞；截止时间使用虚拟时间
+type Conn struct {
+	network *Network
+	local   int
+	remote  int
+	peer    *Conn
+	// 本方向的时延与重传，只在持有 lock 时使用
+	rng *rand.Rand
+
+	lock sync.Mutex
+	cond *sync.Cond
+	// 已到达尚未读取的数据
+	buf []byte
+	// 本端已关闭
+	closed bool
+	// 对端已关闭且之前的数据已全部到达
+	eof bool
+	// 连接被分区重置
+	reset bool
+	// 虚拟截止时间，零值表示不限
+	readDeadline  time.Time
+	writeDeadline time.Time
+	// 已安排的唤醒时间，每端最多一个，避免每次设置截止时间都加入事件
+	wakeAt time.Time
+	// 本端发出的最后一段数据的到达时间，之后的数据不早于它到达
+	arrival time.Time
+}
+
+var _ net.Conn = (*Conn)(nil)
+
+// newConn 创建一端连接
+func newConn(network *Network, local int, remote int, seed int64) *Conn {
+	c := &Conn{network: network, local: local, remote: remote, rng: rand.New(rand.NewSource(seed))}
+	c.cond = sync.NewCond(&c.lock)
+	return c
+}
+
+// Read 读取已到达的数据，没有数据时阻塞到数据到达、连接关闭或截止时间
+func (c *Conn) Read(b []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for len(c.buf) == 0 {
+		switch {
+		case c.closed:
+			return 0, net.ErrClosed
+		case c.reset:
+			return 0, syscall.ECONNRESET
+		case c.eof:
+			return 0, io.EOF
+		case c.expired(c.readDeadline):
+			return 0, os.ErrDeadlineExceeded
+		}
+		c.cond.Wait()
+	}
+
+	n := copy(b, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// Write 发送数据，按链路时延到达对端；与对端被分区隔开时重置连接
+func (c *Conn) Write(b []byte) (int, error) {
+	c.lock.Lock()
+	switch {
+	case c.closed:
+		c.lock.Unlock()
+		return 0, net.ErrClosed
+	case c.reset:
+		c.lock.Unlock()
+		return 0, syscall.ECONNRESET
+	case c.expired(c.writeDeadline):
+		c.lock.Unlock()
+		return 0, os.ErrDeadlineExceeded
+	}
+	c.lock.Unlock()
+
+	if !c.network.transmit(c, append([]byte(nil), b...)) {
+		return 0, syscall.ECONNRESET
+	}
+	return len(b), nil
+}
+
+// Close 关闭本端，对端在已发出的数据到达之后读到 EOF
+func (c *Conn) Close() error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.buf = nil
+	c.cond.Broadcast()
+	c.lock.Unlock()
+
+	at := c.schedule(c.network.clock.Now().Add(c.network.link.Latency))
+	c.network.clock.At(at, c.peer.hangup)
+
+	return nil
+}
+
+// LocalAddr 本端地址
+func (c *Conn) LocalAddr() net.Addr { return Addr{Node: c.local} }
+
+// RemoteAddr 对端地址
+func (c *Conn) RemoteAddr() net.Addr { return Addr{Node: c.remote} }
+
+// SetDeadline 同时设置读写截止时间（虚拟时间）
+func (c *Conn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline 设置读截止时间（虚拟时间），到时唤醒阻塞的 Read
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.readDeadline = t
+	c.cond.Broadcast()
+	c.arm()
+
+	return nil
+}
+
+// SetWriteDeadline 设置写截止时间（虚拟时间）
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.writeDeadline = t
+	return nil
+}
+
+// arm 在读截止时间安排唤醒，已安排的唤醒不晚于它时不重复安排，调用方持有锁
+func (c *Conn) arm() {
+	t := c.readDeadline
+	if t.IsZero() || (!c.wakeAt.IsZero() && !c.wakeAt.After(t)) {
+		return
+	}
+	c.wakeAt = t
+	c.network.clock.At(t, c.wake)
+}
+
+// wake 唤醒时间到达，截止时间已过时唤醒阻塞的 Read，截止时间被推迟时重新安排
+func (c *Conn) wake() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.wakeAt = time.Time{}
+	if c.expired(c.readDeadline) {
+		c.cond.Broadcast()
+		return
+	}
+	c.arm()
+}
+
+// delay 本方向一段数据的时延：基础时延、抖动与丢包重传，调用方持有锁
+func (c *Conn) delay(link LinkConfig) (time.Duration, int) {
+	d := link.Latency
+	if link.Jitter > 0 {
+		d += time.Duration(c.rng.Int63n(int64(link.Jitter)))
+	}
+
+	// 每次丢失在重传超时后重发，超时逐次加倍
+	retransmits := 0
+	rto := max(minRTO, 2*(link.Latency+link.Jitter))
+	for link.Loss > 0 && c.rng.Float64() < link.Loss {
+		d += rto
+		rto *= 2
+		retransmits++
+	}
+
+	return d, retransmits
+}
+
+// schedule 计算本端下一段数据的到达时间，保证按序到达
+func (c *Conn) schedule(at time.Time) time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if at.Before(c.arrival) {
+		at = c.arrival
+	}
+	c.arrival = at
+	return at
+}
+
+// deliver 数据到达本端
+func (c *Conn) deliver(data []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed || c.reset {
+		return
+	}
+	c.buf = append(c.buf, data...)
+	c.cond.Broadcast()
+}
+
+// hangup 对端已关闭
+func (c *Conn) hangup() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.eof = true
+	c.cond.Broadcast()
+}
+
+// abort 连接被重置，未读取的数据丢弃
+func (c *Conn) abort() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.reset = true
+	c.buf = nil
+	c.cond.Broadcast()
+}
+
+// expired 截止时间是否已过，调用方持有锁
+func (c *Conn) expired(deadline time.Time) bool {
+	return !deadline.IsZero() && !c.network.clock.Now().Before(deadline)
+}
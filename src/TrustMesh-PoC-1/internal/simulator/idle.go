@@ -0,0 +1,67 @@
+package simulator
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/metrics"
+	"time"
+)
+
+// 判断协程是否全部阻塞所用的调度指标，Go 1.26 起提供
+var idleMetrics = []string{
+	"/sched/goroutines/running:goroutines",
+	"/sched/goroutines/runnable:goroutines",
+	"/sched/goroutines/not-in-go:goroutines",
+}
+
+// idleChecks 连续多少次检查都没有其他可运行的协程才视为静止
+const idleChecks = 2
+
+// idleProbe 通过调度指标判断除调用方以外的协程是否全部阻塞
+// 阻塞在通道、锁、条件变量或虚拟时钟上的协程都处于等待状态，只有运行、可运行与系统调用中的协程还会产生新的事件
+type idleProbe struct {
+	samples []metrics.Sample
+}
+
+// newIdleProbe 创建探测器，运行时不提供所需指标时返回错误
+// 没有这些指标就无法判断节点是否还在处理消息，按固定时间让出会使虚拟时间跑在节点前面
+func newIdleProbe() (*idleProbe, error) {
+	p := &idleProbe{samples: make([]metrics.Sample, len(idleMetrics))}
+	for i, name := range idleMetrics {
+		p.samples[i].Name = name
+	}
+
+	metrics.Read(p.samples)
+	for _, s := range p.samples {
+		if s.Value.Kind() != metrics.KindUint64 {
+			return nil, fmt.Errorf("runtime metric %s is not supported by %s, the simulator needs Go 1.26 or later", s.Name, runtime.Version())
+		}
+	}
+
+	return p, nil
+}
+
+// wait 等待其余协程全部阻塞
+func (p *idleProbe) wait() {
+	for quiet, spins := 0, 0; quiet < idleChecks; spins++ {
+		// 让出处理器，长时间忙碌时（例如数据库写入）短暂休眠以免空转
+		if spins%256 == 255 {
+			time.Sleep(10 * time.Microsecond)
+		} else {
+			runtime.Gosched()
+		}
+
+		metrics.Read(p.samples)
+		var active uint64
+		for _, s := range p.samples {
+			active += s.Value.Uint64()
+		}
+
+		// 调用方自己处于运行状态
+		if active <= 1 {
+			quiet++
+		} else {
+			quiet = 0
+		}
+	}
+}
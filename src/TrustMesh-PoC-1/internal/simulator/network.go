@@ -0,0 +1,276 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// minRTO 最小重传超时，与 Linux TCP 相同
+const minRTO = 200 * time.Millisecond
+
+// LinkConfig 链路参数，对所有链路生效
+type LinkConfig struct {
+	// 单向基础时延
+	Latency time.Duration
+	// 在基础时延上叠加 [0, Jitter) 的均匀随机时延
+	Jitter time.Duration
+	// 每次发送丢失的概率，丢失的数据在重传超时后重发，连接上之后的数据随之推迟
+	Loss float64
+}
+
+// Partition 一段时间内的网络分区，不同分组的节点之间无法拨号，已有连接在下一次写入时被重置
+type Partition struct {
+	// 相对模拟开始的时间，[Start, End)
+	Start time.Duration
+	End   time.Duration
+	// 节点序号 | 分组，未列出的节点属于分组 0
+	Groups map[int]int
+}
+
+// SplitPartition 将 nodes 个节点按序号平均切分为 groups 个分区
+func SplitPartition(start time.Duration, end time.Duration, nodes int, groups int) Partition {
+	p := Partition{Start: start, End: end, Groups: make(map[int]int, nodes)}
+	for i := 0; i < nodes; i++ {
+		p.Groups[i] = i * groups / nodes
+	}
+	return p
+}
+
+// separates 分区在 offset 时是否隔开 a 与 b
+func (p Partition) separates(a int, b int, offset time.Duration) bool {
+	if offset < p.Start || offset >= p.End {
+		return false
+	}
+	return p.Groups[a] != p.Groups[b]
+}
+
+// NetStats 网络统计
+type NetStats struct {
+	// 建立的连接数
+	Conns uint64
+	// 写入的次数与字节数
+	Messages uint64
+	Bytes    uint64
+	// 丢包引起的重传次数
+	Retransmits uint64
+	// 被分区阻断的拨号与重置的连接数
+	Cut uint64
+}
+
+// Network 内存网络，节点在地址上监听，连接上写入的数据按时延在虚拟时钟上投递到对端
+type Network struct {
+	clock      *Clock
+	start      time.Time
+	link       LinkConfig
+	partitions []Partition
+	seed       int64
+
+	lock sync.Mutex
+	// 地址 | 监听
+	listeners map[string]*Listener
+	// 已建立的连接数，用于派生每条连接的随机数种子
+	dialed int64
+
+	conns       atomic.Uint64
+	messages    atomic.Uint64
+	bytes       atomic.Uint64
+	retransmits atomic.Uint64
+	cut         atomic.Uint64
+}
+
+// NewNetwork 创建内存网络，分区时间相对于 start
+func NewNetwork(clock *Clock, start time.Time, link LinkConfig, partitions []Partition, seed int64) (*Network, error) {
+	if link.Latency < 0 || link.Jitter < 0 {
+		return nil, fmt.Errorf("latency and jitter must >= 0")
+	}
+	if link.Loss < 0 || link.Loss >= 1 {
+		return nil, fmt.Errorf("loss must be in [0, 1)")
+	}
+	for _, p := range partitions {
+		if p.End <= p.Start {
+			return nil, fmt.Errorf("partition end must > start")
+		}
+	}
+
+	return &Network{
+		clock:      clock,
+		start:      start,
+		link:       link,
+		partitions: partitions,
+		seed:       seed,
+		listeners:  make(map[string]*Listener),
+	}, nil
+}
+
+// Listen 节点 node 在 addr 上监听
+func (n *Network) Listen(node int, addr string) (*Listener, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if _, ok := n.listeners[addr]; ok {
+		return nil, fmt.Errorf("address %s already in use", addr)
+	}
+	l := &Listener{
+		network: n,
+		node:    node,
+		addr:    addr,
+		queue:   make(chan *Conn, 128),
+		done:    make(chan struct{}),
+	}
+	n.listeners[addr] = l
+
+	return l, nil
+}
+
+// Dialer 节点 from 的拨号函数，与 maddr.DialContext 的签名相同
+// 建立连接需要一个往返时间；与对方被分区隔开时拨号一直等到 ctx 超时
+func (n *Network) Dialer(from int) func(ctx context.Context, addr string) (net.Conn, error) {
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		n.lock.Lock()
+		l, ok := n.listeners[addr]
+		n.lock.Unlock()
+		if !ok {
+			return nil, &net.OpError{Op: "dial", Net: "sim", Err: syscall.ECONNREFUSED}
+		}
+
+		if n.separated(from, l.node, n.clock.Now()) {
+			n.cut.Add(1)
+			<-ctx.Done()
+			return nil, &net.OpError{Op: "dial", Net: "sim", Err: ctx.Err()}
+		}
+
+		select {
+		case <-n.clock.After(2 * n.link.Latency):
+		case <-ctx.Done():
+			return nil, &net.OpError{Op: "dial", Net: "sim", Err: ctx.Err()}
+		}
+
+		local, remote := n.pair(from, l.node)
+		if !l.enqueue(remote) {
+			return nil, &net.OpError{Op: "dial", Net: "sim", Err: syscall.ECONNREFUSED}
+		}
+
+		return local, nil
+	}
+}
+
+// pair 在节点 a 与 b 之间建立连接，返回两端
+func (n *Network) pair(a int, b int) (*Conn, *Conn) {
+	n.lock.Lock()
+	n.dialed++
+	seed := n.seed ^ n.dialed<<32
+	n.lock.Unlock()
+	n.conns.Add(1)
+
+	ca := newConn(n, a, b, seed)
+	cb := newConn(n, b, a, seed+1)
+	ca.peer, cb.peer = cb, ca
+
+	return ca, cb
+}
+
+// Stats 网络统计
+func (n *Network) Stats() NetStats {
+	return NetStats{
+		Conns:       n.conns.Load(),
+		Messages:    n.messages.Load(),
+		Bytes:       n.bytes.Load(),
+		Retransmits: n.retransmits.Load(),
+		Cut:         n.cut.Load(),
+	}
+}
+
+// transmit 发送一段数据，计算到达时间并投递
+// 两端被分区隔开时重置连接并返回 false
+func (n *Network) transmit(c *Conn, data []byte) bool {
+	now := n.clock.Now()
+	n.messages.Add(1)
+	n.bytes.Add(uint64(len(data)))
+
+	peer := c.peer
+	if n.separated(c.local, c.remote, now) {
+		n.cut.Add(1)
+		c.abort()
+		n.clock.At(now.Add(n.link.Latency), peer.abort)
+		return false
+	}
+
+	c.lock.Lock()
+	delay, retransmits := c.delay(n.link)
+	c.lock.Unlock()
+	n.retransmits.Add(uint64(retransmits))
+
+	at := c.schedule(now.Add(delay))
+	n.clock.At(at, func() { peer.deliver(data) })
+
+	return true
+}
+
+// separated 节点 a 与 b 在 t 时是否被分区隔开
+func (n *Network) separated(a int, b int, t time.Time) bool {
+	offset := t.Sub(n.start)
+	for _, p := range n.partitions {
+		if p.separates(a, b, offset) {
+			return true
+		}
+	}
+	return false
+}
+
+// Listener 内存网络上的监听，实现 net.Listener
+type Listener struct {
+	network *Network
+	node    int
+	addr    string
+	queue   chan *Conn
+	once    sync.Once
+	done    chan struct{}
+}
+
+var _ net.Listener = (*Listener)(nil)
+
+// Accept 等待入站连接
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.queue:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close 关闭监听，之后的拨号被拒绝
+func (l *Listener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+
+		l.network.lock.Lock()
+		delete(l.network.listeners, l.addr)
+		l.network.lock.Unlock()
+	})
+	return nil
+}
+
+// Addr 监听地址
+func (l *Listener) Addr() net.Addr { return Addr{Node: l.node} }
+
+// enqueue 交付入站连接，监听已关闭或队列已满时返回 false
+func (l *Listener) enqueue(c *Conn) bool {
+	select {
+	case <-l.done:
+		return false
+	default:
+	}
+
+	select {
+	case l.queue <- c:
+		return true
+	default:
+		return false
+	}
+}
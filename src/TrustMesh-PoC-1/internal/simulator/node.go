@@ -0,0 +1,122 @@
+package simulator
+
+import (
+	"TrustMesh-PoC-1/internal/config"
+	"TrustMesh-PoC-1/internal/connmgr"
+	"TrustMesh-PoC-1/internal/consensus"
+	"TrustMesh-PoC-1/internal/db"
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/models"
+	"TrustMesh-PoC-1/internal/network"
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+// memSigner 内存签名服务，模拟节点的私钥不落盘
+type memSigner struct {
+	privateKey ed25519.PrivateKey
+}
+
+func (s memSigner) PublicKey() ed25519.PublicKey {
+	return s.privateKey.Public().(ed25519.PublicKey)
+}
+
+func (s memSigner) Sign(message []byte) ([]byte, error) {
+	return ed25519.Sign(s.privateKey, message), nil
+}
+
+func (memSigner) Close() error { return nil }
+
+// simNode 模拟节点
+// 与真实节点运行相同的连接管理、握手、读写循环、限流与轮次执行，只是连接来自内存网络、时间来自虚拟时钟
+type simNode struct {
+	index int
+	id    [32]byte
+	// 内存网络上的监听地址
+	addr     string
+	state    *models.MainStore
+	conns    *connmgr.ConnManager
+	listener *Listener
+}
+
+// newSimNode 创建模拟节点，cfg 为该节点独有的配置
+// 节点表使用内存数据库，连接的生命周期由 connCtx 决定
+func newSimNode(sim *Simulator, index int, cfg *config.Config, seed int64, connCtx context.Context) (*simNode, error) {
+	rng := rand.New(rand.NewSource(seed))
+
+	var keySeed [ed25519.SeedSize]byte
+	rng.Read(keySeed[:])
+	signer := memSigner{privateKey: ed25519.NewKeyFromSeed(keySeed[:])}
+
+	database, err := db.Open(":memory:")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database of node %d: %w", index+1, err)
+	}
+
+	n := &simNode{
+		index: index,
+		id:    blake3.Sum256(signer.PublicKey()),
+		addr:  fmt.Sprintf("/unix/sim/node-%d", index+1),
+		state: new(models.MainStore),
+	}
+
+	state := n.state
+	state.Init(cfg, sim.clock)
+	state.Signer = signer
+	state.DB = database
+	state.Sender = consensus.NewSender(state)
+	state.Verified = sim.verified
+	state.Observer = sim
+
+	opt := connmgr.DefaultOptions()
+	opt.Dial = sim.network.Dialer(index)
+	n.conns = connmgr.New(connCtx, state, opt)
+	state.ConnManager = n.conns
+	state.RoutingTable = models.NewRoutingTable(n.id)
+
+	n.listener, err = sim.network.Listen(index, n.addr)
+	if err != nil {
+		_ = db.Close(database)
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// introduce 将邻居写入节点表，相当于引导节点下发的节点列表
+func (n *simNode) introduce(peer *simNode) error {
+	return db.SavePeer(n.state.DB, peer.id, peer.addr, "FROM Sim")
+}
+
+// start 启动监听、出站连接维护与轮次循环
+// clientCtx 取消后不再开始新轮次，进行中的轮次最多再运行 drain
+func (n *simNode) start(connCtx context.Context, clientCtx context.Context, drain time.Duration, services *sync.WaitGroup, clients *sync.WaitGroup) {
+	services.Add(2)
+	go func() {
+		defer services.Done()
+		network.ServeNode(connCtx, n.state, n.listener)
+	}()
+	go func() {
+		defer services.Done()
+		n.conns.Run(connCtx)
+	}()
+
+	clients.Add(1)
+	go func() {
+		defer clients.Done()
+		if err := network.StartNodeClient(clientCtx, n.state, drain); err != nil {
+			logger.With(logger.NodeId(n.id)).Error("Simulated node %d client error: %v", n.index+1, err)
+		}
+	}()
+}
+
+// close 关闭节点表
+func (n *simNode) close() error {
+	return db.Close(n.state.DB)
+}
@@ -0,0 +1,332 @@
+package simulator
+
+import (
+	"TrustMesh-PoC-1/internal/config"
+	"TrustMesh-PoC-1/internal/keys"
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/models"
+	"TrustMesh-PoC-1/internal/node"
+	"TrustMesh-PoC-1/internal/p2p"
+	"TrustMesh-PoC-1/internal/topology"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// awaitLimit 停止后等待节点协程退出的最长虚拟时间，以轮次间隔计
+const awaitLimit = 4
+
+// Config 模拟参数
+type Config struct {
+	// 节点数
+	Nodes int
+	// 模拟的轮次数
+	Rounds int
+	// 第一个轮次，0 时取当前时间的下一轮
+	FirstRound int64
+	// 节点配置，共识与限流参数对全部节点生效，DataDir 由 OutDir 决定
+	Node config.Config
+	// 拓扑名称与目标度数，见 topology.New；节点表中只有拓扑中的邻居
+	Topology        string
+	Degree          int
+	TopologyOptions topology.Options
+	// 链路参数与网络分区
+	Link       LinkConfig
+	Partitions []Partition
+	// 随机种子，决定拓扑、密钥、时延与丢包
+	// 节点在各自的协程中运行，信誉与载荷也与真实节点一样随机生成，因此同一种子的结果并不逐位相同
+	Seed int64
+	// 输出目录，节点 i 的区块写入 <OutDir>/node-<i>/block/<round>.json，为空时写入临时目录并在结束后删除
+	// 第一个轮次的前一轮用于建立连接，其区块同样写入但不计入结果
+	OutDir string
+}
+
+// RoundResult 一个轮次的结果
+type RoundResult struct {
+	Round int64
+	// 完成轮次的节点数
+	Finalized int
+	// 不同胜出提案的数量
+	Winners int
+	// 胜出最多的提案及选出它的节点比例
+	Leader    [32]byte
+	Agreement float64
+	// 节点收到本体的提案数的平均值
+	MeanProposals float64
+}
+
+// Result 模拟结果
+type Result struct {
+	Rounds []RoundResult
+	Net    NetStats
+	// 结束时各节点封禁的邻居数之和，通常由超出限流引起
+	Bans int
+	// 执行的事件数
+	Events int
+	// 模拟的虚拟时长，从第一个轮次开始到最后一个轮次结束
+	Duration time.Duration
+}
+
+// outcome 一个节点在一个轮次的结果
+type outcome struct {
+	winner    [32]byte
+	proposals int
+}
+
+// Simulator 进程内多节点模拟器
+// 全部节点运行在同一个虚拟时钟上，节点之间只通过内存网络上的连接通信
+type Simulator struct {
+	cfg      Config
+	clock    *Clock
+	network  *Network
+	graph    *topology.Graph
+	nodes    []*simNode
+	interval time.Duration
+	// 全部节点共用的签名校验缓存，每个签名只校验一次
+	verified *keys.VerifyCache
+	// 模拟的首末轮次
+	first int64
+	last  int64
+	// 区块输出目录，OutDir 为空时为临时目录
+	dataDir string
+	// 连接的生命周期，全部轮次结束后取消
+	connCtx     context.Context
+	cancelConns context.CancelFunc
+
+	lock sync.Mutex
+	// 轮次 | 各节点的结果
+	outcomes map[int64][]outcome
+}
+
+var _ models.RoundObserver = (*Simulator)(nil)
+
+// New 创建模拟器：生成拓扑与节点，并将拓扑中的邻居写入各节点的节点表
+func New(cfg Config) (*Simulator, error) {
+	if cfg.Nodes < 2 {
+		return nil, fmt.Errorf("nodes must >= 2")
+	}
+	if cfg.Rounds <= 0 {
+		return nil, fmt.Errorf("rounds must > 0")
+	}
+	interval := cfg.Node.Interval()
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval must > 0")
+	}
+	if cfg.Node.Consensus.DiffuseHop <= 0 {
+		return nil, fmt.Errorf("diffuse_hop must > 0")
+	}
+
+	gen, err := topology.New(cfg.Topology, cfg.Degree, cfg.TopologyOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// 消息处理函数与真实节点相同
+	p2p.Init(node.Node{})
+
+	first := cfg.FirstRound
+	if first <= 0 {
+		first = time.Now().UnixMilli()/interval.Milliseconds() + 1
+	}
+
+	s := &Simulator{
+		cfg:      cfg,
+		interval: interval,
+		first:    first,
+		last:     first + int64(cfg.Rounds) - 1,
+		verified: keys.NewVerifyCache(),
+		outcomes: make(map[int64][]outcome),
+	}
+	// 从前一轮开始，节点在第一个轮次开始前建立连接；前一轮的结果不计入
+	if s.clock, err = NewClock(s.roundStart(first - 1)); err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	s.network, err = NewNetwork(s.clock, s.roundStart(first), cfg.Link, cfg.Partitions, rng.Int63())
+	if err != nil {
+		return nil, err
+	}
+	s.graph = gen.Generate(cfg.Nodes, rng)
+
+	s.dataDir = cfg.OutDir
+	if s.dataDir == "" {
+		if s.dataDir, err = os.MkdirTemp("", "trustmesh-sim-"); err != nil {
+			return nil, err
+		}
+	}
+
+	s.connCtx, s.cancelConns = context.WithCancel(context.Background())
+	for i := 0; i < cfg.Nodes; i++ {
+		nodeCfg := cfg.Node
+		nodeCfg.DataDir = filepath.Join(s.dataDir, fmt.Sprintf("node-%d", i+1))
+
+		n, err := newSimNode(s, i, &nodeCfg, rng.Int63(), s.connCtx)
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		s.nodes = append(s.nodes, n)
+	}
+	for _, e := range s.graph.Edges() {
+		a, b := s.nodes[e[0]], s.nodes[e[1]]
+		if err := a.introduce(b); err != nil {
+			s.close()
+			return nil, err
+		}
+		if err := b.introduce(a); err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Run 运行全部轮次并汇总结果，输出目录不为空时同时写入拓扑快照
+// 最后一个轮次开始前停止开始新轮次，它在下一轮开始时结束，之后关闭全部连接
+func (s *Simulator) Run() (Result, error) {
+	defer s.close()
+
+	clientCtx, stopClients := context.WithCancel(context.Background())
+	defer stopClients()
+
+	var services, clients sync.WaitGroup
+	for _, n := range s.nodes {
+		n.start(s.connCtx, clientCtx, 2*s.interval, &services, &clients)
+	}
+	s.clock.At(s.roundStart(s.last).Add(-time.Millisecond), stopClients)
+
+	events := s.clock.Run(s.roundStart(s.last + 1))
+	end := s.clock.Now()
+	events += s.await(&clients)
+
+	s.cancelConns()
+	events += s.await(&services)
+
+	if s.cfg.OutDir != "" {
+		ids := make([][32]byte, len(s.nodes))
+		for i, n := range s.nodes {
+			ids[i] = n.id
+		}
+		path := filepath.Join(s.cfg.OutDir, "topology.json")
+		if err := topology.WriteSnapshot(path, s.cfg.Topology, ids, s.graph, topology.Analyze(s.graph)); err != nil {
+			return Result{}, err
+		}
+	}
+
+	out := Result{
+		Net:      s.network.Stats(),
+		Events:   events,
+		Duration: end.Sub(s.roundStart(s.first)),
+	}
+	for _, n := range s.nodes {
+		out.Bans += len(n.state.Bans.List())
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for round := s.first; round <= s.last; round++ {
+		out.Rounds = append(out.Rounds, summarize(round, s.outcomes[round]))
+	}
+
+	return out, nil
+}
+
+// await 推进虚拟时间直到 wg 中的协程全部退出，最多推进 awaitLimit 个轮次间隔，返回执行的事件数
+func (s *Simulator) await(wg *sync.WaitGroup) int {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	events := 0
+	deadline := s.clock.Now().Add(awaitLimit * s.interval)
+	for s.clock.Now().Before(deadline) {
+		select {
+		case <-done:
+			return events
+		default:
+		}
+		events += s.clock.Run(s.clock.Now().Add(s.interval / 10))
+	}
+
+	logger.Warning("Simulated nodes did not stop within %v", awaitLimit*s.interval)
+	return events
+}
+
+// close 关闭连接与各节点的节点表，删除临时的区块目录
+func (s *Simulator) close() {
+	s.cancelConns()
+
+	for _, n := range s.nodes {
+		if err := n.close(); err != nil {
+			logger.Warning("Close database of node %d error: %v", n.index+1, err)
+		}
+	}
+	s.nodes = nil
+
+	if s.cfg.OutDir == "" && s.dataDir != "" {
+		if err := os.RemoveAll(s.dataDir); err != nil {
+			logger.Warning("Remove %s error: %v", s.dataDir, err)
+		}
+		s.dataDir = ""
+	}
+}
+
+// roundStart 轮次的开始时间
+func (s *Simulator) roundStart(round int64) time.Time {
+	return time.UnixMilli(round * s.interval.Milliseconds())
+}
+
+// RoundFinished 记录节点在轮次中选出的提案，只记录模拟的轮次
+func (s *Simulator) RoundFinished(round int64, winner [32]byte, proposals int) {
+	if round < s.first || round > s.last {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.outcomes[round] = append(s.outcomes[round], outcome{winner: winner, proposals: proposals})
+}
+
+// summarize 汇总一个轮次中各节点的结果
+func summarize(round int64, outcomes []outcome) RoundResult {
+	out := RoundResult{Round: round, Finalized: len(outcomes)}
+	if len(outcomes) == 0 {
+		return out
+	}
+
+	votes := make(map[[32]byte]int)
+	total := 0
+	for _, o := range outcomes {
+		votes[o.winner]++
+		total += o.proposals
+	}
+
+	winners := make([][32]byte, 0, len(votes))
+	for w := range votes {
+		winners = append(winners, w)
+	}
+	sort.Slice(winners, func(i, j int) bool {
+		a, b := winners[i], winners[j]
+		if votes[a] != votes[b] {
+			return votes[a] > votes[b]
+		}
+		return string(a[:]) < string(b[:])
+	})
+
+	out.Winners = len(winners)
+	out.Leader = winners[0]
+	out.Agreement = float64(votes[winners[0]]) / float64(len(outcomes))
+	out.MeanProposals = float64(total) / float64(len(outcomes))
+
+	return out
+}
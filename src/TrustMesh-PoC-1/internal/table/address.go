@@ -0,0 +1,12 @@
+package table
+
+// PeerAddress 节点地址表，一个节点可以拥有多个地址
+type PeerAddress struct {
+	ID     uint64 `gorm:"primary_key"`
+	NodeID []byte `gorm:"uniqueIndex:idx_addr_node_id_addr;index;not null"`
+	// multiaddr 格式
+	Address     string `gorm:"uniqueIndex:idx_addr_node_id_addr;not null"`
+	LastSuccess uint64 `gorm:"not null"`
+	LastFailure uint64 `gorm:"not null"`
+	Failures    uint32 `gorm:"not null"`
+}
@@ -0,0 +1,15 @@
+package table
+
+// Ban 封禁表
+type Ban struct {
+	ID uint64 `gorm:"primary_key"`
+	// 封禁对象类型，node 或 ip
+	Kind string `gorm:"uniqueIndex:idx_ban_target;not null"`
+	// NodeId 或 16 字节 IP
+	Target []byte `gorm:"uniqueIndex:idx_ban_target;not null"`
+	// 解封时间（毫秒），0 表示永久
+	Until  uint64 `gorm:"not null;index"`
+	Reason string `gorm:"not null"`
+	// 封禁时间（毫秒）
+	Created uint64 `gorm:"not null"`
+}
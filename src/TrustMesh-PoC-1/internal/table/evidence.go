@@ -0,0 +1,15 @@
+package table
+
+// Evidence 双重签名证据表，每个违规者每轮每种类型只保留一条
+type Evidence struct {
+	ID uint64 `gorm:"primary_key"`
+	// 证据类型，proposal 或 rating
+	Kind string `gorm:"uniqueIndex:idx_evidence_target;not null"`
+	// 违规者 NodeId
+	NodeID []byte `gorm:"uniqueIndex:idx_evidence_target;not null"`
+	Round  int64  `gorm:"uniqueIndex:idx_evidence_target;not null"`
+	// 编码后的证据
+	Data []byte `gorm:"not null"`
+	// 接受时间（毫秒）
+	Created uint64 `gorm:"not null"`
+}
@@ -1,11 +1,12 @@
 package table
 
-// Peer 节点表
+// Peer 节点表，地址保存在地址表中
 type Peer struct {
 	ID         uint64 `gorm:"primary_key"`
-	NodeID     []byte `gorm:"uniqueIndex:idx_node_id;uniqueIndex:idx_node_id_addr;not null"`
-	Address    string `gorm:"uniqueIndex:idx_node_addr;uniqueIndex:idx_node_id_addr;not null"`
+	NodeID     []byte `gorm:"uniqueIndex:idx_node_id;not null"`
 	Reputation uint16 `gorm:"not null"`
-	LastSeen   uint64 `gorm:"not null;index"`
-	Status     string `gorm:"not null"`
+	// 双重签名证据累计的信誉惩罚，从信誉值中扣除
+	Penalty  uint16 `gorm:"not null;default:0"`
+	LastSeen uint64 `gorm:"not null;index"`
+	Status   string `gorm:"not null"`
 }
@@ -1,36 +1,26 @@
 package tools
 
 import (
+	"TrustMesh-PoC-1/internal/maddr"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
-	"time"
 )
 
-// WaitTimeout 阻塞指定时间，并在信号不阻塞时提前退出
-func WaitTimeout(done <-chan struct{}, d time.Duration) <-chan struct{} {
-	out := make(chan struct{})
-	timer := time.NewTimer(d)
-
-	go func() {
-		defer close(out)
-		defer timer.Stop()
-
-		select {
-		case <-done:
-			return
-		case <-timer.C:
-			return
-		}
-	}()
+// IsValidForDial 检查网络地址是否合法，支持 multiaddr 与 host:port 格式
+func IsValidForDial(addr string) bool {
+	a, err := maddr.Parse(addr)
+	if err != nil {
+		return false
+	}
 
-	return out
-}
+	// Unix 套接字只检查路径格式
+	if a.Network() == "unix" {
+		return true
+	}
 
-// IsValidForDial 检查网络地址是否合法
-func IsValidForDial(addr string) bool {
-	_, err := net.ResolveTCPAddr("tcp", addr)
+	_, err = net.ResolveTCPAddr("tcp", a.DialString())
 	return err == nil
 }
 
@@ -0,0 +1,233 @@
+package topology
+
+import "math/rand"
+
+// RandomRegular 随机正则图，每个节点度数为 D（配置模型，多次重试）
+type RandomRegular struct {
+	D int
+}
+
+// Name 名称
+func (RandomRegular) Name() string { return "random-regular" }
+
+// Generate 生成图
+func (t RandomRegular) Generate(n int, r *rand.Rand) *Graph {
+	d := min(t.D, n-1)
+	if n <= 1 || d <= 0 {
+		return NewGraph(n)
+	}
+
+	// 构造桩，n*d 为奇数时丢弃一个
+	stubs := make([]int, 0, n*d)
+	for i := 0; i < n; i++ {
+		for j := 0; j < d; j++ {
+			stubs = append(stubs, i)
+		}
+	}
+	if len(stubs)%2 == 1 {
+		stubs = stubs[:len(stubs)-1]
+	}
+
+	var best *Graph
+	for retry := 0; retry < 100; retry++ {
+		r.Shuffle(len(stubs), func(i, j int) { stubs[i], stubs[j] = stubs[j], stubs[i] })
+
+		g := NewGraph(n)
+		ok := true
+		for i := 0; i+1 < len(stubs); i += 2 {
+			if !g.AddEdge(stubs[i], stubs[i+1]) {
+				ok = false
+			}
+		}
+		if ok {
+			return g
+		}
+		// 重试失败时保留边数最多的一次
+		if best == nil || len(g.Edges()) > len(best.Edges()) {
+			best = g
+		}
+	}
+
+	return best
+}
+
+// ErdosRenyi G(n, p) 随机图，p = D / (n-1)，期望度数为 D
+type ErdosRenyi struct {
+	D int
+}
+
+// Name 名称
+func (ErdosRenyi) Name() string { return "erdos-renyi" }
+
+// Generate 生成图
+func (t ErdosRenyi) Generate(n int, r *rand.Rand) *Graph {
+	g := NewGraph(n)
+	if n <= 1 {
+		return g
+	}
+
+	p := float64(t.D) / float64(n-1)
+	for a := 0; a < n; a++ {
+		for b := a + 1; b < n; b++ {
+			if r.Float64() < p {
+				g.AddEdge(a, b)
+			}
+		}
+	}
+
+	return g
+}
+
+// SmallWorld Watts–Strogatz 小世界图，环形格子每侧 D/2 个邻居，以 Beta 概率重连
+type SmallWorld struct {
+	D    int
+	Beta float64
+}
+
+// Name 名称
+func (SmallWorld) Name() string { return "small-world" }
+
+// Generate 生成图
+func (t SmallWorld) Generate(n int, r *rand.Rand) *Graph {
+	g := Ring{D: t.D}.Generate(n, r)
+	if n <= 3 {
+		return g
+	}
+
+	half := max(1, t.D/2)
+	for a := 0; a < n; a++ {
+		for j := 1; j <= half; j++ {
+			b := (a + j) % n
+			if !g.HasEdge(a, b) || r.Float64() >= t.Beta {
+				continue
+			}
+
+			// 已与所有节点相连则跳过
+			if g.Degree(a) >= n-1 {
+				continue
+			}
+			for {
+				c := r.Intn(n)
+				if c != a && !g.HasEdge(a, c) {
+					g.RemoveEdge(a, b)
+					g.AddEdge(a, c)
+					break
+				}
+			}
+		}
+	}
+
+	return g
+}
+
+// ScaleFree Barabási–Albert 无标度图，每个新节点按度数优先连接 D/2 个已有节点，平均度数约为 D
+type ScaleFree struct {
+	D int
+}
+
+// Name 名称
+func (ScaleFree) Name() string { return "scale-free" }
+
+// Generate 生成图
+func (t ScaleFree) Generate(n int, r *rand.Rand) *Graph {
+	g := NewGraph(n)
+	m := max(1, min(t.D/2, n-1))
+	if n <= 1 {
+		return g
+	}
+
+	// 初始 m+1 个节点组成完全图
+	seed := min(m+1, n)
+	repeated := make([]int, 0, 2*m*n)
+	for a := 0; a < seed; a++ {
+		for b := a + 1; b < seed; b++ {
+			g.AddEdge(a, b)
+			repeated = append(repeated, a, b)
+		}
+	}
+
+	// 优先连接：repeated 中每个节点出现次数等于其度数
+	for a := seed; a < n; a++ {
+		// 按选中的顺序加边，map 只用于去重，保证同一随机源生成同一张图
+		chosen := make(map[int]struct{}, m)
+		targets := make([]int, 0, m)
+		for len(targets) < m {
+			b := repeated[r.Intn(len(repeated))]
+			if _, ok := chosen[b]; ok {
+				continue
+			}
+			chosen[b] = struct{}{}
+			targets = append(targets, b)
+		}
+		for _, b := range targets {
+			g.AddEdge(a, b)
+			repeated = append(repeated, a, b)
+		}
+	}
+
+	return g
+}
+
+// Ring 环形格子，每个节点与两侧各 D/2 个最近节点相连
+type Ring struct {
+	D int
+}
+
+// Name 名称
+func (Ring) Name() string { return "ring" }
+
+// Generate 生成图
+func (t Ring) Generate(n int, r *rand.Rand) *Graph {
+	g := NewGraph(n)
+	half := max(1, t.D/2)
+	for a := 0; a < n; a++ {
+		for j := 1; j <= half; j++ {
+			g.AddEdge(a, (a+j)%n)
+		}
+	}
+
+	return g
+}
+
+// Clustered 分簇图：节点均分为 Clusters 个簇，簇内为期望度数 D 的随机图，
+// 相邻簇之间以 Bridges 条随机边首尾相连
+type Clustered struct {
+	D        int
+	Clusters int
+	Bridges  int
+}
+
+// Name 名称
+func (Clustered) Name() string { return "clustered" }
+
+// Generate 生成图
+func (t Clustered) Generate(n int, r *rand.Rand) *Graph {
+	g := NewGraph(n)
+	c := max(1, min(t.Clusters, n))
+
+	// 按编号均分
+	members := make([][]int, c)
+	for i := 0; i < n; i++ {
+		members[i%c] = append(members[i%c], i)
+	}
+
+	// 簇内
+	for _, m := range members {
+		sub := ErdosRenyi{D: t.D}.Generate(len(m), r)
+		for _, e := range sub.Edges() {
+			g.AddEdge(m[e[0]], m[e[1]])
+		}
+	}
+
+	// 簇间
+	if c > 1 {
+		for i := 0; i < c; i++ {
+			a, b := members[i], members[(i+1)%c]
+			for j := 0; j < max(1, t.Bridges); j++ {
+				g.AddEdge(a[r.Intn(len(a))], b[r.Intn(len(b))])
+			}
+		}
+	}
+
+	return g
+}
@@ -0,0 +1,79 @@
+package topology
+
+import "sort"
+
+// Graph 无向简单图，节点以 0..N-1 编号
+type Graph struct {
+	N   int
+	adj []map[int]struct{}
+}
+
+// NewGraph 创建 n 个节点的空图
+func NewGraph(n int) *Graph {
+	g := &Graph{
+		N:   n,
+		adj: make([]map[int]struct{}, n),
+	}
+	for i := range g.adj {
+		g.adj[i] = make(map[int]struct{})
+	}
+
+	return g
+}
+
+// AddEdge 添加无向边，自环或重复边返回 false
+func (g *Graph) AddEdge(a int, b int) bool {
+	if a == b || a < 0 || b < 0 || a >= g.N || b >= g.N {
+		return false
+	}
+	if _, ok := g.adj[a][b]; ok {
+		return false
+	}
+
+	g.adj[a][b] = struct{}{}
+	g.adj[b][a] = struct{}{}
+
+	return true
+}
+
+// RemoveEdge 删除无向边
+func (g *Graph) RemoveEdge(a int, b int) {
+	delete(g.adj[a], b)
+	delete(g.adj[b], a)
+}
+
+// HasEdge 是否存在边
+func (g *Graph) HasEdge(a int, b int) bool {
+	_, ok := g.adj[a][b]
+	return ok
+}
+
+// Degree 节点度数
+func (g *Graph) Degree(i int) int {
+	return len(g.adj[i])
+}
+
+// Neighbours 节点的邻居，升序
+func (g *Graph) Neighbours(i int) []int {
+	out := make([]int, 0, len(g.adj[i]))
+	for k := range g.adj[i] {
+		out = append(out, k)
+	}
+	sort.Ints(out)
+
+	return out
+}
+
+// Edges 所有边，每条边只出现一次且 a < b
+func (g *Graph) Edges() [][2]int {
+	out := make([][2]int, 0)
+	for a := 0; a < g.N; a++ {
+		for _, b := range g.Neighbours(a) {
+			if a < b {
+				out = append(out, [2]int{a, b})
+			}
+		}
+	}
+
+	return out
+}
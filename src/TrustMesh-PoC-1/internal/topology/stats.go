@@ -0,0 +1,89 @@
+package topology
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Stats 图的度分布与连通性
+type Stats struct {
+	Nodes            int         `json:"nodes"`
+	Edges            int         `json:"edges"`
+	MinDegree        int         `json:"min_degree"`
+	MaxDegree        int         `json:"max_degree"`
+	MeanDegree       float64     `json:"mean_degree"`
+	DegreeHistogram  map[int]int `json:"degree_histogram"`
+	Components       int         `json:"components"`
+	LargestComponent int         `json:"largest_component"`
+	Connected        bool        `json:"connected"`
+}
+
+// Analyze 统计度分布与连通分量
+func Analyze(g *Graph) Stats {
+	s := Stats{
+		Nodes:           g.N,
+		DegreeHistogram: make(map[int]int),
+	}
+	if g.N == 0 {
+		return s
+	}
+
+	// 度分布
+	s.MinDegree = g.Degree(0)
+	total := 0
+	for i := 0; i < g.N; i++ {
+		d := g.Degree(i)
+		s.DegreeHistogram[d]++
+		total += d
+		s.MinDegree = min(s.MinDegree, d)
+		s.MaxDegree = max(s.MaxDegree, d)
+	}
+	s.Edges = total / 2
+	s.MeanDegree = float64(total) / float64(g.N)
+
+	// 连通分量（BFS）
+	visited := make([]bool, g.N)
+	for i := 0; i < g.N; i++ {
+		if visited[i] {
+			continue
+		}
+		s.Components++
+
+		size := 0
+		queue := []int{i}
+		visited[i] = true
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			size++
+			for next := range g.adj[cur] {
+				if !visited[next] {
+					visited[next] = true
+					queue = append(queue, next)
+				}
+			}
+		}
+		s.LargestComponent = max(s.LargestComponent, size)
+	}
+	s.Connected = s.Components == 1
+
+	return s
+}
+
+// String 单行摘要，用于日志
+func (s Stats) String() string {
+	degrees := make([]int, 0, len(s.DegreeHistogram))
+	for d := range s.DegreeHistogram {
+		degrees = append(degrees, d)
+	}
+	sort.Ints(degrees)
+
+	hist := make([]string, 0, len(degrees))
+	for _, d := range degrees {
+		hist = append(hist, fmt.Sprintf("%d:%d", d, s.DegreeHistogram[d]))
+	}
+
+	return fmt.Sprintf("nodes=%d edges=%d degree[min=%d max=%d mean=%.2f] components=%d largest=%d connected=%v histogram={%s}",
+		s.Nodes, s.Edges, s.MinDegree, s.MaxDegree, s.MeanDegree, s.Components, s.LargestComponent, s.Connected, strings.Join(hist, " "))
+}
@@ -0,0 +1,100 @@
+package topology
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Generator 拓扑生成器
+type Generator interface {
+	Name() string
+	Generate(n int, r *rand.Rand) *Graph
+}
+
+// Options 生成器附加参数
+type Options struct {
+	// Beta 小世界重连概率
+	Beta float64
+	// Clusters 分簇数量
+	Clusters int
+	// Bridges 相邻簇之间的边数
+	Bridges int
+}
+
+// New 根据名称创建生成器，degree 为目标（平均）度数
+func New(name string, degree int, opt Options) (Generator, error) {
+	if degree <= 0 {
+		return nil, fmt.Errorf("degree must > 0")
+	}
+
+	switch name {
+	case "random-regular":
+		return RandomRegular{D: degree}, nil
+	case "erdos-renyi":
+		return ErdosRenyi{D: degree}, nil
+	case "small-world":
+		if opt.Beta < 0 || opt.Beta > 1 {
+			return nil, fmt.Errorf("beta must be in [0, 1]")
+		}
+		return SmallWorld{D: degree, Beta: opt.Beta}, nil
+	case "scale-free":
+		return ScaleFree{D: degree}, nil
+	case "ring":
+		return Ring{D: degree}, nil
+	case "clustered":
+		if opt.Clusters <= 0 {
+			return nil, fmt.Errorf("clusters must > 0")
+		}
+		return Clustered{D: degree, Clusters: opt.Clusters, Bridges: opt.Bridges}, nil
+	default:
+		return nil, fmt.Errorf("unknown topology %s", name)
+	}
+}
+
+// Snapshot 一次生成结果，用于离线分析拓扑与胜者涌现的关系
+type Snapshot struct {
+	Topology  string      `json:"topology"`
+	Generated string      `json:"generated"`
+	Stats     Stats       `json:"stats"`
+	Nodes     []string    `json:"nodes"`
+	Edges     [][2]string `json:"edges"`
+}
+
+// WriteSnapshot 将生成结果写入 JSON 文件，ids[i] 为图中节点 i 对应的 NodeId
+func WriteSnapshot(path string, name string, ids [][32]byte, g *Graph, stats Stats) error {
+	snap := Snapshot{
+		Topology:  name,
+		Generated: time.Now().UTC().Format(time.RFC3339),
+		Stats:     stats,
+		Nodes:     make([]string, 0, len(ids)),
+	}
+	for _, id := range ids {
+		snap.Nodes = append(snap.Nodes, hex.EncodeToString(id[:]))
+	}
+	for _, e := range g.Edges() {
+		snap.Edges = append(snap.Edges, [2]string{snap.Nodes[e[0]], snap.Nodes[e[1]]})
+	}
+
+	// 序列化
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json marshal failed: %w", err)
+	}
+
+	// 确保目录存在
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("mkdir failed: %w", err)
+	}
+
+	// 写入文件
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+
+	return nil
+}
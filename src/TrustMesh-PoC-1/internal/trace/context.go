@@ -0,0 +1,66 @@
+package trace
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// 追踪上下文标志
+const (
+	// flagNone 不带追踪上下文
+	flagNone byte = 0x00
+	// flagTraced 带追踪上下文
+	flagTraced byte = 0x01
+)
+
+// ContextSize 追踪上下文长度：[2]跳数 + [32]发送方 NodeId + [8]发送时间
+const ContextSize = 2 + 32 + 8
+
+// Context 提案传播的追踪上下文，追踪 ID 即 pHash
+// 上下文不在签名范围内，只用于诊断
+type Context struct {
+	// 接收方所在跳数，提案发起者为 0
+	Hop uint16
+	// 发送方 NodeId
+	Sender [32]byte
+	// 发送时间（毫秒）
+	SentAt uint64
+}
+
+// AppendContext 写入 [1]标志，tc 不为 nil 时再写入上下文
+func AppendContext(b []byte, tc *Context) []byte {
+	if tc == nil {
+		return append(b, flagNone)
+	}
+
+	b = append(b, flagTraced)
+	b = binary.BigEndian.AppendUint16(b, tc.Hop)
+	b = append(b, tc.Sender[:]...)
+	b = binary.BigEndian.AppendUint64(b, tc.SentAt)
+
+	return b
+}
+
+// SplitContext 拆出消息开头的追踪上下文，未带上下文时返回 nil
+func SplitContext(b []byte) (*Context, []byte, error) {
+	if len(b) < 1 {
+		return nil, nil, errors.New("trace flag missing")
+	}
+
+	switch b[0] {
+	case flagNone:
+		return nil, b[1:], nil
+	case flagTraced:
+		if len(b) < 1+ContextSize {
+			return nil, nil, errors.New("trace context too short")
+		}
+		tc := &Context{
+			Hop:    binary.BigEndian.Uint16(b[1:3]),
+			SentAt: binary.BigEndian.Uint64(b[35:43]),
+		}
+		copy(tc.Sender[:], b[3:35])
+		return tc, b[1+ContextSize:], nil
+	default:
+		return nil, nil, errors.New("unknown trace flag")
+	}
+}
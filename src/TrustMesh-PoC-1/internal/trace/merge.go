@@ -0,0 +1,253 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// maxLineSize 追踪文件单行上限
+const maxLineSize = 1 << 20
+
+// Hop 传播树中的一个节点
+type Hop struct {
+	// 节点 NodeId（十六进制）
+	Node string
+	// 发送方 NodeId，根节点为空
+	Sender string
+	// 跳数
+	Hop int64
+	// 首次收到的消息类型，根节点为空
+	Message string
+	// 发送时间（发送方时钟）
+	SentAt time.Time
+	// 收到（或发起）时间（本节点时钟）
+	At time.Time
+	// 重复收到的次数
+	Duplicates int
+	// 下一跳
+	Children []*Hop
+}
+
+// Latency 本跳延迟，跨节点计算，受时钟偏差影响
+func (h *Hop) Latency() time.Duration {
+	return h.At.Sub(h.SentAt)
+}
+
+// Tree 一个提案的传播树
+type Tree struct {
+	Round int64
+	PHash string
+	// 发起节点，未提供发起者的追踪文件时为 nil
+	Root *Hop
+	// 父节点不在追踪文件中的节点
+	Orphans []*Hop
+	// 收到提案的节点数，包括发起者
+	Nodes int
+}
+
+// HopStats 某一跳数的延迟统计
+type HopStats struct {
+	Hop   int64
+	Count int
+	Avg   time.Duration
+	Max   time.Duration
+}
+
+// ReadFiles 读取多个节点的追踪文件
+func ReadFiles(paths ...string) ([]Span, error) {
+	out := make([]Span, 0)
+	for _, path := range paths {
+		spans, err := readFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		out = append(out, spans...)
+	}
+
+	return out, nil
+}
+
+// readFile 读取一个追踪文件，每行一个 ExportTraceServiceRequest
+func readFile(path string) ([]Span, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	out := make([]Span, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var req exportRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				out = append(out, ss.Spans...)
+			}
+		}
+	}
+
+	return out, scanner.Err()
+}
+
+// Rounds 追踪中出现的轮次，升序
+func Rounds(spans []Span) []int64 {
+	seen := make(map[int64]struct{})
+	for _, s := range spans {
+		seen[s.Int(AttrRound)] = struct{}{}
+	}
+
+	out := make([]int64, 0, len(seen))
+	for r := range seen {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+
+	return out
+}
+
+// Merge 重建一个轮次中每个提案的传播树，按节点数降序
+func Merge(spans []Span, round int64) []*Tree {
+	byPHash := make(map[string][]Span)
+	for _, s := range spans {
+		if s.Int(AttrRound) != round {
+			continue
+		}
+		pHash := s.String(AttrPHash)
+		byPHash[pHash] = append(byPHash[pHash], s)
+	}
+
+	out := make([]*Tree, 0, len(byPHash))
+	for pHash, list := range byPHash {
+		out = append(out, buildTree(round, pHash, list))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Nodes != out[j].Nodes {
+			return out[i].Nodes > out[j].Nodes
+		}
+		return out[i].PHash < out[j].PHash
+	})
+
+	return out
+}
+
+// buildTree 由同一提案的 Span 构建传播树
+func buildTree(round int64, pHash string, spans []Span) *Tree {
+	tree := &Tree{Round: round, PHash: pHash}
+
+	// 发起与首次收到的 Span 各代表一个节点
+	hops := make(map[string]*Hop)
+	parents := make(map[string]string)
+	order := make([]string, 0)
+	for _, s := range spans {
+		if s.Name != SpanPublish && s.Name != SpanReceive {
+			continue
+		}
+		if _, ok := hops[s.SpanId]; ok {
+			continue
+		}
+		hops[s.SpanId] = &Hop{
+			Node:    s.String(AttrNode),
+			Sender:  s.String(AttrSender),
+			Hop:     s.Int(AttrHop),
+			Message: s.String(AttrMessage),
+			SentAt:  s.Start(),
+			At:      s.End(),
+		}
+		parents[s.SpanId] = s.ParentSpanId
+		order = append(order, s.SpanId)
+	}
+
+	// 重复收到计入接收节点
+	byNode := make(map[string]*Hop, len(hops))
+	for _, h := range hops {
+		byNode[h.Node] = h
+	}
+	for _, s := range spans {
+		if s.Name != SpanDuplicate {
+			continue
+		}
+		if h, ok := byNode[s.String(AttrNode)]; ok {
+			h.Duplicates++
+		}
+	}
+
+	for _, id := range order {
+		h := hops[id]
+		parent := parents[id]
+		switch {
+		case parent == "":
+			if tree.Root == nil {
+				tree.Root = h
+			} else {
+				tree.Orphans = append(tree.Orphans, h)
+			}
+		case hops[parent] != nil:
+			hops[parent].Children = append(hops[parent].Children, h)
+		default:
+			tree.Orphans = append(tree.Orphans, h)
+		}
+	}
+
+	for _, h := range hops {
+		sort.Slice(h.Children, func(i, j int) bool { return h.Children[i].At.Before(h.Children[j].At) })
+	}
+	sort.Slice(tree.Orphans, func(i, j int) bool { return tree.Orphans[i].At.Before(tree.Orphans[j].At) })
+	tree.Nodes = len(hops)
+
+	return tree
+}
+
+// Stats 按跳数统计延迟，不包括根节点
+func (t *Tree) Stats() []HopStats {
+	byHop := make(map[int64]*HopStats)
+	var walk func(h *Hop, root bool)
+	walk = func(h *Hop, root bool) {
+		if !root {
+			s, ok := byHop[h.Hop]
+			if !ok {
+				s = &HopStats{Hop: h.Hop}
+				byHop[h.Hop] = s
+			}
+			latency := h.Latency()
+			s.Count++
+			s.Avg += latency
+			if s.Count == 1 || latency > s.Max {
+				s.Max = latency
+			}
+		}
+		for _, c := range h.Children {
+			walk(c, false)
+		}
+	}
+	if t.Root != nil {
+		walk(t.Root, true)
+	}
+	for _, o := range t.Orphans {
+		walk(o, o.Sender == "")
+	}
+
+	out := make([]HopStats, 0, len(byHop))
+	for _, s := range byHop {
+		s.Avg /= time.Duration(s.Count)
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Hop < out[j].Hop })
+
+	return out
+}
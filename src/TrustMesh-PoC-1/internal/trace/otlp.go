@@ -0,0 +1,166 @@
+package trace
+
+import (
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+// 以下结构对应 OTLP/JSON（ExportTraceServiceRequest），每行一个请求
+// 可直接被 OpenTelemetry Collector 的 otlpjsonfile 接收器读取
+
+// ServiceName 资源属性 service.name
+const ServiceName = "trustmesh"
+
+// scopeName 插桩范围名称
+const scopeName = "TrustMesh-PoC-1/internal/trace"
+
+// OTLP SpanKind
+const (
+	spanKindProducer = 4
+	spanKindConsumer = 5
+)
+
+// Span 名称
+const (
+	// SpanPublish 发起提案
+	SpanPublish = "proposal.publish"
+	// SpanReceive 首次收到提案，构成传播树的一条边
+	SpanReceive = "proposal.receive"
+	// SpanDuplicate 重复收到提案
+	SpanDuplicate = "proposal.duplicate"
+)
+
+// 属性名称
+const (
+	AttrRound   = "trustmesh.round"
+	AttrPHash   = "trustmesh.phash"
+	AttrHop     = "trustmesh.hop"
+	AttrNode    = "trustmesh.node"
+	AttrSender  = "trustmesh.sender"
+	AttrMessage = "trustmesh.message"
+)
+
+// 消息类型
+const (
+	MessageBody = "body"
+	MessageSig  = "sig"
+)
+
+// exportRequest ExportTraceServiceRequest
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+// resourceSpans 一个节点的 Span
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+// resource 资源
+type resource struct {
+	Attributes []KeyValue `json:"attributes"`
+}
+
+// scopeSpans 一个插桩范围的 Span
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []Span `json:"spans"`
+}
+
+// scope 插桩范围
+type scope struct {
+	Name string `json:"name"`
+}
+
+// Span OTLP Span
+type Span struct {
+	TraceId           string     `json:"traceId"`
+	SpanId            string     `json:"spanId"`
+	ParentSpanId      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []KeyValue `json:"attributes"`
+}
+
+// KeyValue 属性
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue 属性值，int64 按 OTLP/JSON 规定以字符串表示
+type AnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+// stringAttr 字符串属性
+func stringAttr(key string, value string) KeyValue {
+	return KeyValue{Key: key, Value: AnyValue{StringValue: &value}}
+}
+
+// intAttr 整数属性
+func intAttr(key string, value int64) KeyValue {
+	s := strconv.FormatInt(value, 10)
+	return KeyValue{Key: key, Value: AnyValue{IntValue: &s}}
+}
+
+// String 字符串属性值
+func (s Span) String(key string) string {
+	for _, a := range s.Attributes {
+		if a.Key == key && a.Value.StringValue != nil {
+			return *a.Value.StringValue
+		}
+	}
+	return ""
+}
+
+// Int 整数属性值
+func (s Span) Int(key string) int64 {
+	for _, a := range s.Attributes {
+		if a.Key == key && a.Value.IntValue != nil {
+			v, _ := strconv.ParseInt(*a.Value.IntValue, 10, 64)
+			return v
+		}
+	}
+	return 0
+}
+
+// Start 开始时间
+func (s Span) Start() time.Time {
+	ns, _ := strconv.ParseInt(s.StartTimeUnixNano, 10, 64)
+	return time.Unix(0, ns)
+}
+
+// End 结束时间
+func (s Span) End() time.Time {
+	ns, _ := strconv.ParseInt(s.EndTimeUnixNano, 10, 64)
+	return time.Unix(0, ns)
+}
+
+// unixNano 时间的纳秒字符串
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// traceId OTLP traceId 为 16 字节，取 pHash 前 16 字节，完整 pHash 保存在属性中
+func traceId(pHash [32]byte) string {
+	return hex.EncodeToString(pHash[:16])
+}
+
+// nodeSpanId 节点首次收到（或发起）提案的 Span ID，由 pHash 与 NodeId 决定
+// 接收方据此从发送方 NodeId 得到父 Span，无需在消息中携带 Span ID
+func nodeSpanId(pHash [32]byte, nodeId [32]byte) string {
+	data := make([]byte, 0, 64)
+	data = append(data, pHash[:]...)
+	data = append(data, nodeId[:]...)
+	sum := blake3.Sum256(data)
+
+	return hex.EncodeToString(sum[:8])
+}
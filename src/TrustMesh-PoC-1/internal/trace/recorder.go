@@ -0,0 +1,214 @@
+package trace
+
+import (
+	"TrustMesh-PoC-1/internal/logger"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Recorder 将提案传播事件写入本地追踪文件
+// nil 表示未开启追踪，所有方法均可在 nil 上调用
+type Recorder struct {
+	nodeId [32]byte
+	// resource 本节点的资源属性
+	resource resource
+
+	lock sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+	// proposals 本节点见过的提案
+	proposals map[int64]map[[32]byte]*proposal
+}
+
+// proposal 本节点对一个提案的记录
+type proposal struct {
+	// 首次收到时所在跳数
+	hop uint16
+	// 已记录的投递，提案本体与签名集共用同一追踪上下文，只记录一次
+	deliveries map[delivery]struct{}
+}
+
+// delivery 一次投递
+type delivery struct {
+	sender [32]byte
+	sentAt uint64
+}
+
+// Open 以追加方式打开追踪文件
+func Open(path string, nodeId [32]byte) (*Recorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o0755); err != nil {
+		return nil, fmt.Errorf("cannot create trace directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open trace file: %w", err)
+	}
+
+	return &Recorder{
+		nodeId: nodeId,
+		resource: resource{Attributes: []KeyValue{
+			stringAttr("service.name", ServiceName),
+			stringAttr("service.instance.id", hex.EncodeToString(nodeId[:])),
+		}},
+		file:      file,
+		enc:       json.NewEncoder(file),
+		proposals: make(map[int64]map[[32]byte]*proposal),
+	}, nil
+}
+
+// Close 关闭追踪文件
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.file.Close()
+}
+
+// Publish 记录本节点发起的提案，作为传播树的根
+func (r *Recorder) Publish(round int64, pHash [32]byte) {
+	if r == nil {
+		return
+	}
+
+	now := time.Now()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.add(round, pHash, 0)
+	r.write(Span{
+		TraceId:           traceId(pHash),
+		SpanId:            nodeSpanId(pHash, r.nodeId),
+		Name:              SpanPublish,
+		Kind:              spanKindProducer,
+		StartTimeUnixNano: unixNano(now),
+		EndTimeUnixNano:   unixNano(now),
+		Attributes:        r.attrs(round, pHash, 0),
+	})
+}
+
+// Receive 记录收到的提案消息，首次收到时成为发送方的子节点，之后记为重复
+// 同一次投递的后续消息与未带追踪上下文的消息不记录
+func (r *Recorder) Receive(round int64, pHash [32]byte, message string, tc *Context) {
+	if r == nil || tc == nil {
+		return
+	}
+
+	now := time.Now()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	name := SpanReceive
+	spanId := nodeSpanId(pHash, r.nodeId)
+	p, seen := r.proposals[round][pHash]
+	if seen {
+		name = SpanDuplicate
+		var id [8]byte
+		_, _ = rand.Read(id[:])
+		spanId = hex.EncodeToString(id[:])
+	} else {
+		p = r.add(round, pHash, tc.Hop)
+	}
+
+	d := delivery{sender: tc.Sender, sentAt: tc.SentAt}
+	if _, ok := p.deliveries[d]; ok {
+		return
+	}
+	p.deliveries[d] = struct{}{}
+
+	attrs := r.attrs(round, pHash, tc.Hop)
+	attrs = append(attrs,
+		stringAttr(AttrSender, hex.EncodeToString(tc.Sender[:])),
+		stringAttr(AttrMessage, message),
+	)
+
+	r.write(Span{
+		TraceId:           traceId(pHash),
+		SpanId:            spanId,
+		ParentSpanId:      nodeSpanId(pHash, tc.Sender),
+		Name:              name,
+		Kind:              spanKindConsumer,
+		StartTimeUnixNano: unixNano(time.UnixMilli(int64(tc.SentAt))),
+		EndTimeUnixNano:   unixNano(now),
+		Attributes:        attrs,
+	})
+}
+
+// Outgoing 一次投递携带的追踪上下文，同一次投递的提案本体与签名集共用，未开启追踪时为 nil
+// 本节点未从带上下文的消息中收到过该提案时按跳数 0 处理
+func (r *Recorder) Outgoing(round int64, pHash [32]byte) *Context {
+	if r == nil {
+		return nil
+	}
+
+	var hop uint16
+	r.lock.Lock()
+	if p, ok := r.proposals[round][pHash]; ok {
+		hop = p.hop
+	}
+	r.lock.Unlock()
+
+	return &Context{
+		Hop:    hop + 1,
+		Sender: r.nodeId,
+		SentAt: uint64(time.Now().UnixMilli()),
+	}
+}
+
+// Forget 删除轮次记录
+func (r *Recorder) Forget(round int64) {
+	if r == nil {
+		return
+	}
+
+	r.lock.Lock()
+	delete(r.proposals, round)
+	r.lock.Unlock()
+}
+
+// add 记录首次见到的提案，调用方持有 lock
+func (r *Recorder) add(round int64, pHash [32]byte, hop uint16) *proposal {
+	if _, ok := r.proposals[round]; !ok {
+		r.proposals[round] = make(map[[32]byte]*proposal)
+	}
+	p := &proposal{hop: hop, deliveries: make(map[delivery]struct{})}
+	r.proposals[round][pHash] = p
+
+	return p
+}
+
+// attrs 公共属性
+func (r *Recorder) attrs(round int64, pHash [32]byte, hop uint16) []KeyValue {
+	return []KeyValue{
+		intAttr(AttrRound, round),
+		stringAttr(AttrPHash, hex.EncodeToString(pHash[:])),
+		intAttr(AttrHop, int64(hop)),
+		stringAttr(AttrNode, hex.EncodeToString(r.nodeId[:])),
+	}
+}
+
+// write 写入一行，调用方持有 lock
+func (r *Recorder) write(span Span) {
+	req := exportRequest{ResourceSpans: []resourceSpans{{
+		Resource: r.resource,
+		ScopeSpans: []scopeSpans{{
+			Scope: scope{Name: scopeName},
+			Spans: []Span{span},
+		}},
+	}}}
+
+	if err := r.enc.Encode(req); err != nil {
+		logger.Warning("Write trace failed: %v", err)
+	}
+}
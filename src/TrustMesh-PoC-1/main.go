@@ -1,114 +1,110 @@
 package main
 
 import (
-	"TrustMesh-PoC-1/internal/db"
-	"TrustMesh-PoC-1/internal/keys"
 	"TrustMesh-PoC-1/internal/logger"
-	"TrustMesh-PoC-1/internal/models"
-	"TrustMesh-PoC-1/internal/network"
-	"TrustMesh-PoC-1/internal/node"
-	"TrustMesh-PoC-1/internal/p2p"
-	"TrustMesh-PoC-1/internal/tools"
+	"flag"
+	"fmt"
 	"os"
-	"sync"
-	"time"
-
-	"github.com/zeebo/blake3"
+	"strings"
 )
 
-func main() {
-	// *唯一* 启动/关闭 提示
-	logger.Info("TrustMesh PoC Started")
-	defer logger.Info("TrustMesh PoC Stopped")
+// usage 总体帮助
+const usage = `Usage: trustmesh <command> [flags]
+
+Commands:
+  node       run a node
+  bootstrap  run a bootstrap node
+  keygen     generate the node key
+  id         print the NodeId of the node key
+  rotate     replace the node key, announced to peers by the old key
+  signer     serve the node key to a node over a unix socket
+  peers      list peers in the database
+  verify     verify block files
+  trace      merge trace files into proposal propagation trees
+  replay     replay consensus journals through the state machine
+  sim        simulate many nodes in one process on virtual time
+
+Run 'trustmesh <command> -h' for the flags of a command.
+Without a command, INSTANCE_ID "0" runs a bootstrap node and anything else runs a node (legacy).
+`
+
+// descriptions 子命令说明
+var descriptions = map[string]string{
+	"node":      "Run a node: join the network through the bootstrap nodes, DHT and PEX, and take part in consensus rounds.",
+	"bootstrap": "Run a bootstrap node: answer node reports with signed neighbour lists.",
+	"keygen":    "Generate the node key in the data directory, encrypted when a passphrase is given. An existing key is kept unless -force is given.",
+	"id":        "Print the public key and NodeId of the node key in the data directory.",
+	"peers":     "List the peers stored in the database, optionally with every known address and its dial stats.",
+	"rotate":    "Replace the node key. The old key signs a statement naming the new key, which the node sends to every peer it connects to for 30 days so they move their records to the new NodeId. Stop the node first.",
+	"signer":    "Run an external signer: load the node key once and answer sign requests on a unix socket. Point a node at it with KEY_SIGNER so the node never reads the seed file.",
+	"trace":     "Merge the trace files of several nodes (written with TRACE=true) and print the propagation tree and per-hop latency of every proposal in a round. Without arguments <data-dir>/trace.jsonl is read. Latency is measured across node clocks.",
+	"replay":    "Replay consensus journals (written with TRACE_JOURNAL) through a fresh state machine and check that every step produces the recorded actions. Without arguments all files in <data-dir>/journal are checked.",
+	"sim":       "Simulate a network of nodes in one process. Nodes run the real connection manager, handshake, rate limits and round executor over in-memory connections with the given latency, loss and partitions, on a virtual clock, and write block/<round>.json like real nodes. The peer table of every node holds its neighbours in the generated topology.",
+	"verify":    "Verify the format and proposer signature of block files. Without arguments all files in <data-dir>/block are checked.",
+}
 
-	_, pk, err := keys.LoadOrCreateKey()
-	if err != nil {
-		logger.Error("Error loading keys: %v", err)
-	} else {
-		logger.Info("My NodeId: %v", blake3.Sum256(pk[:]))
+func main() {
+	// 旧用法：不带子命令
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		exit(runServer("", os.Args[1:]))
+		return
 	}
 
-	// 退出信号
-	quit := make(chan struct{})
-	var quitOnce sync.Once
-
-	defer quitOnce.Do(func() { close(quit) })
+	name, args := os.Args[1], os.Args[2:]
+	switch name {
+	case "node", "bootstrap":
+		exit(runServer(name, args))
+	case "keygen":
+		exit(runKeygen(args))
+	case "id":
+		exit(runId(args))
+	case "rotate":
+		exit(runRotate(args))
+	case "signer":
+		exit(runSigner(args))
+	case "peers":
+		exit(runPeers(args))
+	case "verify":
+		exit(runVerify(args))
+	case "trace":
+		exit(runTrace(args))
+	case "replay":
+		exit(runReplay(args))
+	case "sim":
+		exit(runSim(args))
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", name, usage)
+		os.Exit(2)
+	}
+}
 
-	flag, err := tools.EnsureFilePath(db.Path())
+// exit 出错时输出错误并以非零状态退出
+func exit(err error) {
 	if err != nil {
-		logger.Fatal("Database path error: %v", err)
-		return
+		logger.Error("%v", err)
+		os.Exit(1)
 	}
+}
 
-	// 初始化数据库
-	if _, err := db.InitDB(); err != nil {
-		logger.Fatal("Error connecting to database: %v", err)
-		return
+// commandName 子命令全名
+func commandName(name string) string {
+	if name == "" {
+		return "trustmesh"
 	}
+	return "trustmesh " + name
+}
 
-	// 初始化 P2P
-	p2p.Init(node.Node{})
-
-	// 创建主存储变量
-	var mainState models.MainStore
-	mainState.Init()
-
-	// 启动服务
-	if id, exist := os.LookupEnv("INSTANCE_ID"); !exist {
-		logger.Fatal("INSTANCE_ID not set")
-		return
-	} else if id == "0" {
-		logger.Info("Start Bootstrap Server")
-
-		// 启动引导节点服务
-		go func() {
-			if err := network.StartBootstrapServer(&mainState); err != nil {
-				logger.Fatal("Error starting bootstrap server")
-			}
-			time.Sleep(5 * time.Second)
-			quitOnce.Do(func() { close(quit) })
-		}()
-	} else {
-		logger.Info("Start node Server")
-
-		start := make(chan struct{})
-
-		// 请求节点列表
-		if !flag {
-			go func() {
-				time.Sleep(1 * time.Second)
-				logger.Info("Start Request List")
-				if err := network.StartRequestList(&mainState); err != nil {
-					logger.Error(err.Error())
-					return
-				}
-			}()
-		} else {
-			close(start)
+// usageFor 子命令帮助
+func usageFor(fs *flag.FlagSet, name string) func() {
+	return func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: %s [flags]\n\n", commandName(name))
+		if desc, ok := descriptions[name]; ok {
+			fmt.Fprintf(out, "%s\n\n", desc)
 		}
-
-		// 启动服务端服务
-		go func() {
-			if err := network.StartNodeServer(&mainState); err != nil {
-				logger.Fatal("Error starting node server")
-				return
-			}
-		}()
-
-		// 开始前阻塞
-		<-start
-
-		// 启动客户端服务
-		go func() {
-			if err := network.StartNodeClient(&mainState); err != nil {
-				logger.Fatal("Error starting node client: %v", err)
-			}
-		}()
-	}
-
-	// 监听退出信号
-	select {
-	case <-quit:
-		return
+		fmt.Fprintln(out, "Flags:")
+		fs.PrintDefaults()
 	}
 }
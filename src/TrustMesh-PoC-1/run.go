@@ -0,0 +1,326 @@
+package main
+
+import (
+	"TrustMesh-PoC-1/internal/admin"
+	"TrustMesh-PoC-1/internal/clock"
+	"TrustMesh-PoC-1/internal/config"
+	"TrustMesh-PoC-1/internal/connmgr"
+	"TrustMesh-PoC-1/internal/consensus"
+	"TrustMesh-PoC-1/internal/db"
+	"TrustMesh-PoC-1/internal/keys"
+	"TrustMesh-PoC-1/internal/logger"
+	"TrustMesh-PoC-1/internal/metrics"
+	"TrustMesh-PoC-1/internal/models"
+	"TrustMesh-PoC-1/internal/network"
+	"TrustMesh-PoC-1/internal/node"
+	"TrustMesh-PoC-1/internal/p2p"
+	"TrustMesh-PoC-1/internal/tools"
+	"TrustMesh-PoC-1/internal/trace"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/zeebo/blake3"
+)
+
+// runServer 以节点或引导节点模式运行，mode 为空时按 INSTANCE_ID 决定（旧用法）
+func runServer(mode string, args []string) error {
+	// 读取配置
+	fs := flag.NewFlagSet(commandName(mode), flag.ExitOnError)
+	cfgFlags := config.RegisterFlags(fs)
+	fs.Usage = usageFor(fs, mode)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := cfgFlags.Load(mode)
+	if err != nil {
+		return err
+	}
+	logOpts, err := cfg.LogOptions()
+	if err != nil {
+		return err
+	}
+	if err := logger.Configure(logOpts); err != nil {
+		return err
+	}
+	keys.SetDir(cfg.DataDir)
+
+	// *唯一* 启动/关闭 提示
+	logger.Info("TrustMesh PoC Started")
+	defer logger.Info("TrustMesh PoC Stopped")
+
+	// 签名服务，私钥只加载一次
+	signer, err := openSigner(cfg)
+	if err != nil {
+		return fmt.Errorf("error loading keys: %w", err)
+	}
+	defer func() {
+		_ = signer.Close()
+	}()
+
+	pk := signer.PublicKey()
+	logger.Info("My NodeId: %v", blake3.Sum256(pk))
+	if r, ok := keys.CurrentRotation(pk); ok {
+		logger.Info("Key rotated from %v, announcing to peers", blake3.Sum256(r.Old[:]))
+	}
+	myNodeId := blake3.Sum256(pk)
+
+	// 退出信号，SIGINT/SIGTERM 或任一服务出错时取消
+	sigCtx, stopSignal := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignal()
+	ctx, cancel := context.WithCancel(sigCtx)
+	defer cancel()
+
+	// SIGHUP 时重新读取配置中的日志级别
+	go reloadLogLevels(ctx, cfgFlags, mode)
+
+	// 关闭期限
+	shutdownTimeout := cfg.ShutdownTimeout()
+
+	dbExists, err := tools.EnsureFilePath(db.Path(cfg.DataDir))
+	if err != nil {
+		return fmt.Errorf("database path error: %w", err)
+	}
+
+	// 初始化数据库
+	database, err := db.InitDB(cfg.DataDir)
+	if err != nil {
+		return fmt.Errorf("error connecting to database: %w", err)
+	}
+
+	// 初始化 P2P
+	p2p.Init(node.Node{})
+
+	// 创建主存储变量
+	var mainState models.MainStore
+	mainState.Init(cfg, clock.System)
+	mainState.Signer = signer
+	mainState.DB = database
+	mainState.Sender = consensus.NewSender(&mainState)
+
+	// 封禁表
+	bans, err := p2p.LoadBans(&mainState)
+	if err != nil {
+		return err
+	}
+	if bans > 0 {
+		logger.Info("Loaded %d bans", bans)
+	}
+
+	// 连接管理器，连接在写队列清空后才关闭，因此不随 ctx 取消
+	connCtx, cancelConns := context.WithCancel(context.Background())
+	defer cancelConns()
+	connManager := connmgr.New(connCtx, &mainState, connmgr.DefaultOptions())
+	mainState.ConnManager = connManager
+
+	// DHT 路由表
+	mainState.RoutingTable = models.NewRoutingTable(myNodeId)
+
+	// 提案传播追踪
+	if cfg.Trace.Enabled && !cfg.IsBootstrap() {
+		tracer, err := trace.Open(cfg.TraceFile(), myNodeId)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = tracer.Close()
+		}()
+		mainState.Tracer = tracer
+		logger.Info("Tracing proposals to %s", cfg.TraceFile())
+	}
+
+	// 指标
+	metrics.Register(&mainState)
+	if cfg.Metrics.Addr != "" {
+		go func() {
+			if err := metrics.Serve(ctx, cfg.Metrics.Addr); err != nil {
+				logger.Error("Error serving metrics: %v", err)
+			}
+		}()
+	}
+
+	// 管理接口
+	if cfg.Admin.Addr != "" {
+		go func() {
+			if err := admin.Serve(ctx, cfg.Admin.Addr, cfg.Admin.Token, &mainState); err != nil {
+				logger.Error("Error serving admin api: %v", err)
+			}
+		}()
+	}
+
+	// 需要在关闭时等待的服务
+	var wg sync.WaitGroup
+
+	// 启动服务
+	if cfg.IsBootstrap() {
+		logger.Info("Start Bootstrap Server")
+
+		// 启动引导节点服务
+		go func() {
+			if err := network.StartBootstrapServer(ctx, &mainState); err != nil {
+				logger.Error("Error starting bootstrap server: %v", err)
+			}
+			cancel()
+		}()
+	} else {
+		logger.Info("Start node Server")
+
+		start := make(chan struct{})
+
+		// 请求节点列表
+		if !dbExists {
+			go func() {
+				time.Sleep(1 * time.Second)
+				logger.Info("Start Request List")
+				if err := network.StartRequestList(ctx, &mainState); err != nil {
+					logger.Error("%v", err)
+					return
+				}
+			}()
+		} else {
+			close(start)
+
+			// 定期汇报以保持在引导节点中存活
+			if len(cfg.Bootstrap.Addrs) > 0 {
+				go func() {
+					if err := network.StartRequestList(ctx, &mainState); err != nil {
+						logger.Error("%v", err)
+					}
+				}()
+			}
+		}
+
+		// 启动服务端服务
+		go func() {
+			if err := network.StartNodeServer(ctx, &mainState); err != nil {
+				logger.Error("Error starting node server: %v", err)
+				cancel()
+			}
+		}()
+
+		// 开始前阻塞
+		select {
+		case <-start:
+			// 维护出站连接
+			go connManager.Run(ctx)
+
+			// DHT 节点发现
+			go func() {
+				if err := network.StartDht(ctx, &mainState); err != nil {
+					logger.Error("Error starting dht: %v", err)
+				}
+			}()
+
+			// 节点交换
+			go func() {
+				if err := network.StartPex(ctx, &mainState); err != nil {
+					logger.Error("Error starting pex: %v", err)
+				}
+			}()
+
+			// 启动客户端服务，进行中的轮次在一半期限内结束或保存检查点
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := network.StartNodeClient(ctx, &mainState, shutdownTimeout/2); err != nil {
+					logger.Error("Error starting node client: %v", err)
+					cancel()
+				}
+			}()
+		case <-ctx.Done():
+		}
+	}
+
+	// 监听退出信号
+	<-ctx.Done()
+	logger.Info("Shutting down, deadline %v", shutdownTimeout)
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+
+	// 等待轮次结束
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		logger.Warning("Shutdown deadline exceeded while waiting for rounds")
+	}
+
+	// 清空写队列并关闭连接
+	connManager.Close(shutdownCtx)
+
+	// 数据库落盘
+	if err := db.Close(database); err != nil {
+		return fmt.Errorf("error closing database: %w", err)
+	}
+
+	return nil
+}
+
+// reloadLogLevels 收到 SIGHUP 时重新加载日志格式与级别，其余配置需要重启生效
+func reloadLogLevels(ctx context.Context, cfgFlags *config.Flags, mode string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		cfg, err := cfgFlags.Load(mode)
+		if err != nil {
+			logger.Error("Cannot reload config: %v", err)
+			continue
+		}
+		opts, err := cfg.LogOptions()
+		if err != nil {
+			logger.Error("Cannot reload log levels: %v", err)
+			continue
+		}
+		if err := logger.Configure(opts); err != nil {
+			logger.Error("Cannot reload log levels: %v", err)
+			continue
+		}
+		logger.Info("Log levels reloaded: %v", logger.Levels())
+	}
+}
+
+// openSigner 配置了外部签名进程时连接它，否则从数据目录加载密钥
+func openSigner(cfg *config.Config) (keys.Signer, error) {
+	if cfg.Key.Signer != "" {
+		logger.Info("Using external signer %s", cfg.Key.Signer)
+		return keys.DialSigner(cfg.Key.Signer)
+	}
+
+	pass, err := cfg.KeyPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	keys.SetPassphrase(pass)
+
+	// 设置了口令时明文密钥文件会被加密
+	signer, encrypted, err := keys.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if encrypted {
+		logger.Info("Seed file is now encrypted with the passphrase")
+	}
+	if !signer.Locked() {
+		logger.Warning("Cannot lock the private key in memory, it may be swapped to disk")
+	}
+
+	return signer, nil
+}